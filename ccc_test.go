@@ -0,0 +1,149 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' Clear Command Channel (CCC) unit test.
+*/
+package ftpsclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type CccTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	mutex_X         sync.Mutex
+	commandArray_S  []string
+}
+
+var _ = Suite(&CccTestSuite{})
+
+func (s *CccTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.commandArray_S = nil
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		s.mutex_X.Lock()
+		s.commandArray_S = append(s.commandArray_S, _Command_S)
+		s.mutex_X.Unlock()
+		return false
+	})
+}
+
+func (s *CccTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of '_Server_I' clearing its command channel after the login
+func (s *CccTestSuite) newClient(_Server_I testServer, _SecureFtp_B bool) *FtpsClient {
+	FtpsClientParam_X := newTestParam(_Server_I)
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.ClearCommandChannel_B = true
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the commands received by the server
+func (s *CccTestSuite) commands() (rCommand_S string) {
+	s.mutex_X.Lock()
+	rCommand_S = strings.Join(s.commandArray_S, " ")
+	s.mutex_X.Unlock()
+	return
+}
+
+//Store, list and retrieve a file with '_FtpsClientPtr_X' connected with its control connection in clear text
+func (s *CccTestSuite) transfer(c *C, _FtpsClientPtr_X *FtpsClient) {
+	c.Assert(_FtpsClientPtr_X.Connect(), IsNil)
+	_, Ok_B := _FtpsClientPtr_X.ctrlConnection_I.(*tls.Conn)
+	c.Assert(Ok_B, Equals, false)
+	c.Assert(_FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content")), IsNil)
+	DirEntryArray_X, Err := _FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(DirEntryArray_X, HasLen, 1)
+	LocalFilepath_S := filepath.Join(c.MkDir(), "clip.mxf")
+	c.Assert(_FtpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S), IsNil)
+	Data_U8, Err := os.ReadFile(LocalFilepath_S)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media content")
+	c.Assert(_FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *CccTestSuite) TestClearCommandChannel(c *C) {
+	var TlsEventArray_X []Event
+
+	FtpsClientPtr_X := s.newClient(s.ftpsServerPtr_X, true)
+	FtpsClientPtr_X.FtpsParam_X.OnEvent = func(_Event_X Event) {
+		if _Event_X.Type_E == EVENTTYPE_TLS_UPGRADED {
+			TlsEventArray_X = append(TlsEventArray_X, _Event_X)
+		}
+	}
+	s.transfer(c, FtpsClientPtr_X)
+	c.Assert(s.commands(), Matches, "AUTH USER PASS TYPE CWD PBSZ PROT CCC PASV STOR .* QUIT")
+	//The data connections stay protected
+	c.Assert(TlsEventArray_X, HasLen, 4)
+	for _, Event_X := range TlsEventArray_X[1:] {
+		c.Assert(Event_X.Data_B, Equals, true)
+	}
+}
+
+func (s *CccTestSuite) TestNotSecure(c *C) {
+	FtpsClientPtr_X := s.newClient(s.ftpsServerPtr_X, false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+	c.Assert(strings.Contains(s.commands(), "CCC"), Equals, false)
+}
+
+func (s *CccTestSuite) TestClearDataProtection(c *C) {
+	//Nothing would be protected: the combination is refused before connecting
+	FtpsClientPtr_X := s.newClient(s.ftpsServerPtr_X, true)
+	FtpsClientPtr_X.FtpsParam_X.DataProtection_E = PROTECTIONLEVEL_CLEAR
+	c.Assert(FtpsClientPtr_X.Connect(), Equals, ErrInvalidParameter)
+	c.Assert(s.commands(), Equals, "")
+
+	FtpsClientPtr_X = s.newClient(s.ftpsServerPtr_X, true)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_CLEAR), Equals, ErrInvalidParameter)
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_PRIVATE), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *CccTestSuite) TestRefused(c *C) {
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "CCC", ReplyCode_i: 534, ReplyMessage_S: "Request denied for policy reasons", Count_i: 1})
+	Err := s.newClient(s.ftpsServerPtr_X, true).Connect()
+	c.Assert(errors.Is(Err, ErrSecure), Equals, true, Commentf("%v", Err))
+	var FtpsErrorPtr_X *FtpsError
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_TLS)
+	c.Assert(FtpsErrorPtr_X.ReplyCode_i, Equals, 534)
+}
+
+func (s *CccTestSuite) TestReplay(c *C) {
+	var Buffer_X bytes.Buffer
+
+	FtpsClientPtr_X := s.newClient(s.ftpsServerPtr_X, true)
+	pTranscriptRecorder_X := NewTranscriptRecorder(&Buffer_X)
+	pTranscriptRecorder_X.MaxData_i = 4096
+	FtpsClientPtr_X.FtpsParam_X.TranscriptRecorderPtr_X = pTranscriptRecorder_X
+	s.transfer(c, FtpsClientPtr_X)
+
+	pReplayServer_X, Err := ftpstest.NewReplayServer(bytes.NewReader(Buffer_X.Bytes()))
+	c.Assert(Err, IsNil)
+	defer pReplayServer_X.Close()
+	s.transfer(c, s.newClient(pReplayServer_X, true))
+	c.Assert(pReplayServer_X.Close(), IsNil)
+	c.Assert(pReplayServer_X.Err(), IsNil)
+}
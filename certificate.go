@@ -0,0 +1,122 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+//Error messages generated by the certificate functions
+var (
+	ErrCertificatePin = errors.New("Ftps: Server certificate does not match the pins")
+)
+
+//Prefix of the SPKI pins
+const spkiPinPrefix_S = "sha256/"
+
+//Load the client certificate and its private key from the PEM files '_CertificateFilepath_S' and '_KeyFilepath_S'
+//(which can be the same file)
+//Returns the certificate and error object
+func LoadPemKeyPair(_CertificateFilepath_S string, _KeyFilepath_S string) (rCertificate_X tls.Certificate, rRts error) {
+	rCertificate_X, rRts = tls.LoadX509KeyPair(_CertificateFilepath_S, _KeyFilepath_S)
+	return
+}
+
+//Load the client certificate, its chain and its private key from the PKCS#12 (.p12/.pfx) file '_Filepath_S'
+//protected by '_Password_S'
+//Returns the certificate and error object
+func LoadPkcs12KeyPair(_Filepath_S string, _Password_S string) (rCertificate_X tls.Certificate, rRts error) {
+	var Data_U8 []byte
+	var PrivateKey_I interface{}
+	var pLeaf_X *x509.Certificate
+	var CaArray_X []*x509.Certificate
+
+	Data_U8, rRts = os.ReadFile(_Filepath_S)
+	if rRts == nil {
+		PrivateKey_I, pLeaf_X, CaArray_X, rRts = pkcs12.DecodeChain(Data_U8, _Password_S)
+		if rRts == nil {
+			rCertificate_X.Certificate = [][]byte{pLeaf_X.Raw}
+			for _, pCa_X := range CaArray_X {
+				rCertificate_X.Certificate = append(rCertificate_X.Certificate, pCa_X.Raw)
+			}
+			rCertificate_X.PrivateKey = PrivateKey_I
+			rCertificate_X.Leaf = pLeaf_X
+		}
+	}
+	return
+}
+
+//Returns the SPKI pin of '_CertificatePtr_X': 'sha256/' followed by the base64 SHA-256 hash of its public key
+func CertificatePin(_CertificatePtr_X *x509.Certificate) string {
+	Hash_U8 := sha256.Sum256(_CertificatePtr_X.RawSubjectPublicKeyInfo)
+	return spkiPinPrefix_S + base64.StdEncoding.EncodeToString(Hash_U8[:])
+}
+
+//Returns the fingerprint of '_CertificatePtr_X': the hexadecimal SHA-256 hash of its DER encoding
+func CertificateFingerprint(_CertificatePtr_X *x509.Certificate) string {
+	Hash_U8 := sha256.Sum256(_CertificatePtr_X.Raw)
+	return hex.EncodeToString(Hash_U8[:])
+}
+
+//Check the server certificate '_CertificatePtr_X' against '_PinArray_S'. A pin is a SPKI pin ('sha256/...') or a
+//certificate fingerprint whose case and ':' separators are ignored
+//Returns true if one of the pins matches
+func matchPin(_PinArray_S []string, _CertificatePtr_X *x509.Certificate) bool {
+	Pin_S := CertificatePin(_CertificatePtr_X)
+	Fingerprint_S := CertificateFingerprint(_CertificatePtr_X)
+	for _, Expected_S := range _PinArray_S {
+		if strings.HasPrefix(Expected_S, spkiPinPrefix_S) {
+			if Expected_S == Pin_S {
+				return true
+			}
+		} else if strings.ToLower(strings.ReplaceAll(Expected_S, ":", "")) == Fingerprint_S {
+			return true
+		}
+	}
+	return false
+}
+
+//Build the TLS configuration of the client from TlsConfigPtr_X, ClientCertificatePtr_X and PinArray_S. When pins
+//are defined, they replace the verification of the certificate chain and host name and the VerifyConnection
+//callback of TlsConfigPtr_X is called once the pin check succeeds
+//Returns the tls configuration
+func newTlsConfig(_FtpsParamPtr_X *FtpsClientParam) (rTlsConfigPtr_X *tls.Config) {
+	if _FtpsParamPtr_X.TlsConfigPtr_X != nil {
+		rTlsConfigPtr_X = _FtpsParamPtr_X.TlsConfigPtr_X.Clone()
+	} else {
+		rTlsConfigPtr_X = &tls.Config{}
+	}
+	if rTlsConfigPtr_X.ServerName == "" {
+		rTlsConfigPtr_X.ServerName = _FtpsParamPtr_X.TargetHost_S
+	}
+	if _FtpsParamPtr_X.ClientCertificatePtr_X != nil {
+		rTlsConfigPtr_X.Certificates = []tls.Certificate{*_FtpsParamPtr_X.ClientCertificatePtr_X}
+	}
+	if len(_FtpsParamPtr_X.PinArray_S) != 0 {
+		PinArray_S := append([]string(nil), _FtpsParamPtr_X.PinArray_S...)
+		VerifyConnection := rTlsConfigPtr_X.VerifyConnection
+		rTlsConfigPtr_X.InsecureSkipVerify = true
+		rTlsConfigPtr_X.VerifyConnection = func(_State_X tls.ConnectionState) (rRts error) {
+			rRts = ErrCertificatePin
+			if (len(_State_X.PeerCertificates) != 0) && matchPin(PinArray_S, _State_X.PeerCertificates[0]) {
+				rRts = nil
+				if VerifyConnection != nil {
+					rRts = VerifyConnection(_State_X)
+				}
+			}
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' client certificate and pinning unit test.
+	The test server trusts the authority of 'testdata/ca.pem'. The 'testdata/client.*' certificate of the user
+	'mc' is signed by this authority, 'testdata/client.p12' is protected by 'secret'.
+*/
+package ftpsclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type CertificateTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	mutex_X         sync.Mutex
+	commandArray_S  []string
+}
+
+var _ = Suite(&CertificateTestSuite{})
+
+func (s *CertificateTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	Pem_U8, Err := os.ReadFile("testdata/ca.pem")
+	c.Assert(Err, IsNil)
+	pCertPool_X := x509.NewCertPool()
+	c.Assert(pCertPool_X.AppendCertsFromPEM(Pem_U8), Equals, true)
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a", ClientCaPoolPtr_X: pCertPool_X})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.commandArray_S = nil
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		s.mutex_X.Lock()
+		s.commandArray_S = append(s.commandArray_S, _Command_S)
+		s.mutex_X.Unlock()
+		return false
+	})
+}
+
+func (s *CertificateTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a secure client of the test server logging in with '_ClientCertificatePtr_X' or '_LoginPassword_S' and
+//accepting the server certificate with '_PinArray_S'
+func (s *CertificateTestSuite) newClient(_ClientCertificatePtr_X *tls.Certificate, _LoginPassword_S string, _PinArray_S ...string) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.LoginPassword_S = _LoginPassword_S
+	FtpsClientParam_X.ClientCertificatePtr_X = _ClientCertificatePtr_X
+	FtpsClientParam_X.CertificateLogin_B = true
+	FtpsClientParam_X.TlsConfigPtr_X = nil
+	FtpsClientParam_X.SecureFtp_B = true
+	FtpsClientParam_X.PinArray_S = _PinArray_S
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the commands received by the server
+func (s *CertificateTestSuite) commands() (rCommand_S string) {
+	s.mutex_X.Lock()
+	rCommand_S = strings.Join(s.commandArray_S, " ")
+	s.mutex_X.Unlock()
+	return
+}
+
+//Connect '_FtpsClientPtr_X', list its directory and disconnect it
+func (s *CertificateTestSuite) checkSession(c *C, _FtpsClientPtr_X *FtpsClient) {
+	c.Assert(_FtpsClientPtr_X.Connect(), IsNil)
+	_, Err := _FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(_FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *CertificateTestSuite) TestPin(c *C) {
+	pCertificate_X := s.ftpsServerPtr_X.Certificate()
+	s.checkSession(c, s.newClient(nil, "a", CertificatePin(pCertificate_X)))
+
+	Fingerprint_S := strings.ToUpper(CertificateFingerprint(pCertificate_X))
+	ColonFingerprint_S := Fingerprint_S[:2]
+	for i := 2; i < len(Fingerprint_S); i += 2 {
+		ColonFingerprint_S += ":" + Fingerprint_S[i:i+2]
+	}
+	s.checkSession(c, s.newClient(nil, "a", "sha256/AAAA", ColonFingerprint_S))
+}
+
+func (s *CertificateTestSuite) TestPinMismatch(c *C) {
+	Err := s.newClient(nil, "a", "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", strings.Repeat("0", 64)).Connect()
+	c.Assert(errors.Is(Err, ErrCertificatePin), Equals, true, Commentf("%v", Err))
+	c.Assert(errors.Is(Err, ErrSecure), Equals, true)
+
+	//Without pins, the self-signed certificate of the server is rejected
+	Err = s.newClient(nil, "a").Connect()
+	c.Assert(errors.Is(Err, ErrSecure), Equals, true)
+	var UnknownAuthorityError_X x509.UnknownAuthorityError
+	c.Assert(errors.As(Err, &UnknownAuthorityError_X), Equals, true, Commentf("%v", Err))
+}
+
+func (s *CertificateTestSuite) TestPinVerifyConnection(c *C) {
+	var NbCall_i int
+	var VerifyRts error
+
+	ErrRefused := errors.New("refused by the application")
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = true
+	FtpsClientParam_X.PinArray_S = []string{CertificatePin(s.ftpsServerPtr_X.Certificate())}
+	FtpsClientParam_X.TlsConfigPtr_X = &tls.Config{VerifyConnection: func(_State_X tls.ConnectionState) (rRts error) {
+		s.mutex_X.Lock()
+		NbCall_i++
+		rRts = VerifyRts
+		s.mutex_X.Unlock()
+		return
+	}}
+	//The callback of the caller is kept and called after the pin check of each handshake
+	s.checkSession(c, NewFtpsClient(&FtpsClientParam_X))
+	s.mutex_X.Lock()
+	c.Assert(NbCall_i >= 2, Equals, true, Commentf("%d", NbCall_i))
+	NbCall_i = 0
+	VerifyRts = ErrRefused
+	s.mutex_X.Unlock()
+
+	Err := NewFtpsClient(&FtpsClientParam_X).Connect()
+	c.Assert(errors.Is(Err, ErrRefused), Equals, true, Commentf("%v", Err))
+	c.Assert(errors.Is(Err, ErrSecure), Equals, true)
+
+	//It is not called when the pin check fails
+	FtpsClientParam_X.PinArray_S = []string{strings.Repeat("0", 64)}
+	Err = NewFtpsClient(&FtpsClientParam_X).Connect()
+	c.Assert(errors.Is(Err, ErrCertificatePin), Equals, true, Commentf("%v", Err))
+	s.mutex_X.Lock()
+	c.Assert(NbCall_i, Equals, 1)
+	s.mutex_X.Unlock()
+}
+
+func (s *CertificateTestSuite) TestPemLogin(c *C) {
+	Certificate_X, Err := LoadPemKeyPair("testdata/client.pem", "testdata/client.key")
+	c.Assert(Err, IsNil)
+	s.checkSession(c, s.newClient(&Certificate_X, "", CertificatePin(s.ftpsServerPtr_X.Certificate())))
+	c.Assert(s.commands(), Matches, "AUTH USER TYPE CWD PBSZ PROT PASV LIST QUIT")
+}
+
+func (s *CertificateTestSuite) TestPkcs12Login(c *C) {
+	_, Err := LoadPkcs12KeyPair("testdata/client.p12", "wrong")
+	c.Assert(Err, NotNil)
+	Certificate_X, Err := LoadPkcs12KeyPair("testdata/client.p12", "secret")
+	c.Assert(Err, IsNil)
+	c.Assert(Certificate_X.Leaf, NotNil)
+	c.Assert(Certificate_X.Leaf.Subject.CommonName, Equals, "mc")
+	s.checkSession(c, s.newClient(&Certificate_X, "", CertificatePin(s.ftpsServerPtr_X.Certificate())))
+	c.Assert(strings.Contains(s.commands(), "PASS"), Equals, false)
+}
+
+func (s *CertificateTestSuite) TestPasswordFallback(c *C) {
+	//No certificate: the server asks for the password
+	s.checkSession(c, s.newClient(nil, "a", CertificatePin(s.ftpsServerPtr_X.Certificate())))
+	c.Assert(s.commands(), Matches, "AUTH USER PASS TYPE .*")
+	c.Assert(s.newClient(nil, "wrong", CertificatePin(s.ftpsServerPtr_X.Certificate())).Connect(), NotNil)
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' concurrent use unit test.
+	These tests should be run with the race detector (go test -race).
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type ConcurrencyTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+}
+
+var _ = Suite(&ConcurrencyTestSuite{})
+
+func (s *ConcurrencyTestSuite) SetUpTest(c *C) {
+	var FtpsClientParam_X FtpsClientParam
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789"))
+
+	FtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.KeepAliveInterval_S64 = 10
+	FtpsClientParam_X.KeepAliveDuringTransfer_B = true
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	Err = s.ftpsClientPtr_X.Connect()
+	if Err != nil {
+		c.Fatalf("Connect error: %v\n", Err)
+	}
+}
+
+func (s *ConcurrencyTestSuite) TearDownTest(c *C) {
+	s.ftpsClientPtr_X.Disconnect()
+	s.ftpsServerPtr_X.Close()
+}
+
+//Run a mix of control and data channel operations on the shared client
+//Returns error object
+func (s *ConcurrencyTestSuite) runWorker(_Id_i int, _Directory_S string) (rRts error) {
+	var Data_U8 []byte
+
+	Name_S := fmt.Sprintf("worker_%d.mxf", _Id_i)
+	Content_S := fmt.Sprintf("content of worker %d", _Id_i)
+	for i := 0; (i < 5) && (rRts == nil); i++ {
+		rRts = s.ftpsClientPtr_X.StoreFile(Name_S, []byte(Content_S))
+		if rRts == nil {
+			_, rRts = s.ftpsClientPtr_X.List()
+		}
+		if rRts == nil {
+			var Size_U64 uint64
+
+			Size_U64, rRts = s.ftpsClientPtr_X.GetFileSize(Name_S)
+			if (rRts == nil) && (Size_U64 != uint64(len(Content_S))) {
+				rRts = fmt.Errorf("worker %d: size %d", _Id_i, Size_U64)
+			}
+		}
+		if rRts == nil {
+			LocalFilepath_S := filepath.Join(_Directory_S, Name_S)
+			rRts = s.ftpsClientPtr_X.RetrieveFile(Name_S, LocalFilepath_S)
+			if rRts == nil {
+				Data_U8, rRts = os.ReadFile(LocalFilepath_S)
+				if (rRts == nil) && (string(Data_U8) != Content_S) {
+					rRts = fmt.Errorf("worker %d: content '%s'", _Id_i, string(Data_U8))
+				}
+			}
+		}
+		if rRts == nil {
+			var Reader_I io.ReadCloser
+
+			Reader_I, rRts = s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+			if rRts == nil {
+				Data_U8, rRts = io.ReadAll(Reader_I)
+				Reader_I.Close()
+				if (rRts == nil) && (string(Data_U8) != "0123456789") {
+					rRts = fmt.Errorf("worker %d: stream '%s'", _Id_i, string(Data_U8))
+				}
+			}
+		}
+	}
+	return
+}
+
+func (s *ConcurrencyTestSuite) TestConcurrentOperations(c *C) {
+	var WaitGroup_X sync.WaitGroup
+
+	Directory_S := c.MkDir()
+	ErrArray_X := make([]error, 8)
+	for i := range ErrArray_X {
+		WaitGroup_X.Add(1)
+		go func(_Id_i int) {
+			defer WaitGroup_X.Done()
+			ErrArray_X[_Id_i] = s.runWorker(_Id_i, Directory_S)
+		}(i)
+	}
+	WaitGroup_X.Wait()
+	for _, Err := range ErrArray_X {
+		c.Assert(Err, IsNil)
+	}
+
+	DirEntryArray_X, Err := s.ftpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(len(DirEntryArray_X), Equals, len(ErrArray_X)+1)
+}
+
+func (s *ConcurrencyTestSuite) TestStreamOwnership(c *C) {
+	var Directory_S string
+	var Err error
+
+	Reader_I, Err := s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+
+	DoneChan_X := make(chan error)
+	go func() {
+		var Sts error
+
+		Directory_S, Sts = s.ftpsClientPtr_X.GetWorkingDirectory()
+		DoneChan_X <- Sts
+	}()
+	select {
+	case <-DoneChan_X:
+		c.Fatalf("GetWorkingDirectory has not waited for the end of the transfer")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	Data_U8, Err := io.ReadAll(Reader_I)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+	c.Assert(Reader_I.Close(), IsNil)
+	c.Assert(<-DoneChan_X, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
+
+func (s *ConcurrencyTestSuite) TestLockTimeout(c *C) {
+	s.ftpsClientPtr_X.FtpsParam_X.LockTimeout_S64 = 50
+
+	Writer_I, Err := s.ftpsClientPtr_X.StoreFileStream("upload.mxf")
+	c.Assert(Err, IsNil)
+	_, Err = s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(errors.Is(Err, ErrBusy), Equals, true)
+	_, _, Err = s.ftpsClientPtr_X.OpenFtpDataChannel("LIST", 150)
+	c.Assert(errors.Is(Err, ErrBusy), Equals, true)
+
+	_, Err = Writer_I.Write([]byte("media"))
+	c.Assert(Err, IsNil)
+	c.Assert(Writer_I.Close(), IsNil)
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
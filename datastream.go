@@ -0,0 +1,173 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+//Stream reading the content of a remote file over the ftp data channel
+type ftpsDataReader struct {
+	ftpsClientPtr_X *FtpsClient
+	done_B          bool
+	rts             error
+}
+
+//Stream writing the content of a remote file over the ftp data channel
+type ftpsDataWriter struct {
+	ftpsClientPtr_X *FtpsClient
+	done_B          bool
+}
+
+//Read the file called '_RemoteFilepath_S' on the ftp remote ftp server as a stream. The data channel stays open until
+//the end of the file is reached or the stream is closed: the other operations wait for it in the meantime
+//Returns the stream and error object
+func (this *FtpsClient) RetrieveFileStream(_RemoteFilepath_S string) (rReader_I io.ReadCloser, rRts error) {
+	rReader_I, _, rRts = this.retrieveFileStreamAt(_RemoteFilepath_S, 0)
+	return
+}
+
+//Read the file called '_RemoteFilepath_S' on the ftp remote ftp server as a stream starting at '_Offset_U64' (REST)
+//Returns the stream, the offset of the first byte sent (0 if the server refuses the restart) and error object
+func (this *FtpsClient) retrieveFileStreamAt(_RemoteFilepath_S string, _Offset_U64 uint64) (rReader_I io.ReadCloser, rOffset_U64 uint64, rRts error) {
+	rReader_I = nil
+	rOffset_U64 = 0
+	rRts = this.lock()
+	if rRts == nil {
+		rOffset_U64, rRts = this.sendRequestToFtpServerDataConnAt(fmt.Sprintf("RETR %s", _RemoteFilepath_S), 150, _Offset_U64)
+		if rRts == nil {
+			rReader_I = &ftpsDataReader{ftpsClientPtr_X: this}
+		} else {
+			this.unlock()
+		}
+	}
+	return
+}
+
+//Read the next part of the file. The data channel is closed as soon as the end of file is detected
+//Returns number of byte read and error object
+func (this *ftpsDataReader) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i = 0
+	if this.done_B {
+		rRts = this.rts
+	} else {
+		pFtpsClient_X := this.ftpsClientPtr_X
+		rRts = pFtpsClient_X.dataConnection_I.SetDeadline(time.Now().Add(time.Duration(pFtpsClient_X.FtpsParam_X.DataTimeout_S64) * time.Millisecond))
+		if rRts == nil {
+			rNbRead_i, rRts = pFtpsClient_X.dataConnection_I.Read(_DataArray_U8)
+		}
+		if rRts == io.EOF {
+			this.done_B = true
+			this.rts = io.EOF
+			_, _, rRts = pFtpsClient_X.closeFtpDataChannel()
+			if rRts != nil {
+				this.rts = rRts
+			} else {
+				rRts = io.EOF
+			}
+			pFtpsClient_X.unlock()
+		} else if rRts != nil {
+			this.done_B = true
+			this.rts = rRts
+			pFtpsClient_X.closeFtpDataChannel()
+			pFtpsClient_X.unlock()
+		}
+	}
+	return
+}
+
+//Close the stream. If the end of file has not been reached the transfer is aborted by closing the data channel
+//Returns error object
+func (this *ftpsDataReader) Close() (rRts error) {
+	var ReplyCode_i int
+	var ReplyMessage_S string
+
+	rRts = nil
+	if !this.done_B {
+		this.done_B = true
+		this.rts = ErrIoError
+		pFtpsClient_X := this.ftpsClientPtr_X
+		rRts = pFtpsClient_X.dataConnection_I.Close()
+		pFtpsClient_X.dataConnection_I = nil
+		if rRts == nil {
+			//Depending on the transfer progress the server answers 226 or 426
+			ReplyCode_i, ReplyMessage_S, rRts = pFtpsClient_X.readTransferResponse(0)
+			if rRts != nil {
+				rRts = newFtpsError(FTPPHASE_TRANSFER, pFtpsClient_X.lastRequest_S, 226, ReplyCode_i, ReplyMessage_S, rRts)
+			} else if ReplyCode_i >= 500 {
+				rRts = withPhase(newFtpsError(FTPPHASE_TRANSFER, pFtpsClient_X.lastRequest_S, 226, ReplyCode_i, ReplyMessage_S, nil), FTPPHASE_TRANSFER, ErrIoError)
+			}
+		}
+		pFtpsClient_X.unlock()
+	}
+	return
+}
+
+//Create or replace the file called '_RemoteFilepath_S' on the ftp remote ftp server and write its content as a
+//stream. The transfer is complete when the stream is closed: the other operations wait for it in the meantime
+//Returns the stream and error object
+func (this *FtpsClient) StoreFileStream(_RemoteFilepath_S string) (rWriter_I io.WriteCloser, rRts error) {
+	rWriter_I, rRts = this.openDataWriter(fmt.Sprintf("STOR %s", _RemoteFilepath_S))
+	return
+}
+
+//Append data to the file called '_RemoteFilepath_S' on the ftp remote ftp server as a stream (the file is created
+//if it does not exist). The transfer is complete when the stream is closed
+//Returns the stream and error object
+func (this *FtpsClient) AppendFileStream(_RemoteFilepath_S string) (rWriter_I io.WriteCloser, rRts error) {
+	rWriter_I, rRts = this.openDataWriter(fmt.Sprintf("APPE %s", _RemoteFilepath_S))
+	return
+}
+
+//Send the upload command '_Request_S' and open its data channel
+//Returns the stream and error object
+func (this *FtpsClient) openDataWriter(_Request_S string) (rWriter_I io.WriteCloser, rRts error) {
+	rWriter_I = nil
+	rRts = this.lock()
+	if rRts == nil {
+		rRts = this.sendRequestToFtpServerDataConn(_Request_S, 150)
+		if rRts == nil {
+			rWriter_I = &ftpsDataWriter{ftpsClientPtr_X: this}
+		} else {
+			this.unlock()
+		}
+	}
+	return
+}
+
+//Write the next part of the file
+//Returns number of byte written and error object
+func (this *ftpsDataWriter) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i = 0
+	if this.done_B {
+		rRts = ErrIoError
+	} else {
+		pFtpsClient_X := this.ftpsClientPtr_X
+		rRts = pFtpsClient_X.dataConnection_I.SetDeadline(time.Now().Add(time.Duration(pFtpsClient_X.FtpsParam_X.DataTimeout_S64) * time.Millisecond))
+		if rRts == nil {
+			rNbWrite_i, rRts = pFtpsClient_X.dataConnection_I.Write(_DataArray_U8)
+		}
+		if rRts != nil {
+			this.done_B = true
+			pFtpsClient_X.closeFtpDataChannel()
+			pFtpsClient_X.unlock()
+		}
+	}
+	return
+}
+
+//Close the stream and wait for the server to acknowledge the transfer
+//Returns error object
+func (this *ftpsDataWriter) Close() (rRts error) {
+	rRts = nil
+	if !this.done_B {
+		this.done_B = true
+		_, _, rRts = this.ftpsClientPtr_X.closeFtpDataChannel()
+		this.ftpsClientPtr_X.unlock()
+	}
+	return
+}
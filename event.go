@@ -0,0 +1,165 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+//Kind of client event given to the OnEvent hook
+type EVENTTYPE int
+
+const (
+	//The control connection is established (before the welcome message)
+	EVENTTYPE_CONNECTED EVENTTYPE = iota
+	//The control or data connection (Data_B) has been upgraded to TLS
+	EVENTTYPE_TLS_UPGRADED
+	//The login (USER/PASS) has been accepted
+	EVENTTYPE_LOGGED_IN
+	//A ftp command has been sent on the control connection
+	EVENTTYPE_COMMAND_SENT
+	//The reply to a ftp command has been received, ReplyCode_i is 0 and Err is set if it could not be read
+	EVENTTYPE_REPLY_RECEIVED
+	//The data connection of a transfer has been opened
+	EVENTTYPE_DATA_OPENED
+	//The data connection of a transfer has been closed
+	EVENTTYPE_DATA_CLOSED
+	//A transfer (RETR, STOR, LIST,...) is ended, Err is set if it failed
+	EVENTTYPE_TRANSFER_COMPLETED
+	//The control connection has been closed by Disconnect or dropped after an error (Err)
+	EVENTTYPE_DISCONNECTED
+)
+
+//Returns the name of the event type
+func (this EVENTTYPE) String() string {
+	switch this {
+	case EVENTTYPE_CONNECTED:
+		return "connected"
+	case EVENTTYPE_TLS_UPGRADED:
+		return "tls upgraded"
+	case EVENTTYPE_LOGGED_IN:
+		return "logged in"
+	case EVENTTYPE_COMMAND_SENT:
+		return "command sent"
+	case EVENTTYPE_REPLY_RECEIVED:
+		return "reply received"
+	case EVENTTYPE_DATA_OPENED:
+		return "data opened"
+	case EVENTTYPE_DATA_CLOSED:
+		return "data closed"
+	case EVENTTYPE_TRANSFER_COMPLETED:
+		return "transfer completed"
+	case EVENTTYPE_DISCONNECTED:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+//Client event given to the OnEvent hook. The fields which do not apply to the event type are left to their zero value
+type Event struct {
+	Type_E EVENTTYPE
+	//Id_U32 of the client
+	Id_U32 uint32
+	Time_X time.Time
+	//Remote address of the control or data connection
+	Address_S string
+	//Ftp command, its credentials are masked as in the logs. For the transfer events, it is the transfer command
+	Command_S      string
+	ReplyCode_i    int
+	ReplyMessage_S string
+	//Event of the data connection (TLS_UPGRADED)
+	Data_B bool
+	//TLS version name (TLS_UPGRADED)
+	TlsVersion_S string
+	//Bytes received and sent on the data connection (DATA_CLOSED, TRANSFER_COMPLETED)
+	NbRead_U64  uint64
+	NbWrite_U64 uint64
+	//Latency of the reply (REPLY_RECEIVED), duration of the connection (CONNECTED) or of the transfer
+	//(DATA_CLOSED, TRANSFER_COMPLETED)
+	Duration_S64 time.Duration
+	Err          error
+}
+
+//Data connection giving its bytes to the transfer event
+type eventDataConn struct {
+	net.Conn
+	ftpsClientPtr_X *FtpsClient
+	closed_B        bool
+}
+
+//Give the event '_Event_X' to the OnEvent hook if it is defined
+func (this *FtpsClient) emit(_Event_X Event) {
+	if this.FtpsParam_X.OnEvent != nil {
+		_Event_X.Id_U32 = this.FtpsParam_X.Id_U32
+		_Event_X.Time_X = time.Now()
+		this.FtpsParam_X.OnEvent(_Event_X)
+	}
+}
+
+//Give the TLS_UPGRADED event of the control or data ('_Data_B') connection '_Connection_I'
+func (this *FtpsClient) emitTlsUpgraded(_Connection_I net.Conn, _Data_B bool) {
+	if pTlsConnection_X, Ok_B := _Connection_I.(*tls.Conn); Ok_B && (this.FtpsParam_X.OnEvent != nil) {
+		this.emit(Event{Type_E: EVENTTYPE_TLS_UPGRADED, Address_S: _Connection_I.RemoteAddr().String(), Command_S: this.lastRequest_S, Data_B: _Data_B, TlsVersion_S: tls.VersionName(pTlsConnection_X.ConnectionState().Version)})
+	}
+}
+
+//Start the transfer event of the transfer command '_Request_S'
+func (this *FtpsClient) startTransferEvent(_Request_S string) {
+	this.transferEvent_X = Event{Type_E: EVENTTYPE_TRANSFER_COMPLETED, Command_S: this.redact(_Request_S), Time_X: time.Now()}
+	this.transferEventPending_B = true
+}
+
+//Give the TRANSFER_COMPLETED event of the transfer in progress, if any, with its reply '_ReplyCode_i'
+//'_ReplyMessage_S' and the error '_Err'
+func (this *FtpsClient) endTransferEvent(_ReplyCode_i int, _ReplyMessage_S string, _Err error) {
+	if this.transferEventPending_B {
+		this.transferEventPending_B = false
+		this.transferEvent_X.ReplyCode_i = _ReplyCode_i
+		this.transferEvent_X.ReplyMessage_S = _ReplyMessage_S
+		this.transferEvent_X.Duration_S64 = time.Since(this.transferEvent_X.Time_X)
+		this.transferEvent_X.Err = _Err
+		this.emit(this.transferEvent_X)
+	}
+}
+
+//Wrap the data connection '_Connection_I' to count its bytes if an OnEvent hook is defined
+//Returns the wrapped connection
+func (this *FtpsClient) newEventDataConn(_Connection_I net.Conn) (rConnection_I net.Conn) {
+	rConnection_I = _Connection_I
+	if this.FtpsParam_X.OnEvent != nil {
+		rConnection_I = &eventDataConn{Conn: _Connection_I, ftpsClientPtr_X: this}
+	}
+	return
+}
+
+//Read from the data connection and count the bytes received
+//Returns number of byte read and error object
+func (this *eventDataConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	this.ftpsClientPtr_X.transferEvent_X.NbRead_U64 += uint64(rNbRead_i)
+	return
+}
+
+//Write to the data connection and count the bytes sent
+//Returns number of byte written and error object
+func (this *eventDataConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i, rRts = this.Conn.Write(_DataArray_U8)
+	this.ftpsClientPtr_X.transferEvent_X.NbWrite_U64 += uint64(rNbWrite_i)
+	return
+}
+
+//Close the data connection and give the DATA_CLOSED event
+//Returns error object
+func (this *eventDataConn) Close() (rRts error) {
+	rRts = this.Conn.Close()
+	if !this.closed_B {
+		this.closed_B = true
+		Event_X := this.ftpsClientPtr_X.transferEvent_X
+		this.ftpsClientPtr_X.emit(Event{Type_E: EVENTTYPE_DATA_CLOSED, Address_S: this.Conn.RemoteAddr().String(), Command_S: Event_X.Command_S, NbRead_U64: Event_X.NbRead_U64, NbWrite_U64: Event_X.NbWrite_U64, Duration_S64: time.Since(Event_X.Time_X), Err: rRts})
+	}
+	return
+}
@@ -0,0 +1,160 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' event hook unit test.
+*/
+package ftpsclient
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type EventTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	mutex_X         sync.Mutex
+	eventArray_X    []Event
+}
+
+var _ = Suite(&EventTestSuite{})
+
+func (s *EventTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.eventArray_X = nil
+}
+
+func (s *EventTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of the test server giving its events to the suite
+func (s *EventTestSuite) newClient(_SecureFtp_B bool) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.Id_U32 = 7
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.OnEvent = func(_Event_X Event) {
+		s.mutex_X.Lock()
+		s.eventArray_X = append(s.eventArray_X, _Event_X)
+		s.mutex_X.Unlock()
+	}
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the events of type '_Type_E'
+func (s *EventTestSuite) find(_Type_E EVENTTYPE) (rEventArray_X []Event) {
+	s.mutex_X.Lock()
+	for _, Event_X := range s.eventArray_X {
+		if Event_X.Type_E == _Type_E {
+			rEventArray_X = append(rEventArray_X, Event_X)
+		}
+	}
+	s.mutex_X.Unlock()
+	return
+}
+
+//Returns the events as 'type command' lines, skipping the command and reply ones
+func (s *EventTestSuite) lifecycle() (rLineArray_S []string) {
+	s.mutex_X.Lock()
+	for _, Event_X := range s.eventArray_X {
+		if (Event_X.Type_E != EVENTTYPE_COMMAND_SENT) && (Event_X.Type_E != EVENTTYPE_REPLY_RECEIVED) {
+			rLineArray_S = append(rLineArray_S, fmt.Sprintf("%s %s", Event_X.Type_E, Event_X.Command_S))
+		}
+	}
+	s.mutex_X.Unlock()
+	return
+}
+
+func (s *EventTestSuite) TestLifecycle(c *C) {
+	FtpsClientPtr_X := s.newClient(false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content")), IsNil)
+	c.Assert(FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	c.Assert(FtpsClientPtr_X.DeleteFile("clip.mxf"), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	c.Assert(s.lifecycle(), DeepEquals, []string{
+		"connected ",
+		"logged in USER mc",
+		"data opened STOR clip.mxf",
+		"data closed STOR clip.mxf",
+		"transfer completed STOR clip.mxf",
+		"data opened RETR clip.mxf",
+		"data closed RETR clip.mxf",
+		"transfer completed RETR clip.mxf",
+		"disconnected ",
+	})
+	for _, Event_X := range s.eventArray_X {
+		c.Assert(Event_X.Id_U32, Equals, uint32(7))
+		c.Assert(Event_X.Time_X.IsZero(), Equals, false)
+	}
+	c.Assert(s.find(EVENTTYPE_CONNECTED)[0].Address_S, Equals, fmt.Sprintf("%s:%d", s.ftpsServerPtr_X.Host(), s.ftpsServerPtr_X.Port()))
+	c.Assert(s.find(EVENTTYPE_DISCONNECTED)[0].Err, IsNil)
+
+	TransferArray_X := s.find(EVENTTYPE_TRANSFER_COMPLETED)
+	c.Assert(TransferArray_X[0].NbWrite_U64, Equals, uint64(len("media content")))
+	c.Assert(TransferArray_X[0].ReplyCode_i, Equals, 226)
+	c.Assert(TransferArray_X[0].Err, IsNil)
+	c.Assert(TransferArray_X[1].NbRead_U64, Equals, uint64(len("media content")))
+	c.Assert(s.find(EVENTTYPE_DATA_CLOSED)[1].NbRead_U64, Equals, uint64(len("media content")))
+
+	SentArray_X := s.find(EVENTTYPE_COMMAND_SENT)
+	ReplyArray_X := s.find(EVENTTYPE_REPLY_RECEIVED)
+	c.Assert(len(SentArray_X), Equals, len(ReplyArray_X))
+	CommandArray_S := []string{}
+	for i, Event_X := range SentArray_X {
+		CommandArray_S = append(CommandArray_S, Event_X.Command_S)
+		c.Assert(ReplyArray_X[i].Command_S, Equals, Event_X.Command_S)
+	}
+	c.Assert(CommandArray_S[:3], DeepEquals, []string{"USER mc", "PASS ****", "TYPE I"})
+	c.Assert(CommandArray_S[len(CommandArray_S)-2:], DeepEquals, []string{"DELE clip.mxf", "QUIT"})
+	c.Assert(ReplyArray_X[1].ReplyCode_i, Equals, 230)
+	c.Assert(ReplyArray_X[len(ReplyArray_X)-2].ReplyCode_i, Equals, 250)
+}
+
+func (s *EventTestSuite) TestSecure(c *C) {
+	FtpsClientPtr_X := s.newClient(true)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	_, Err := FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	TlsArray_X := s.find(EVENTTYPE_TLS_UPGRADED)
+	c.Assert(TlsArray_X, HasLen, 2)
+	c.Assert(TlsArray_X[0].Data_B, Equals, false)
+	c.Assert(TlsArray_X[0].TlsVersion_S, Matches, "TLS 1\\.[23]")
+	c.Assert(TlsArray_X[1].Data_B, Equals, true)
+	c.Assert(TlsArray_X[1].Command_S, Equals, "LIST -a")
+	c.Assert(s.lifecycle()[:3], DeepEquals, []string{"connected ", "tls upgraded AUTH TLS", "logged in USER mc"})
+}
+
+func (s *EventTestSuite) TestFailure(c *C) {
+	FtpsClientPtr_X := s.newClient(false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "RETR", ReplyCode_i: 550, ReplyMessage_S: "No such file", Count_i: 1})
+	c.Assert(FtpsClientPtr_X.RetrieveFile("missing.mxf", filepath.Join(c.MkDir(), "missing.mxf")), NotNil)
+	TransferArray_X := s.find(EVENTTYPE_TRANSFER_COMPLETED)
+	c.Assert(TransferArray_X, HasLen, 1)
+	c.Assert(TransferArray_X[0].Command_S, Equals, "RETR missing.mxf")
+	c.Assert(IsPermanent(TransferArray_X[0].Err), Equals, true)
+
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "PWD", ReplyCode_i: 421, ReplyMessage_S: "Service not available", Count_i: 1})
+	_, Err := FtpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, NotNil)
+	DisconnectArray_X := s.find(EVENTTYPE_DISCONNECTED)
+	c.Assert(DisconnectArray_X, HasLen, 1)
+	c.Assert(DisconnectArray_X[0].Err, NotNil)
+	ReplyArray_X := s.find(EVENTTYPE_REPLY_RECEIVED)
+	c.Assert(ReplyArray_X[len(ReplyArray_X)-1].ReplyCode_i, Equals, 421)
+}
@@ -31,12 +31,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net"
 	"net/textproto"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -52,6 +56,7 @@ var (
 	ErrInvalidDirectory = errors.New("Ftps: Invalid directory")
 	ErrNotDisconnected  = errors.New("Ftps: Can't disconnect")
 	ErrSecure           = errors.New("Ftps: Secure protocol error")
+	ErrBusy             = errors.New("Ftps: Client is busy")
 )
 
 //File type container
@@ -73,6 +78,25 @@ type DirEntry struct {
 	Time_X   time.Time
 }
 
+//Returns the file name of the entry with its extension
+func (this DirEntry) FullName() string {
+	if this.Ext_S == "" {
+		return this.Name_S
+	}
+	return this.Name_S + "." + this.Ext_S
+}
+
+//Split the file name '_FullName_S' into its name and extension parts
+func (this *DirEntry) setFullName(_FullName_S string) {
+	this.Name_S = _FullName_S
+	this.Ext_S = ""
+	SepIndex_i := strings.LastIndex(_FullName_S, ".")
+	if (SepIndex_i >= 0) && (SepIndex_i < len(_FullName_S)-1) {
+		this.Ext_S = _FullName_S[SepIndex_i+1:]
+		this.Name_S = _FullName_S[:SepIndex_i]
+	}
+}
+
 //Ftps client working parameters
 type FtpsClientParam struct {
 	//public
@@ -84,7 +108,8 @@ type FtpsClientParam struct {
 	TargetHost_S            string
 	TargetPort_U16          uint16
 	Debug_B                 bool
-	TlsConfig_X             tls.Config
+	TlsConfigPtr_X          *tls.Config
+	//Connection, control reply and data transfer timeouts in ms (2000 means 2 seconds, not 2*time.Second)
 	ConnectTimeout_S64      time.Duration
 	CtrlTimeout_S64         time.Duration
 	DataTimeout_S64         time.Duration
@@ -92,15 +117,103 @@ type FtpsClientParam struct {
 	CtrlWriteBufferSize_U32 uint32
 	DataReadBufferSize_U32  uint32
 	DataWriteBufferSize_U32 uint32
+	RetryPolicy_X           RetryPolicy
+	//Idle delay in ms after which a NOOP command is sent on the control connection, 0 disables the keep-alive
+	KeepAliveInterval_S64 time.Duration
+	//Also send the NOOP commands while a data transfer is in progress (their replies are consumed with the transfer one)
+	KeepAliveDuringTransfer_B bool
+	//Maximum delay in ms to wait for the client to be available when it is used by another goroutine, 0 waits forever
+	LockTimeout_S64 time.Duration
+	//Called during the data transfers (store, retrieve, list, streams and data channel) with their progress. It runs
+	//in the goroutine doing the transfer and must not use the client
+	OnProgress func(_Progress_X TransferProgress)
+	//Minimum delay in ms between two OnProgress calls of a transfer, 0 reports each data block
+	ProgressInterval_S64 time.Duration
+	//Bandwidth limit of the data transfers in bytes per second (0 for no limit) with bursts of MaxBurst_U64 bytes
+	//(0 for one second of transfer). It can be changed at runtime with SetRateLimit
+	MaxRate_U64  uint64
+	MaxBurst_U64 uint64
+	//Structured logger receiving the debug messages at the Debug level with the session id, command, reply code and
+	//duration fields, and the warnings at the Warn level. If nil, a text logger writing to stderr is used when Debug_B
+	//is true and the warnings go to the default slog logger
+	Logger_X *slog.Logger
+	//SITE commands matching one of these regular expressions are masked in the logs and errors like the PASS and
+	//ACCT commands
+	RedactPatternArray_X []*regexp.Regexp
+	//Recorder of the control connection lines and data channel transfers, nil if none
+	TranscriptRecorderPtr_X *TranscriptRecorder
+	//Receiver of the command, connection and data transfer measures, nil if none
+	Metrics_I Metrics
+	//Creator of the spans of the connections, commands, data channel openings and transfers, nil if none
+	Tracer_I Tracer
+	//Hook called for each connection, command and transfer event of the client (see EVENTTYPE), nil if none. It is
+	//called synchronously by the goroutine running the operation, or by the keep-alive one, and must not use the client
+	OnEvent func(_Event_X Event)
+	//Client certificate presented in the TLS handshakes (see LoadPemKeyPair and LoadPkcs12KeyPair), nil if none
+	ClientCertificatePtr_X *tls.Certificate
+	//Skip the PASS command when the server accepts the client certificate as login (232 reply to USER)
+	CertificateLogin_B bool
+	//Pins of the server certificate: SPKI pins ('sha256/' followed by the base64 hash of the public key) or SHA-256
+	//fingerprints in hexadecimal (see CertificatePin and CertificateFingerprint). When defined, a server certificate
+	//matching one of them is accepted without verifying its chain and host name, so self-signed ones can be used.
+	//The VerifyConnection callback of TlsConfigPtr_X, if any, is still called after a successful pin check
+	PinArray_S []string
+	//Send CCC after the login and PROT P to go back to a clear control connection (for the firewalls inspecting the
+	//ftp commands), the data connections stay protected: it can't be used with the PROTECTIONLEVEL_CLEAR data
+	//protection
+	ClearCommandChannel_B bool
+	//Protection level of the data connections in secure mode, it can be changed for the next transfers with
+	//SetDataProtection or for the next one only with SetNextDataProtection
+	DataProtection_E PROTECTIONLEVEL
+	//Function opening the control and passive data connections, for example the DialContext method of a Socks5Dialer
+	//or of a HttpConnectDialer to go through a proxy. A net.Dialer is used when nil
+	DialContext DialContextFunc
+	//Host of the passive data connections: the control host (default), the address of the PASV reply or this address
+	//only if it is public. A warning is logged when the PASV address is not the control one
+	PasvPolicy_E PASVPOLICY
 }
 
-//Ftps characteristics
+//Ftps characteristics. A FtpsClient can be shared by several goroutines: its operations are serialized
 type FtpsClient struct {
 	FtpsParam_X FtpsClientParam
 
-	ctrlConnection_I  net.Conn
-	dataConnection_I  net.Conn
-	textProtocolPtr_X *textproto.Conn
+	ctrlConnection_I   net.Conn
+	dataConnection_I   net.Conn
+	textProtocolPtr_X  *textproto.Conn
+	lastRequest_S      string
+	workingDirectory_S string
+	connectionLost_B   bool
+	//Give the client to a single operation at a time (a data channel stream owns it until it is closed)
+	operationChan_X    chan bool
+	dataChannelOwned_B bool
+	//Serialize the control channel exchanges with the keep-alive
+	ctrlMutex_X          sync.Mutex
+	lastActivity_X       time.Time
+	transferInProgress_B bool
+	pendingNoop_i        int
+	keepAliveStopChan_X  chan bool
+	keepAliveWaitGroup_X sync.WaitGroup
+	//Bandwidth limit of the session and of the pool it belongs to (nil if none)
+	rateLimiterPtr_X     *RateLimiter
+	poolRateLimiterPtr_X *RateLimiter
+	//Debug logger with the session id field (nil if none) and time of the last command sent
+	loggerPtr_X   *slog.Logger
+	requestTime_X time.Time
+	//Spans of the connection and of the transfer in progress (nil if none)
+	connectSpan_I  Span
+	transferSpan_I Span
+	//Event of the transfer in progress given when it is completed
+	transferEvent_X        Event
+	transferEventPending_B bool
+	//TLS configuration built from the parameters
+	tlsConfigPtr_X *tls.Config
+	//Data protection level requested for the transfers and the one set on the server
+	dataProtection_E       PROTECTIONLEVEL
+	serverDataProtection_E PROTECTIONLEVEL
+	//Data protection level of the next operation sending a data command (SetNextDataProtection)
+	nextDataProtection_E     PROTECTIONLEVEL
+	nextDataProtection_B     bool
+	nextDataProtectionUsed_B bool
 }
 
 //Interface used to fiw tx and rx buffer size
@@ -129,47 +242,110 @@ func setConBufferSize(_Connection_I net.Conn, _ReadBufferSize_U32 uint32, _Write
 func NewFtpsClient(_FtpsClientParamPtr_X *FtpsClientParam) *FtpsClient {
 	p := new(FtpsClient)
 	p.FtpsParam_X = *_FtpsClientParamPtr_X
-	log.SetFlags(log.Lmicroseconds)
+	p.operationChan_X = make(chan bool, 1)
+	p.rateLimiterPtr_X = NewRateLimiter(p.FtpsParam_X.MaxRate_U64, p.FtpsParam_X.MaxBurst_U64)
+	p.tlsConfigPtr_X = newTlsConfig(&p.FtpsParam_X)
+	p.dataProtection_E = p.FtpsParam_X.DataProtection_E
+	p.loggerPtr_X = p.FtpsParam_X.Logger_X
+	if (p.loggerPtr_X == nil) && p.FtpsParam_X.Debug_B {
+		p.loggerPtr_X = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if p.loggerPtr_X != nil {
+		p.loggerPtr_X = p.loggerPtr_X.With("id", p.FtpsParam_X.Id_U32)
+	}
 	return p
 }
 
 //Connect the client application to the remote ftp server
-//Returns error object
+//Returns error object (a FtpsError giving the failing phase and the error such as ErrInvalidLogin, or
+//ErrInvalidParameter if ClearCommandChannel_B is used with the PROTECTIONLEVEL_CLEAR data protection)
 func (this *FtpsClient) Connect() (rRts error) {
+	if this.FtpsParam_X.ClearCommandChannel_B && (this.FtpsParam_X.DataProtection_E == PROTECTIONLEVEL_CLEAR) {
+		//Nothing would be protected once the command channel is cleared
+		rRts = ErrInvalidParameter
+	} else {
+		rRts = this.lock()
+		if rRts == nil {
+			rRts = this.connect()
+			this.unlock()
+		}
+	}
+	return
+}
+
+//Connect the client application to the remote ftp server, the caller must own the client
+//Returns error object
+func (this *FtpsClient) connect() (rRts error) {
 	var Sts error
+	var Phase_E FTPPHASE
+	var ReplyCode_i, ExpectedReplyCode_i int
+	var ReplyMessage_S string
 
+	this.stopKeepAlive()
+	this.transferInProgress_B = false
+	this.endTransferSpan(ErrNotConnected)
+	this.endTransferEvent(0, "", ErrNotConnected)
+	this.pendingNoop_i = 0
+	this.serverDataProtection_E = PROTECTIONLEVEL_CLEAR
+	this.connectSpan_I = this.startSpan("ftp.connect", nil)
+	this.connectSpan_I.SetAttribute("server.address", this.FtpsParam_X.TargetHost_S)
+	this.connectSpan_I.SetAttribute("server.port", int(this.FtpsParam_X.TargetPort_U16))
 	rRts = ErrNotConnected
-	this.ctrlConnection_I, Sts = net.DialTimeout("tcp4", fmt.Sprintf("%s:%d", this.FtpsParam_X.TargetHost_S, this.FtpsParam_X.TargetPort_U16), this.FtpsParam_X.ConnectTimeout_S64)
-	this.debugInfo("[FTP CON] Connect to " + fmt.Sprintf("%s:%d->%v", this.FtpsParam_X.TargetHost_S, this.FtpsParam_X.TargetPort_U16, Sts))
+	Phase_E = FTPPHASE_CONNECT
+	this.requestTime_X = time.Now()
+	this.ctrlConnection_I, Sts = this.dial(this.FtpsParam_X.TargetHost_S, int(this.FtpsParam_X.TargetPort_U16))
+	this.debugInfo("connect", "host", this.FtpsParam_X.TargetHost_S, "port", this.FtpsParam_X.TargetPort_U16, "duration", time.Since(this.requestTime_X), "err", Sts)
 	if Sts == nil {
+		this.record(TranscriptEntry{Direction_E: TRANSCRIPTDIRECTION_OPEN, Line_S: this.ctrlConnection_I.RemoteAddr().String()})
+		this.emit(Event{Type_E: EVENTTYPE_CONNECTED, Address_S: this.ctrlConnection_I.RemoteAddr().String(), Duration_S64: time.Since(this.requestTime_X)})
 		Sts = setConBufferSize(this.ctrlConnection_I, this.FtpsParam_X.CtrlReadBufferSize_U32, this.FtpsParam_X.CtrlWriteBufferSize_U32)
-		this.debugInfo("[FTP CON] setConBufferSize to " + fmt.Sprintf("C %d W %d Sts %v", this.FtpsParam_X.CtrlReadBufferSize_U32, this.FtpsParam_X.CtrlWriteBufferSize_U32, Sts))
+		this.debugInfo("set buffer size", "read", this.FtpsParam_X.CtrlReadBufferSize_U32, "write", this.FtpsParam_X.CtrlWriteBufferSize_U32, "err", Sts)
 		if Sts == nil {
-			this.textProtocolPtr_X = textproto.NewConn(this.ctrlConnection_I)
+			this.textProtocolPtr_X = this.newTextProtocol(this.ctrlConnection_I)
 			_, _, Sts = this.readFtpServerResponse(220)
-			this.debugInfo("[FTP CON] Wait 220 " + fmt.Sprintf("Secure %v Sts %v", this.FtpsParam_X.SecureFtp_B, Sts))
+			this.debugInfo("welcome", "secure", this.FtpsParam_X.SecureFtp_B, "err", Sts)
+			if Sts != nil {
+				Sts = newFtpsError(FTPPHASE_CONNECT, "", 220, 0, "", Sts)
+			}
 
 			if Sts == nil {
 				if this.FtpsParam_X.SecureFtp_B {
 					rRts = ErrSecure
+					Phase_E = FTPPHASE_TLS
 					_, _, Sts = this.sendRequestToFtpServer("AUTH TLS", 234)
-					this.debugInfo("[FTP CON] AUTH TLS " + fmt.Sprintf("Sts %v", Sts))
+					this.debugInfo("auth tls", "err", Sts)
 
 					if Sts == nil {
-						this.ctrlConnection_I = this.upgradeConnectionToTLS(this.ctrlConnection_I)
-						this.textProtocolPtr_X = textproto.NewConn(this.ctrlConnection_I)
+						this.ctrlConnection_I, Sts = this.upgradeConnectionToTLS(this.ctrlConnection_I, time.Duration(this.FtpsParam_X.CtrlTimeout_S64)*time.Millisecond)
+						setTlsVersion(this.connectSpan_I, this.ctrlConnection_I)
+						if Sts == nil {
+							this.emitTlsUpgraded(this.ctrlConnection_I, false)
+						}
+						this.textProtocolPtr_X = this.newTextProtocol(this.ctrlConnection_I)
 					}
 				}
 			}
 
 			if Sts == nil {
 				rRts = ErrInvalidLogin
-				_, _, Sts = this.sendRequestToFtpServer(fmt.Sprintf("USER %s", this.FtpsParam_X.LoginName_S), 331)
-				this.debugInfo("[FTP CON] USER " + fmt.Sprintf("%s Sts %v", this.FtpsParam_X.LoginPassword_S, Sts))
+				Phase_E = FTPPHASE_LOGIN
+				ExpectedReplyCode_i = 331
+				if this.FtpsParam_X.CertificateLogin_B {
+					ExpectedReplyCode_i = 0
+				}
+				ReplyCode_i, ReplyMessage_S, Sts = this.sendRequestToFtpServer(fmt.Sprintf("USER %s", this.FtpsParam_X.LoginName_S), ExpectedReplyCode_i)
+				if (Sts == nil) && (ReplyCode_i != 331) && (ReplyCode_i != 232) {
+					//Certificate login: any other reply is an error
+					Sts = newFtpsError(FTPPHASE_COMMAND, fmt.Sprintf("USER %s", this.FtpsParam_X.LoginName_S), 331, ReplyCode_i, ReplyMessage_S, &textproto.Error{Code: ReplyCode_i, Msg: ReplyMessage_S})
+				}
+				this.debugInfo("login", "user", this.FtpsParam_X.LoginName_S, "certificate", ReplyCode_i == 232, "err", Sts)
 
 				if Sts == nil {
-					_, _, Sts = this.sendRequestToFtpServer(fmt.Sprintf("PASS %s", this.FtpsParam_X.LoginPassword_S), 230)
+					if ReplyCode_i == 331 {
+						ReplyCode_i, ReplyMessage_S, Sts = this.sendRequestToFtpServer(fmt.Sprintf("PASS %s", this.FtpsParam_X.LoginPassword_S), 230)
+					}
 					if Sts == nil {
+						this.emit(Event{Type_E: EVENTTYPE_LOGGED_IN, Command_S: fmt.Sprintf("USER %s", this.FtpsParam_X.LoginName_S), ReplyCode_i: ReplyCode_i, ReplyMessage_S: ReplyMessage_S})
 						rRts = ErrInvalidParameter
 						_, _, Sts = this.sendRequestToFtpServer("TYPE I", 200)
 						if Sts == nil {
@@ -179,9 +355,18 @@ func (this *FtpsClient) Connect() (rRts error) {
 							if Sts == nil {
 								if this.FtpsParam_X.SecureFtp_B {
 									rRts = ErrSecure
+									Phase_E = FTPPHASE_TLS
 									_, _, Sts = this.sendRequestToFtpServer("PBSZ 0", 200)
 									if Sts == nil {
-										_, _, Sts = this.sendRequestToFtpServer("PROT P", 200) // encrypt data connection
+										Sts = this.applyDataProtection(this.dataProtection_E)
+									}
+									if (Sts == nil) && this.FtpsParam_X.ClearCommandChannel_B {
+										_, _, Sts = this.sendRequestToFtpServer("CCC", 200)
+										if Sts == nil {
+											this.ctrlConnection_I, Sts = this.downgradeConnectionFromTLS(this.ctrlConnection_I, time.Duration(this.FtpsParam_X.CtrlTimeout_S64)*time.Millisecond)
+											this.textProtocolPtr_X = this.newTextProtocol(this.ctrlConnection_I)
+										}
+										this.debugInfo("ccc", "err", Sts)
 									}
 								}
 							}
@@ -189,19 +374,41 @@ func (this *FtpsClient) Connect() (rRts error) {
 					}
 				}
 			}
-			if Sts == nil {
-				rRts = nil
-			}
 		}
 	}
+	if Sts == nil {
+		rRts = nil
+		this.connectionLost_B = false
+		this.startKeepAlive()
+	} else {
+		rRts = withPhase(Sts, Phase_E, rRts)
+		this.dropConnection(rRts)
+	}
+	this.observeConnect(rRts)
+	endSpan(this.connectSpan_I, rRts)
+	this.connectSpan_I = nil
 	return
 }
 
 //Returns the current working ftp directory
 //Returns current working ftp directory and error object
 func (this *FtpsClient) GetWorkingDirectory() (rDirectory_S string, rRts error) {
+	rRts = this.lock()
+	if rRts == nil {
+		rDirectory_S, rRts = this.getWorkingDirectory()
+		this.unlock()
+	}
+	return
+}
+
+//Send the 'PWD' command, the caller must own the client
+//Returns current working ftp directory and error object
+func (this *FtpsClient) getWorkingDirectory() (rDirectory_S string, rRts error) {
 
-	_, rDirectory_S, rRts = this.sendRequestToFtpServer("PWD", 257)
+	rRts = this.retry(func() (rRts error) {
+		_, rDirectory_S, rRts = this.sendRequestToFtpServer("PWD", 257)
+		return
+	})
 	if rRts == nil {
 		StartPos_i := strings.Index(rDirectory_S, "\"")
 		EndPos_i := strings.LastIndex(rDirectory_S, "\"")
@@ -218,11 +425,20 @@ func (this *FtpsClient) GetWorkingDirectory() (rDirectory_S string, rRts error)
 	return
 }
 
-//Change the current working ftp directory
+//Change the current working ftp directory. The new directory is restored if the client has to reconnect
 //Returns error object
 func (this *FtpsClient) ChangeWorkingDirectory(_Path_S string) (rRts error) {
-
-	_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("CWD %s", _Path_S), 250)
+	rRts = this.lock()
+	if rRts == nil {
+		rRts = this.retry(func() (rRts error) {
+			_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("CWD %s", _Path_S), 250)
+			return
+		})
+		if rRts == nil {
+			this.workingDirectory_S, _ = this.getWorkingDirectory()
+		}
+		this.unlock()
+	}
 	return
 }
 
@@ -230,7 +446,11 @@ func (this *FtpsClient) ChangeWorkingDirectory(_Path_S string) (rRts error) {
 //Returns error object
 func (this *FtpsClient) MakeDirectory(_Path_S string) (rRts error) {
 
-	_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("MKD %s", _Path_S), 257)
+	rRts = this.lock()
+	if rRts == nil {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("MKD %s", _Path_S), 257)
+		this.unlock()
+	}
 	return
 }
 
@@ -238,7 +458,11 @@ func (this *FtpsClient) MakeDirectory(_Path_S string) (rRts error) {
 //Returns error object
 func (this *FtpsClient) DeleteFile(_Path_S string) (rRts error) {
 
-	_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("DELE %s", _Path_S), 250)
+	rRts = this.lock()
+	if rRts == nil {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("DELE %s", _Path_S), 250)
+		this.unlock()
+	}
 	return
 }
 
@@ -246,25 +470,68 @@ func (this *FtpsClient) DeleteFile(_Path_S string) (rRts error) {
 //Returns error object
 func (this *FtpsClient) RemoveDirectory(_Path_S string) (rRts error) {
 
-	_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("RMD %s", _Path_S), 250)
+	rRts = this.lock()
+	if rRts == nil {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("RMD %s", _Path_S), 250)
+		this.unlock()
+	}
+	return
+}
+
+//Rename the file or directory called '_FromPath_S' into '_ToPath_S' on the remote Ftp server
+//Returns error object
+func (this *FtpsClient) Rename(_FromPath_S string, _ToPath_S string) (rRts error) {
+
+	rRts = this.lock()
+	if rRts == nil {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("RNFR %s", _FromPath_S), 350)
+		if rRts == nil {
+			_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("RNTO %s", _ToPath_S), 250)
+		}
+		this.unlock()
+	}
+	return
+}
+
+//Change the permission bits of the file or directory called '_Path_S' on the remote Ftp server (SITE CHMOD)
+//Returns error object
+func (this *FtpsClient) ChangeMode(_Path_S string, _Mode_X fs.FileMode) (rRts error) {
+
+	rRts = this.run(func() (rRts error) {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("SITE CHMOD %04o %s", _Mode_X.Perm(), _Path_S), 200)
+		return
+	})
 	return
 }
 
 //Send a ftp command '_FtpCommand_S' and wait for ftp answer. Success when '_ExpectedReplyCode_i' is detected.
 //Returns error code, reply message and error object
 func (this *FtpsClient) SendFtpCtrlCommand(_FtpCommand_S string, _ExpectedReplyCode_i int) (rReplyCode_i int, rReplyMessage_S string, rRts error) {
-	rReplyCode_i, rReplyMessage_S, rRts = this.sendRequestToFtpServer(_FtpCommand_S, _ExpectedReplyCode_i)
+	rRts = this.lock()
+	if rRts == nil {
+		rReplyCode_i, rReplyMessage_S, rRts = this.sendRequestToFtpServer(_FtpCommand_S, _ExpectedReplyCode_i)
+		this.unlock()
+	}
 	return
 }
 
-//Open ftp data channel based on '_FtpCommand_S' command and wait for ftp answer. Success when '_ExpectedReplyCode_i' is detected
+//Open ftp data channel based on '_FtpCommand_S' command and wait for ftp answer. Success when '_ExpectedReplyCode_i' is detected.
+//The calling goroutine owns the client until CloseFtpDataChannel is called
 //Returns error code, reply message and error object
 func (this *FtpsClient) OpenFtpDataChannel(_FtpCommand_S string, _ExpectedReplyCode_i int) (rReplyCode_i int, rReplyMessage_S string, rRts error) {
-	rRts = this.sendRequestToFtpServerDataConn(_FtpCommand_S, _ExpectedReplyCode_i)
+	rRts = this.lock()
+	if rRts == nil {
+		rRts = this.sendRequestToFtpServerDataConn(_FtpCommand_S, _ExpectedReplyCode_i)
+		if rRts == nil {
+			this.dataChannelOwned_B = true
+		} else {
+			this.unlock()
+		}
+	}
 	return
 }
 
-//Read data stream from ftp data channel
+//Read data stream from ftp data channel opened by OpenFtpDataChannel (ErrInvalidParameter if it is not open)
 //Returns wait and io duration, number of byte read and error object
 func (this *FtpsClient) ReadFtpDataChannel(_ExitAfterFirstRead_B bool, _DataArray_U8 []uint8) (rWaitDuration_S64 time.Duration, rIoDuration_S64 time.Duration, rNbRead_i int, rRts error) {
 	var NbRead_i int
@@ -274,7 +541,10 @@ func (this *FtpsClient) ReadFtpDataChannel(_ExitAfterFirstRead_B bool, _DataArra
 	StartWaitTime_X = time.Now()
 	NbMaxToRead_i := len(_DataArray_U8)
 	rNbRead_i = 0
-	rRts = this.dataConnection_I.SetDeadline(time.Now().Add(time.Duration(this.FtpsParam_X.DataTimeout_S64) * time.Millisecond))
+	rRts = ErrInvalidParameter
+	if this.dataChannelOwned_B {
+		rRts = this.dataConnection_I.SetDeadline(time.Now().Add(time.Duration(this.FtpsParam_X.DataTimeout_S64) * time.Millisecond))
+	}
 	//	fmt.Printf("now %v to %v\n", time.Now(), time.Now().Add(this.FtpsParam_X.DataTimeout_S64))
 
 	if rRts == nil {
@@ -302,8 +572,12 @@ func (this *FtpsClient) ReadFtpDataChannel(_ExitAfterFirstRead_B bool, _DataArra
 			} else {
 
 				if rRts == io.EOF {
-					//					time.Sleep(time.Millisecond * 100)
-					//					fmt.Printf("EOF->cont\n")
+					//The remote side has closed the data channel: return what has been read so far
+					if rNbRead_i != 0 {
+						rRts = nil
+						rIoDuration_S64 = time.Now().Sub(StartIoTime_X)
+					}
+					break
 				} else {
 					//				fmt.Printf("%v %d/%d err1 %s\n", time.Now(), rNbRead_i, NbMaxToRead_i, rRts.Error())
 					break
@@ -317,14 +591,32 @@ func (this *FtpsClient) ReadFtpDataChannel(_ExitAfterFirstRead_B bool, _DataArra
 	return
 }
 
-//Close ftp data channel
+//Close ftp data channel opened by OpenFtpDataChannel and release the client. ErrInvalidParameter is returned if
+//no data channel has been opened by OpenFtpDataChannel or if it has already been closed
 //Returns error code, reply message and error object
 func (this *FtpsClient) CloseFtpDataChannel() (rReplyCode_i int, rReplyMessage_S string, rRts error) {
+	if this.dataChannelOwned_B {
+		rReplyCode_i, rReplyMessage_S, rRts = this.closeFtpDataChannel()
+		this.dataChannelOwned_B = false
+		this.unlock()
+	} else {
+		rRts = ErrInvalidParameter
+	}
+	return
+}
+
+//Close ftp data channel and wait for the transfer status
+//Returns error code, reply message and error object
+func (this *FtpsClient) closeFtpDataChannel() (rReplyCode_i int, rReplyMessage_S string, rRts error) {
 	rReplyMessage_S = ""
 	rReplyCode_i = 0
 	rRts = this.dataConnection_I.Close()
+	this.dataConnection_I = nil
 	if rRts == nil {
-		rReplyCode_i, rReplyMessage_S, rRts = this.readFtpServerResponse(226)
+		rReplyCode_i, rReplyMessage_S, rRts = this.readTransferResponse(226)
+		if rRts != nil {
+			rRts = newFtpsError(FTPPHASE_TRANSFER, this.lastRequest_S, 226, rReplyCode_i, rReplyMessage_S, rRts)
+		}
 	}
 	return
 }
@@ -332,72 +624,221 @@ func (this *FtpsClient) CloseFtpDataChannel() (rReplyCode_i int, rReplyMessage_S
 //Execute the Ftp 'LIST' command
 //Returns the list of file object present on the ftp server and error object
 func (this *FtpsClient) List() (rDirEntryArray_X []DirEntry, rRts error) {
+	rDirEntryArray_X, rRts = this.ListDirectory("")
+	return
+}
+
+//Execute the Ftp 'LIST' command on the remote directory '_Path_S' (current working ftp directory if empty).
+//Lines which can't be parsed (such as the 'total' header of some servers) are skipped
+//Returns the list of file object present in the directory and error object
+func (this *FtpsClient) ListDirectory(_Path_S string) (rDirEntryArray_X []DirEntry, rRts error) {
+	if _Path_S == "" {
+		rDirEntryArray_X, rRts = this.readDirEntryList("LIST -a", this.parseEntryLine)
+	} else {
+		rDirEntryArray_X, rRts = this.readDirEntryList(fmt.Sprintf("LIST -a %s", _Path_S), this.parseEntryLine)
+	}
+	return
+}
+
+//Execute the Ftp 'MLSD' command on the remote directory '_Path_S' (current working ftp directory if empty).
+//The current and parent directory entries are skipped
+//Returns the list of file object present in the directory and error object
+func (this *FtpsClient) MachineListDirectory(_Path_S string) (rDirEntryArray_X []DirEntry, rRts error) {
+	if _Path_S == "" {
+		rDirEntryArray_X, rRts = this.readDirEntryList("MLSD", this.parseMachineListLine)
+	} else {
+		rDirEntryArray_X, rRts = this.readDirEntryList(fmt.Sprintf("MLSD %s", _Path_S), this.parseMachineListLine)
+	}
+	return
+}
+
+//Execute the Ftp 'MLST' command on the remote path '_Path_S' (current working ftp directory if empty).
+//A current or parent directory entry ('type=cdir' or 'type=pdir') is returned as a folder
+//Returns the file object describing '_Path_S' and error object
+func (this *FtpsClient) MachineListEntry(_Path_S string) (rDirEntryPtr_X *DirEntry, rRts error) {
+	var ReplyMessage_S string
+
+	rDirEntryPtr_X = nil
+	rRts = this.run(func() (rRts error) {
+		if _Path_S == "" {
+			_, ReplyMessage_S, rRts = this.sendRequestToFtpServer("MLST", 250)
+		} else {
+			_, ReplyMessage_S, rRts = this.sendRequestToFtpServer(fmt.Sprintf("MLST %s", _Path_S), 250)
+		}
+		return
+	})
+	if rRts == nil {
+		rRts = ErrLineFormat
+		//The facts line is the only one of the multi-line reply which starts with a space
+		for _, Line_S := range strings.Split(ReplyMessage_S, "\n") {
+			if strings.HasPrefix(Line_S, " ") {
+				rDirEntryPtr_X, rRts = this.parseMachineEntryLine(Line_S[1:], false)
+				break
+			}
+		}
+	}
+	return
+}
+
+//Execute the Ftp 'SIZE' command on the remote file '_Path_S'
+//Returns the file size in bytes and error object
+func (this *FtpsClient) GetFileSize(_Path_S string) (rSize_U64 uint64, rRts error) {
+	rSize_U64 = 0
+	rRts = this.run(func() (rRts error) {
+		rSize_U64, rRts = this.getFileSize(_Path_S)
+		return
+	})
+	return
+}
+
+//Send a single 'SIZE' command for the remote file '_Path_S'
+//Returns the file size in bytes and error object
+func (this *FtpsClient) getFileSize(_Path_S string) (rSize_U64 uint64, rRts error) {
+	var ReplyMessage_S string
+
+	rSize_U64 = 0
+	_, ReplyMessage_S, rRts = this.sendRequestToFtpServer(fmt.Sprintf("SIZE %s", _Path_S), 213)
+	if rRts == nil {
+		rSize_U64, rRts = strconv.ParseUint(strings.TrimSpace(ReplyMessage_S), 10, 64)
+	}
+	return
+}
+
+//Execute the Ftp 'MDTM' command on the remote file '_Path_S'
+//Returns the last modification time (UTC) of the file and error object
+func (this *FtpsClient) GetModificationTime(_Path_S string) (rTime_X time.Time, rRts error) {
+	var ReplyMessage_S string
+
+	rRts = this.run(func() (rRts error) {
+		_, ReplyMessage_S, rRts = this.sendRequestToFtpServer(fmt.Sprintf("MDTM %s", _Path_S), 213)
+		return
+	})
+	if rRts == nil {
+		rTime_X, rRts = parseMachineTime(strings.TrimSpace(ReplyMessage_S))
+	}
+	return
+}
+
+//Send the data channel command '_Request_S' and parse each line received with '_ParseLine'.
+//Lines which can't be parsed are skipped
+//Returns the list of file object parsed and error object
+func (this *FtpsClient) readDirEntryList(_Request_S string, _ParseLine func(string) (*DirEntry, error)) (rDirEntryArray_X []DirEntry, rRts error) {
 	var DirEntryPtr_X *DirEntry
 	var Line_S string
-	rDirEntryArray_X = nil
-	rRts = this.sendRequestToFtpServerDataConn("LIST -a", 150)
-	if rRts == nil {
-		pReader_O := bufio.NewReader(this.dataConnection_I)
-		if pReader_O != nil {
+	var Sts error
+
+	rRts = this.run(func() (rRts error) {
+		rDirEntryArray_X = nil
+		rRts = this.sendRequestToFtpServerDataConn(_Request_S, 150)
+		if rRts == nil {
+			pReader_O := bufio.NewReader(this.dataConnection_I)
 			for {
 				Line_S, rRts = pReader_O.ReadString('\n')
-				if rRts == nil {
-					//if rRts == io.EOF {				break			}
+				if (rRts == nil) || ((rRts == io.EOF) && (Line_S != "")) {
 					//					this.debugInfo("[LIST] " + Line_S)
-					DirEntryPtr_X, rRts = this.parseEntryLine(Line_S)
-					rDirEntryArray_X = append(rDirEntryArray_X, *DirEntryPtr_X)
-				} else {
+					DirEntryPtr_X, Sts = _ParseLine(Line_S)
+					if Sts == nil {
+						rDirEntryArray_X = append(rDirEntryArray_X, *DirEntryPtr_X)
+					}
+				}
+				if rRts != nil {
+					if rRts == io.EOF {
+						rRts = nil
+					}
 					break
 				}
 			}
+			if rRts == nil {
+				_, _, rRts = this.closeFtpDataChannel()
+			} else {
+				this.closeFtpDataChannel()
+			}
 		}
-		_, _, rRts = this.CloseFtpDataChannel()
-	}
-
+		return
+	})
 	return
 }
 
-//Store the '_DataArray_U8' as a file called '_RemoteFilepath_S' on the ftp remote ftp server
+//Store the '_DataArray_U8' as a file called '_RemoteFilepath_S' on the ftp remote ftp server. When the transfer is
+//retried, it is resumed (REST) from the size of the partially stored file
 //Returns error object
 func (this *FtpsClient) StoreFile(_RemoteFilepath_S string, _DataArray_U8 []byte) (rRts error) {
-	var Count_i int
-
-	rRts = this.sendRequestToFtpServerDataConn(fmt.Sprintf("STOR %s", _RemoteFilepath_S), 150)
-	if rRts == nil {
-		Count_i, rRts = this.dataConnection_I.Write(_DataArray_U8)
-		if rRts == nil {
-			if len(_DataArray_U8) != Count_i {
-				rRts = ErrIoError
+	var Count_i, Attempt_i int
+	var Offset_U64 uint64
+
+	Attempt_i = 0
+	rRts = this.run(func() (rRts error) {
+		Offset_U64 = 0
+		Attempt_i++
+		if Attempt_i > 1 {
+			if Size_U64, Sts := this.getFileSize(_RemoteFilepath_S); (Sts == nil) && (Size_U64 <= uint64(len(_DataArray_U8))) {
+				Offset_U64 = Size_U64
 			}
 		}
-
+		Offset_U64, rRts = this.sendRequestToFtpServerDataConnAt(fmt.Sprintf("STOR %s", _RemoteFilepath_S), 150, Offset_U64)
 		if rRts == nil {
-			_, _, rRts = this.CloseFtpDataChannel()
-		} else {
-			this.CloseFtpDataChannel()
-		}
+			this.setTransferTotal(uint64(len(_DataArray_U8)))
+			Count_i, rRts = this.dataConnection_I.Write(_DataArray_U8[Offset_U64:])
+			if rRts == nil {
+				if len(_DataArray_U8[Offset_U64:]) != Count_i {
+					rRts = ErrIoError
+				}
+			}
 
-	}
+			if rRts == nil {
+				_, _, rRts = this.closeFtpDataChannel()
+			} else {
+				this.closeFtpDataChannel()
+			}
+
+		}
+		return
+	})
 	return
 }
 
-//Read the file called '_RemoteFilepath_S' on the ftp remote ftp server and store its contents in local file '_RemoteFilepath_S'
+//Read the file called '_RemoteFilepath_S' on the ftp remote ftp server and store its contents in local file '_RemoteFilepath_S'.
+//When the transfer is retried, it is resumed (REST) from the size of the partially retrieved file
 //Returns error object
 func (this *FtpsClient) RetrieveFile(_RemoteFilepath_S, _LocalFilepath_S string) (rRts error) {
 	var pFile_X *os.File
+	var Offset_i64 int64
+	var Offset_U64 uint64
 
-	rRts = this.sendRequestToFtpServerDataConn(fmt.Sprintf("RETR %s", _RemoteFilepath_S), 150)
-	if rRts == nil {
-		pFile_X, rRts = os.Create(_LocalFilepath_S)
-		if rRts == nil {
-			_, rRts = io.Copy(pFile_X, this.dataConnection_I)
-			pFile_X.Close()
+	rRts = this.run(func() (rRts error) {
+		Offset_U64 = 0
+		if pFile_X != nil {
+			Offset_i64, rRts = pFile_X.Seek(0, io.SeekEnd)
+			if rRts != nil {
+				return
+			}
+			Offset_U64 = uint64(Offset_i64)
 		}
+		Offset_U64, rRts = this.sendRequestToFtpServerDataConnAt(fmt.Sprintf("RETR %s", _RemoteFilepath_S), 150, Offset_U64)
 		if rRts == nil {
-			_, _, rRts = this.CloseFtpDataChannel()
-		} else {
-			this.CloseFtpDataChannel()
+			if pFile_X == nil {
+				pFile_X, rRts = os.Create(_LocalFilepath_S)
+			}
+			if rRts == nil {
+				//The server may not support the restart
+				rRts = pFile_X.Truncate(int64(Offset_U64))
+				if rRts == nil {
+					_, rRts = pFile_X.Seek(int64(Offset_U64), io.SeekStart)
+					if rRts == nil {
+						_, rRts = io.Copy(pFile_X, this.dataConnection_I)
+					}
+				}
+			}
+			if rRts == nil {
+				_, _, rRts = this.closeFtpDataChannel()
+			} else {
+				this.closeFtpDataChannel()
+			}
 		}
+		return
+	})
+	if pFile_X != nil {
+		pFile_X.Close()
 	}
 	return
 }
@@ -405,9 +846,18 @@ func (this *FtpsClient) RetrieveFile(_RemoteFilepath_S, _LocalFilepath_S string)
 //Disconnect from remote ftp server
 //Returns error object
 func (this *FtpsClient) Disconnect() (rRts error) {
-	_, _, rRts = this.sendRequestToFtpServer("QUIT", 221)
+	rRts = this.lock()
 	if rRts == nil {
-		rRts = this.ctrlConnection_I.Close()
+		this.stopKeepAlive()
+		_, _, rRts = this.sendRequestToFtpServer("QUIT", 221)
+		if rRts == nil {
+			Address_S := this.ctrlConnection_I.RemoteAddr().String()
+			rRts = this.ctrlConnection_I.Close()
+			this.ctrlConnection_I = nil
+			this.workingDirectory_S = ""
+			this.emit(Event{Type_E: EVENTTYPE_DISCONNECTED, Address_S: Address_S, Err: rRts})
+		}
+		this.unlock()
 	}
 	return
 }
@@ -424,15 +874,56 @@ func (this *FtpsClient) isConnEstablished() (rRts error) {
 	return
 }
 
-//Oepn a ftd data connection over the '_Port_i' ip port
+//Wait for the exclusive use of the client: the control and data channels are used by a single operation at a time
+//Returns error object (ErrBusy if the client is still used by another goroutine after LockTimeout_S64)
+func (this *FtpsClient) lock() (rRts error) {
+	rRts = nil
+	if this.FtpsParam_X.LockTimeout_S64 == 0 {
+		this.operationChan_X <- true
+	} else {
+		Timer_X := time.NewTimer(this.FtpsParam_X.LockTimeout_S64 * time.Millisecond)
+		select {
+		case this.operationChan_X <- true:
+		case <-Timer_X.C:
+			rRts = ErrBusy
+		}
+		Timer_X.Stop()
+	}
+	return
+}
+
+//Get the exclusive use of the client if it is available
+//Returns true if the client is owned by the caller
+func (this *FtpsClient) tryLock() (rOk_B bool) {
+	select {
+	case this.operationChan_X <- true:
+		rOk_B = true
+	default:
+		rOk_B = false
+	}
+	return
+}
+
+//Release the exclusive use of the client. The level given by SetNextDataProtection is forgotten once an operation
+//has used it
+func (this *FtpsClient) unlock() {
+	if this.nextDataProtectionUsed_B {
+		this.nextDataProtection_B = false
+		this.nextDataProtectionUsed_B = false
+	}
+	<-this.operationChan_X
+}
+
+//Oepn a ftd data connection over the '_Host_S':'_Port_i' ip port
 //Returns error object
-func (this *FtpsClient) openDataConn(_Port_i int) (rRts error) {
+func (this *FtpsClient) openDataConn(_Host_S string, _Port_i int) (rRts error) {
 	var Sts error
 
-	rRts = ErrNotConnected
-	this.dataConnection_I, Sts = net.DialTimeout("tcp4", fmt.Sprintf("%s:%d", this.FtpsParam_X.TargetHost_S, _Port_i), this.FtpsParam_X.ConnectTimeout_S64)
+	this.dataConnection_I, Sts = this.dial(_Host_S, _Port_i)
 	if Sts == nil {
 		rRts = setConBufferSize(this.dataConnection_I, this.FtpsParam_X.DataReadBufferSize_U32, this.FtpsParam_X.DataWriteBufferSize_U32)
+	} else {
+		rRts = withPhase(Sts, FTPPHASE_DATA, ErrNotConnected)
 	}
 	return
 }
@@ -440,19 +931,41 @@ func (this *FtpsClient) openDataConn(_Port_i int) (rRts error) {
 //Send a ftp command '_Request_S' and wait for ftp answer. Success when '_ExpectedReplyCode_i' is detected.
 //Returns error code, reply message and error object
 func (this *FtpsClient) sendRequestToFtpServer(_Request_S string, _ExpectedReplyCode_i int) (rReplyCode_i int, rReplyMessage_S string, rRts error) {
+	this.ctrlMutex_X.Lock()
+	rReplyCode_i, rReplyMessage_S, rRts = this.sendRequestToFtpServerLocked(_Request_S, _ExpectedReplyCode_i)
+	this.ctrlMutex_X.Unlock()
+	return
+}
+
+//Same as sendRequestToFtpServer, the caller must hold ctrlMutex_X
+//Returns error code, reply message and error object
+func (this *FtpsClient) sendRequestToFtpServerLocked(_Request_S string, _ExpectedReplyCode_i int) (rReplyCode_i int, rReplyMessage_S string, rRts error) {
 	rReplyCode_i = 0
 	rReplyMessage_S = ""
 	rRts = this.isConnEstablished()
 	if rRts == nil {
-		this.debugInfo("[FTP CMD] " + _Request_S)
+		Span_I := this.startSpan("ftp.command", this.parentSpan())
+		Span_I.SetAttribute("ftp.command", this.redact(_Request_S))
+		this.debugInfo("command", "command", this.redact(_Request_S))
+		this.lastRequest_S = this.redact(_Request_S)
+		this.requestTime_X = time.Now()
 		rRts = this.ctrlConnection_I.SetDeadline(time.Now().Add(time.Duration(this.FtpsParam_X.CtrlTimeout_S64) * time.Millisecond))
 
 		if rRts == nil {
-			_, rRts = this.textProtocolPtr_X.Cmd(_Request_S)
+			_, rRts = this.textProtocolPtr_X.Cmd("%s", _Request_S)
 			if rRts == nil {
-				rReplyCode_i, rReplyMessage_S, rRts = this.readFtpServerResponse(_ExpectedReplyCode_i)
+				this.emit(Event{Type_E: EVENTTYPE_COMMAND_SENT, Command_S: this.lastRequest_S})
+				rReplyCode_i, rReplyMessage_S, rRts = this.readFtpServerResponseLocked(_ExpectedReplyCode_i)
+				this.emit(Event{Type_E: EVENTTYPE_REPLY_RECEIVED, Command_S: this.lastRequest_S, ReplyCode_i: rReplyCode_i, ReplyMessage_S: rReplyMessage_S, Duration_S64: time.Since(this.requestTime_X), Err: rRts})
 			}
+			this.observeCommand(_Request_S, rReplyCode_i)
+		}
+		if rRts != nil {
+			this.checkConnectionLost(rRts)
+			rRts = newFtpsError(FTPPHASE_COMMAND, this.redact(_Request_S), _ExpectedReplyCode_i, rReplyCode_i, rReplyMessage_S, rRts)
 		}
+		Span_I.SetAttribute("ftp.reply_code", rReplyCode_i)
+		endSpan(Span_I, rRts)
 	}
 	return
 }
@@ -460,6 +973,15 @@ func (this *FtpsClient) sendRequestToFtpServer(_Request_S string, _ExpectedReply
 //Read ftp command answer and wait for ftp answer. Success when '_ExpectedReplyCode_i' is detected.
 //Returns error code, reply message and error object
 func (this *FtpsClient) readFtpServerResponse(_ExpectedReplyCode_i int) (rReplyCode_i int, rResponse_S string, rRts error) {
+	this.ctrlMutex_X.Lock()
+	rReplyCode_i, rResponse_S, rRts = this.readFtpServerResponseLocked(_ExpectedReplyCode_i)
+	this.ctrlMutex_X.Unlock()
+	return
+}
+
+//Same as readFtpServerResponse, the caller must hold ctrlMutex_X
+//Returns error code, reply message and error object
+func (this *FtpsClient) readFtpServerResponseLocked(_ExpectedReplyCode_i int) (rReplyCode_i int, rResponse_S string, rRts error) {
 	rReplyCode_i = 0
 	rResponse_S = ""
 	rRts = this.isConnEstablished()
@@ -467,35 +989,45 @@ func (this *FtpsClient) readFtpServerResponse(_ExpectedReplyCode_i int) (rReplyC
 		rRts = this.ctrlConnection_I.SetDeadline(time.Now().Add(time.Duration(this.FtpsParam_X.CtrlTimeout_S64) * time.Millisecond))
 		if rRts == nil {
 			rReplyCode_i, rResponse_S, rRts = this.textProtocolPtr_X.ReadResponse(_ExpectedReplyCode_i)
-			this.debugInfo(fmt.Sprintf("[FTP REP] %d/%d (%s)", rReplyCode_i, _ExpectedReplyCode_i, rResponse_S))
+			this.lastActivity_X = time.Now()
+			this.debugInfo("reply", "code", rReplyCode_i, "expected", _ExpectedReplyCode_i, "message", rResponse_S, "duration", this.lastActivity_X.Sub(this.requestTime_X))
 		}
+		this.checkConnectionLost(rRts)
 	}
 	return
 }
 
 //Setup a ftp data connection in passive mode
-//Return connected remote ftp data port and error object
-func (this *FtpsClient) preparePasvConnection() (rPort_i int, rRts error) {
+//Return host selected by the PasvPolicy_E, connected remote ftp data port and error object
+func (this *FtpsClient) preparePasvConnection() (rHost_S string, rPort_i int, rRts error) {
 	var ReplyMessage_S string
-	var PortPart1_i, PortPart2_i int
 
+	rHost_S = ""
 	rPort_i = 0
 	_, ReplyMessage_S, rRts = this.sendRequestToFtpServer("PASV", 227)
 	if rRts == nil {
 		StartPos_i := strings.Index(ReplyMessage_S, "(")
 		EndPos_i := strings.LastIndex(ReplyMessage_S, ")")
 
-		if StartPos_i == -1 || EndPos_i == -1 {
-			rRts = ErrPasv
-		} else {
+		rRts = withPhase(newFtpsError(FTPPHASE_DATA, "PASV", 227, 227, ReplyMessage_S, nil), FTPPHASE_DATA, ErrPasv)
+		if (StartPos_i != -1) && (EndPos_i > StartPos_i) {
+			//h1,h2,h3,h4,p1,p2
 			pPasvData_S := strings.Split(ReplyMessage_S[StartPos_i+1:EndPos_i], ",")
-
-			PortPart1_i, rRts = strconv.Atoi(pPasvData_S[4])
-			if rRts == nil {
-				PortPart2_i, rRts = strconv.Atoi(pPasvData_S[5])
-				if rRts == nil {
+			if len(pPasvData_S) == 6 {
+				for i := range pPasvData_S {
+					pPasvData_S[i] = strings.TrimSpace(pPasvData_S[i])
+				}
+				PortPart1_i, Sts1 := strconv.Atoi(pPasvData_S[4])
+				PortPart2_i, Sts2 := strconv.Atoi(pPasvData_S[5])
+				//The address is not used with PASVPOLICY_CONTROL_HOST: an unparsable one is accepted
+				Advertised_X := net.ParseIP(strings.Join(pPasvData_S[:4], ".")).To4()
+				if (Sts1 == nil) && (Sts2 == nil) && (PortPart1_i >= 0) && (PortPart1_i <= 255) && (PortPart2_i >= 0) && (PortPart2_i <= 255) && ((Advertised_X != nil) || (this.FtpsParam_X.PasvPolicy_E == PASVPOLICY_CONTROL_HOST)) {
 					// Recompose port
-					rPort_i = int(PortPart1_i)*256 + int(PortPart2_i)
+					rPort_i = PortPart1_i*256 + PortPart2_i
+					if rPort_i != 0 {
+						rHost_S = this.selectPasvHost(Advertised_X)
+						rRts = nil
+					}
 				}
 			}
 		}
@@ -506,41 +1038,133 @@ func (this *FtpsClient) preparePasvConnection() (rPort_i int, rRts error) {
 //Send a ftp command '_Request_S' and opens its corresponding ftp data channel. Success when '_ExpectedReplyCode_i' is detected.
 //Return error object
 func (this *FtpsClient) sendRequestToFtpServerDataConn(_Request_S string, _ExpectedReplyCode_i int) (rRts error) {
-	var Port_i int
+	_, rRts = this.sendRequestToFtpServerDataConnAt(_Request_S, _ExpectedReplyCode_i, 0)
+	return
+}
 
-	Port_i, rRts = this.preparePasvConnection()
-	if rRts == nil {
-		rRts = this.openDataConn(Port_i)
-		if rRts == nil {
-			_, _, rRts = this.sendRequestToFtpServer(_Request_S, _ExpectedReplyCode_i)
-			if rRts != nil {
-				this.dataConnection_I.Close()
-				this.dataConnection_I = nil
-			} else {
-				if this.FtpsParam_X.SecureFtp_B {
+//Send a ftp command '_Request_S' preceded by a 'REST _Offset_U64' command if '_Offset_U64' is not 0 and opens its
+//corresponding ftp data channel. Success when '_ExpectedReplyCode_i' is detected. If the server refuses the restart,
+//the transfer starts from the beginning of the file
+//Return the offset of the transfer and error object
+func (this *FtpsClient) sendRequestToFtpServerDataConnAt(_Request_S string, _ExpectedReplyCode_i int, _Offset_U64 uint64) (rOffset_U64 uint64, rRts error) {
+	var Host_S string
+	var Port_i int
+	var ReplyMessage_S string
 
-					this.dataConnection_I = this.upgradeConnectionToTLS(this.dataConnection_I)
+	rOffset_U64 = 0
+	this.transferSpan_I = this.startSpan("ftp.transfer", nil)
+	this.transferSpan_I.SetAttribute("ftp.command", this.redact(_Request_S))
+	this.startTransferEvent(_Request_S)
+	rRts = this.applyDataProtection(this.transferDataProtection())
+	if rRts != nil {
+		rRts = withPhase(rRts, FTPPHASE_TLS, ErrSecure)
+	} else {
+		Span_I := this.startSpan("ftp.data.open", this.transferSpan_I)
+		Host_S, Port_i, rRts = this.preparePasvConnection()
+		if rRts != nil {
+			rRts = withPhase(rRts, FTPPHASE_DATA, nil)
+			endSpan(Span_I, rRts)
+		} else {
+			Span_I.SetAttribute("server.port", Port_i)
+			rRts = this.openDataConn(Host_S, Port_i)
+			endSpan(Span_I, rRts)
+			if rRts == nil {
+				this.emit(Event{Type_E: EVENTTYPE_DATA_OPENED, Address_S: this.dataConnection_I.RemoteAddr().String(), Command_S: this.redact(_Request_S)})
+			}
+			if (rRts == nil) && (_Offset_U64 != 0) {
+				_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("REST %d", _Offset_U64), 350)
+				if rRts == nil {
+					rOffset_U64 = _Offset_U64
+				} else if IsPermanent(rRts) {
+					rRts = nil
+				} else {
+					this.dataConnection_I.Close()
+					this.dataConnection_I = nil
 				}
 			}
+			if rRts == nil {
+				_, ReplyMessage_S, rRts = this.sendRequestToFtpServer(_Request_S, _ExpectedReplyCode_i)
+				if rRts != nil {
+					this.dataConnection_I.Close()
+					this.dataConnection_I = nil
+				} else {
+					if this.isDataProtected() {
+						this.dataConnection_I, rRts = this.upgradeConnectionToTLS(this.dataConnection_I, time.Duration(this.FtpsParam_X.DataTimeout_S64)*time.Millisecond)
+						if rRts != nil {
+							//Drop the data channel and consume the transfer status to keep the control channel in sync
+							rRts = withPhase(newFtpsError(FTPPHASE_TLS, _Request_S, 0, 0, "", rRts), FTPPHASE_TLS, ErrSecure)
+							this.dataConnection_I.Close()
+							this.dataConnection_I = nil
+							this.endTransferSpan(rRts)
+							this.endTransferEvent(0, "", rRts)
+							this.readTransferResponse(0)
+						} else {
+							setTlsVersion(this.transferSpan_I, this.dataConnection_I)
+							this.emitTlsUpgraded(this.dataConnection_I, true)
+						}
+					}
+					if rRts == nil {
+						this.dataConnection_I = this.newEventDataConn(this.newTraceDataConn(this.newLimitedConn(this.newMetricsDataConn(this.newTranscriptDataConn(this.dataConnection_I, _Request_S), _Request_S))))
+						if this.FtpsParam_X.OnProgress != nil {
+							this.dataConnection_I = this.newProgressConn(this.dataConnection_I, _Request_S, rOffset_U64, parseTransferSize(ReplyMessage_S))
+						}
+						this.ctrlMutex_X.Lock()
+						this.transferInProgress_B = true
+						this.ctrlMutex_X.Unlock()
+					}
+				}
 
+			}
 		}
 	}
-
+	if rRts != nil {
+		this.endTransferSpan(rRts)
+		this.endTransferEvent(0, "", rRts)
+	}
 	return
 }
 
-//Turn a non secure ftp connection '_Connection_I' into a secore TLS ftp connection
-//Returns the secured ftp connection
-func (pFtpsClient_X *FtpsClient) upgradeConnectionToTLS(_Connection_I net.Conn) (rUpgradedConnection net.Conn) {
+//Turn a non secure ftp connection '_Connection_I' into a secore TLS ftp connection. The TLS handshake must be
+//completed within '_Timeout_S64'
+//Returns the secured ftp connection and error object
+func (pFtpsClient_X *FtpsClient) upgradeConnectionToTLS(_Connection_I net.Conn, _Timeout_S64 time.Duration) (rUpgradedConnection net.Conn, rRts error) {
 
 	var TlsConnectionPtr_X *tls.Conn
-	TlsConnectionPtr_X = tls.Client(_Connection_I, &pFtpsClient_X.FtpsParam_X.TlsConfig_X)
+	TlsConnectionPtr_X = tls.Client(_Connection_I, pFtpsClient_X.tlsConfigPtr_X)
 
-	TlsConnectionPtr_X.Handshake()
+	rRts = TlsConnectionPtr_X.SetDeadline(time.Now().Add(_Timeout_S64))
+	if rRts == nil {
+		rRts = TlsConnectionPtr_X.Handshake()
+		if rRts == nil {
+			rRts = TlsConnectionPtr_X.SetDeadline(time.Time{})
+		}
+	}
 	rUpgradedConnection = net.Conn(TlsConnectionPtr_X)
+	return
+}
 
-	// TODO verify that TLS connection is established
-
+//Shut down the TLS layer of the connection '_Connection_I' with a close_notify exchange (after a CCC command) which
+//must be completed within '_Timeout_S64'
+//Returns the underlying clear connection and error object
+func (this *FtpsClient) downgradeConnectionFromTLS(_Connection_I net.Conn, _Timeout_S64 time.Duration) (rConnection_I net.Conn, rRts error) {
+	rConnection_I = _Connection_I
+	TlsConnectionPtr_X, Ok_B := _Connection_I.(*tls.Conn)
+	if !Ok_B {
+		rRts = ErrSecure
+	} else {
+		rRts = TlsConnectionPtr_X.SetDeadline(time.Now().Add(_Timeout_S64))
+		if rRts == nil {
+			rRts = TlsConnectionPtr_X.CloseWrite()
+			if rRts == nil {
+				//Wait for the close_notify of the server
+				_, rRts = io.Copy(io.Discard, TlsConnectionPtr_X)
+				if rRts == nil {
+					rConnection_I = TlsConnectionPtr_X.NetConn()
+					rRts = rConnection_I.SetDeadline(time.Time{})
+				}
+			}
+		}
+	}
 	return
 }
 
@@ -608,8 +1232,10 @@ func (this *FtpsClient) parseEntryLine(_Line_S string) (rDirEntryPtr_X *DirEntry
 					if strings.Contains(FieldArray_S[7], ":") { // this year
 						Year_i, _, _ := time.Now().Date()
 						Time_S = fmt.Sprintf("%s %s %s %s GMT", FieldArray_S[6], FieldArray_S[5], strconv.Itoa(Year_i)[2:4], FieldArray_S[7])
-					} else { // not this year
+					} else if len(FieldArray_S[7]) == 4 { // not this year
 						Time_S = fmt.Sprintf("%s %s %s 00:00 GMT", FieldArray_S[6], FieldArray_S[5], FieldArray_S[7][2:4])
+					} else { // truncated year: rejected by time.Parse
+						Time_S = ""
 					}
 					Time_X, rRts = time.Parse("_2 Jan 06 15:04 MST", Time_S)
 					if rRts != nil {
@@ -618,24 +1244,109 @@ func (this *FtpsClient) parseEntryLine(_Line_S string) (rDirEntryPtr_X *DirEntry
 						rDirEntryPtr_X.Time_X = Time_X // TODO set timezone
 
 						// parse name
-						rDirEntryPtr_X.Name_S = strings.TrimRight(FieldArray_S[8], "\r\n")
-						SepIndex_i := strings.LastIndex(rDirEntryPtr_X.Name_S, ".")
-						if SepIndex_i >= 0 {
-							rDirEntryPtr_X.Ext_S = rDirEntryPtr_X.Name_S[SepIndex_i+1:]
-							rDirEntryPtr_X.Name_S = rDirEntryPtr_X.Name_S[:SepIndex_i]
+						Name_S := strings.TrimRight(FieldArray_S[8], "\r\n")
+						if Name_S == "" {
+							rRts = ErrLineFormat
+							rDirEntryPtr_X = nil
+						} else {
+							rDirEntryPtr_X.setFullName(Name_S)
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+//Parse a ftp MLSD entry _Line_S
+//Return file parsing result and error object (ErrDirEntry for current and parent directory entries)
+func (this *FtpsClient) parseMachineListLine(_Line_S string) (rDirEntryPtr_X *DirEntry, rRts error) {
+	rDirEntryPtr_X, rRts = this.parseMachineEntryLine(_Line_S, true)
+	return
+}
+
+//Parse a ftp MLSD/MLST entry _Line_S such as 'type=file;size=16865;modify=20141026154900; test2.l'. The current
+//and parent directory entries are rejected if _Listing_B is true (MLSD) and returned as folders otherwise (MLST)
+//Return file parsing result and error object (ErrDirEntry for rejected entries)
+func (this *FtpsClient) parseMachineEntryLine(_Line_S string, _Listing_B bool) (rDirEntryPtr_X *DirEntry, rRts error) {
+	var Size_U64 uint64
+	var Time_X time.Time
+
+	rDirEntryPtr_X = nil
+	rRts = ErrLineFormat
+	_Line_S = strings.TrimRight(_Line_S, "\r\n")
+	//Facts can't contain space, the name starts after the first one
+	SepIndex_i := strings.Index(_Line_S, " ")
+	if SepIndex_i > 0 {
+		DirEntry_X := DirEntry{Type_E: DIRENTRYTYPE_FILE}
+		DirEntry_X.setFullName(path.Base(_Line_S[SepIndex_i+1:]))
+		rRts = nil
+		for _, Fact_S := range strings.Split(_Line_S[:SepIndex_i], ";") {
+			FactName_S, FactValue_S, Ok_B := strings.Cut(Fact_S, "=")
+			if Ok_B {
+				switch strings.ToLower(FactName_S) {
+				case "type":
+					switch strings.ToLower(FactValue_S) {
+					case "file":
+						DirEntry_X.Type_E = DIRENTRYTYPE_FILE
+					case "dir":
+						DirEntry_X.Type_E = DIRENTRYTYPE_FOLDER
+					case "cdir", "pdir":
+						if _Listing_B {
+							rRts = ErrDirEntry
+						} else {
+							DirEntry_X.Type_E = DIRENTRYTYPE_FOLDER
+						}
+					default:
+						if strings.Contains(strings.ToLower(FactValue_S), "link") {
+							DirEntry_X.Type_E = DIRENTRYTYPE_LINK
+						} else {
+							rRts = ErrDirEntry
 						}
 					}
+				case "size":
+					Size_U64, rRts = strconv.ParseUint(FactValue_S, 10, 64)
+					DirEntry_X.Size_U64 = Size_U64
+				case "modify":
+					Time_X, rRts = parseMachineTime(FactValue_S)
+					DirEntry_X.Time_X = Time_X
 				}
 			}
+			if rRts != nil {
+				break
+			}
+		}
+		if rRts == nil {
+			rDirEntryPtr_X = &DirEntry_X
 		}
 	}
 	return
 }
 
-//Output debug info in log channel
-func (this *FtpsClient) debugInfo(_Message_S string) {
+//Parse a MLSD/MDTM time value _Time_S such as '20141026154900' or '20141026154900.123'
+//Return UTC time and error object
+func parseMachineTime(_Time_S string) (rTime_X time.Time, rRts error) {
+	rRts = ErrLineFormat
+	if len(_Time_S) >= 14 {
+		rTime_X, rRts = time.Parse("20060102150405", _Time_S[:14])
+	}
+	return
+}
 
-	if this.FtpsParam_X.Debug_B {
-		log.Println(_Message_S)
+//Output the debug message '_Message_S' with the key/value pairs '_FieldArray_X' to the logger
+func (this *FtpsClient) debugInfo(_Message_S string, _FieldArray_X ...any) {
+	if this.loggerPtr_X != nil {
+		this.loggerPtr_X.Debug(_Message_S, _FieldArray_X...)
+	}
+}
+
+//Log the warning '_Message_S' with the key/value pairs of '_FieldArray_X' to the logger of the client or to the
+//default slog logger
+func (this *FtpsClient) warn(_Message_S string, _FieldArray_X ...any) {
+	if this.loggerPtr_X != nil {
+		this.loggerPtr_X.Warn(_Message_S, _FieldArray_X...)
+	} else {
+		slog.Warn(_Message_S, append([]any{"id", this.FtpsParam_X.Id_U32}, _FieldArray_X...)...)
 	}
 }
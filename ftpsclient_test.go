@@ -4,9 +4,10 @@
 
 /*
 	This module implements the 'ftpsclient' package unit test.
-	To run theses test please install Filezilla Ftp server (https://filezilla-project.org/download.php?type=server)
-	and create a ftp server config with a user name 'mc' with pasword 'a'. The ftp server should exposes a 'Seq'
-	directory.
+	These tests run against the in-memory ftp server of the 'ftpstest' package which is started
+	with a user name 'mc' with pasword 'a' and exposes a 'Seq' directory. The suite is run twice:
+	in plain ftp and in explicit ftps (AUTH TLS) mode. The other suites of the package use the same
+	server and build their client parameters with newTestParam.
 
 	These unit tests use the 'gocheck' golang test package (https://labix.org/gocheck)
 
@@ -14,11 +15,14 @@
 package ftpsclient
 
 import (
+	"crypto/tls"
 	//"fmt"
+	"github.com/onbings/ftpsclient/ftpstest"
 	. "gopkg.in/check.v1"
 	"io/ioutil"
 	//"time"
 	//"log"
+	"sync"
 	"testing"
 )
 
@@ -27,9 +31,13 @@ import (
 // Hook up gocheck into the "go test" runner.
 func Test(t *testing.T) { TestingT(t) }
 
-type FtpClientTestSuite struct{}
+type FtpClientTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	secureFtp_B     bool
+}
 
-var _ = Suite(&FtpClientTestSuite{})
+var _ = Suite(&FtpClientTestSuite{secureFtp_B: false})
+var _ = Suite(&FtpClientTestSuite{secureFtp_B: true})
 
 //-- GoCheck specific initialization --------------------------------------
 const (
@@ -42,27 +50,48 @@ var (
 	GL_FtpsClientPtr_X *FtpsClient
 )
 
+//Address of a test server (ftpstest.Server, ftpstest.ReplayServer)
+type testServer interface {
+	Host() string
+	Port() uint16
+}
+
+//Returns the parameters of a client logging in as 'mc' into the '/Seq' directory of '_Server_I' with 2s connect and
+//1s control and data timeouts. The server certificate is not verified in secure mode
+func newTestParam(_Server_I testServer) (rFtpsClientParam_X FtpsClientParam) {
+	rFtpsClientParam_X.LoginName_S = "mc"
+	rFtpsClientParam_X.LoginPassword_S = "a"
+	rFtpsClientParam_X.InitialDirectory_S = "/Seq"
+	rFtpsClientParam_X.TlsConfigPtr_X = &tls.Config{InsecureSkipVerify: true}
+	rFtpsClientParam_X.TargetHost_S = _Server_I.Host()
+	rFtpsClientParam_X.TargetPort_U16 = _Server_I.Port()
+	rFtpsClientParam_X.ConnectTimeout_S64 = 2000
+	rFtpsClientParam_X.CtrlTimeout_S64 = 1000
+	rFtpsClientParam_X.DataTimeout_S64 = 1000
+	return
+}
+
 //Fixtures are available by using one or more of the following methods in a test suite:
 // Run once when the suite starts running.
 func (s *FtpClientTestSuite) SetUpSuite(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	Err = s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	if Err != nil {
+		c.Fatalf("MakeDirectory error: %v\n", Err)
+	}
 }
 
 //Run before each test or benchmark starts running.
 func (s *FtpClientTestSuite) SetUpTest(c *C) {
 
-	var FtpsClientParam_X FtpsClientParam
-
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
 	FtpsClientParam_X.Id_U32 = CONID
-	FtpsClientParam_X.LoginName_S = "mc"
-	FtpsClientParam_X.LoginPassword_S = "a"
-	FtpsClientParam_X.InitialDirectory_S = "/Seq"
-	FtpsClientParam_X.SecureFtp_B = false
-	FtpsClientParam_X.TargetHost_S = "127.0.0.1"
-	FtpsClientParam_X.TargetPort_U16 = 21
-	FtpsClientParam_X.Debug_B = false
-	FtpsClientParam_X.TlsConfig_X.InsecureSkipVerify = true
-	FtpsClientParam_X.ConnectTimeout_S64 = 2000
-	FtpsClientParam_X.CtrlTimeout_S64 = 1000
+	FtpsClientParam_X.SecureFtp_B = s.secureFtp_B
 	FtpsClientParam_X.DataTimeout_S64 = 5000
 	FtpsClientParam_X.CtrlReadBufferSize_U32 = 0
 	FtpsClientParam_X.CtrlWriteBufferSize_U32 = 0
@@ -97,7 +126,7 @@ func (s *FtpClientTestSuite) TearDownTest(c *C) {
 
 //Run once after all tests or benchmarks have finished running.
 func (s *FtpClientTestSuite) TearDownSuite(c *C) {
-
+	s.ftpsServerPtr_X.Close()
 }
 
 const (
@@ -227,14 +256,85 @@ func (s *FtpClientTestSuite) TestDataChannel(c *C) {
 	}
 	_, _, NbRead_i, Err := GL_FtpsClientPtr_X.ReadFtpDataChannel(true, DataArray_U8[:])
 	if Err != nil {
-		c.Fatalf("ReadFtpDataChannel error: %v\n", Err, NbRead_i)
+		c.Fatalf("ReadFtpDataChannel error: %v %d\n", Err, NbRead_i)
 	}
 	ReplyCode_i, ReplyMessage_S, Err = GL_FtpsClientPtr_X.CloseFtpDataChannel()
 	if Err != nil {
 		c.Fatalf("CloseFtpDataChannel error: %v %d %s\n", Err, ReplyCode_i, ReplyMessage_S)
 	}
+	//The data channel is already closed
+	_, _, Err = GL_FtpsClientPtr_X.CloseFtpDataChannel()
+	c.Assert(Err, Equals, ErrInvalidParameter)
+	_, _, _, Err = GL_FtpsClientPtr_X.ReadFtpDataChannel(true, DataArray_U8[:])
+	c.Assert(Err, Equals, ErrInvalidParameter)
+	_, Err = GL_FtpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+}
+
+func (s *FtpClientTestSuite) TestDataChannelNotOpened(c *C) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientPtr_X := NewFtpsClient(&FtpsClientParam_X)
+	_, _, Err := FtpsClientPtr_X.CloseFtpDataChannel()
+	c.Assert(Err, Equals, ErrInvalidParameter)
+	_, _, _, Err = FtpsClientPtr_X.ReadFtpDataChannel(true, make([]byte, 16))
+	c.Assert(Err, Equals, ErrInvalidParameter)
+}
+
+func (s *FtpClientTestSuite) TestGlob(c *C) {
+	Err := uploadFile(LOCAL_PATH, HOST_PATH)
+	if Err != nil {
+		c.Fatalf("Upload error: %v\n", Err)
+	}
+	MatchArray_S, Err := GL_FtpsClientPtr_X.Glob("*.bha")
+	if Err != nil {
+		c.Fatalf("Glob error: %v\n", Err)
+	}
+	c.Assert(MatchArray_S, DeepEquals, []string{HOST_PATH})
+
+	MatchArray_S, Err = GL_FtpsClientPtr_X.Glob(GL_FtpsClientPtr_X.FtpsParam_X.InitialDirectory_S + "/copyof*.go.???")
+	if Err != nil {
+		c.Fatalf("Glob error: %v\n", Err)
+	}
+	c.Assert(MatchArray_S, DeepEquals, []string{GL_FtpsClientPtr_X.FtpsParam_X.InitialDirectory_S + "/" + HOST_PATH})
+
+	MatchArray_S, Err = GL_FtpsClientPtr_X.Glob("/**/" + HOST_PATH)
+	if Err != nil {
+		c.Fatalf("Glob error: %v\n", Err)
+	}
+	c.Assert(MatchArray_S, DeepEquals, []string{GL_FtpsClientPtr_X.FtpsParam_X.InitialDirectory_S + "/" + HOST_PATH})
 
+	_, Err = GL_FtpsClientPtr_X.Glob("[-]")
+	c.Assert(Err, NotNil)
+}
+
+func (s *FtpClientTestSuite) TestGlobLiteralPrefix(c *C) {
+	var Mutex_X sync.Mutex
+	var ListArray_S []string
+
+	c.Assert(s.ftpsServerPtr_X.MakeDirectory("/Seq/Clip/Day1"), IsNil)
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/Clip/Day1/take.mxf", []byte("media content")), IsNil)
+	//The parent directories can't be listed
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "LIST" {
+			Mutex_X.Lock()
+			ListArray_S = append(ListArray_S, _Argument_S)
+			Mutex_X.Unlock()
+			if _Argument_S != "-a /Seq/Clip/Day1" {
+				_SessionPtr_X.Reply(550, "Permission denied")
+				return true
+			}
+		}
+		return false
+	})
+	defer s.ftpsServerPtr_X.SetCommandHook(nil)
+	MatchArray_S, Err := GL_FtpsClientPtr_X.Glob("/Seq/Clip/Day1/*.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(MatchArray_S, DeepEquals, []string{"/Seq/Clip/Day1/take.mxf"})
+	Mutex_X.Lock()
+	defer Mutex_X.Unlock()
+	c.Assert(ListArray_S, DeepEquals, []string{"-a /Seq/Clip/Day1"})
 }
+
 func uploadFile(_LocalPath_S, _HostPath_S string) error {
 
 	pData_U8, rRts := ioutil.ReadFile(_LocalPath_S)
@@ -243,3 +343,19 @@ func uploadFile(_LocalPath_S, _HostPath_S string) error {
 	}
 	return rRts
 }
+
+func (s *FtpClientTestSuite) TestCommandHook(c *C) {
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "MKD" {
+			_SessionPtr_X.Reply(550, "Permission denied")
+			return true
+		}
+		return false
+	})
+	defer s.ftpsServerPtr_X.SetCommandHook(nil)
+
+	Err := GL_FtpsClientPtr_X.MakeDirectory(MKDIRNAME)
+	c.Assert(Err, NotNil)
+	_, Err = GL_FtpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+}
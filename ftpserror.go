@@ -0,0 +1,153 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+//Ftp protocol phase container
+type FTPPHASE int
+
+//Ftp protocol phase in which an error occurred
+const (
+	FTPPHASE_CONNECT FTPPHASE = iota
+	FTPPHASE_TLS
+	FTPPHASE_LOGIN
+	FTPPHASE_COMMAND
+	FTPPHASE_DATA
+	FTPPHASE_TRANSFER
+)
+
+//Returns the name of the phase
+func (this FTPPHASE) String() string {
+	switch this {
+	case FTPPHASE_CONNECT:
+		return "connect"
+	case FTPPHASE_TLS:
+		return "tls"
+	case FTPPHASE_LOGIN:
+		return "login"
+	case FTPPHASE_COMMAND:
+		return "command"
+	case FTPPHASE_DATA:
+		return "data channel"
+	case FTPPHASE_TRANSFER:
+		return "transfer"
+	}
+	return fmt.Sprintf("phase %d", int(this))
+}
+
+//Error returned by the ftp protocol operations. It keeps the ftp command sent, the reply expected and the one
+//received. errors.Is matches the package error such as ErrInvalidLogin and errors.As gives access to the
+//underlying error (*textproto.Error, net.Error,...)
+type FtpsError struct {
+	Phase_E FTPPHASE
+	//Ftp command sent to the server, the argument of the PASS, ACCT and sensitive SITE commands is masked
+	Command_S           string
+	ExpectedReplyCode_i int
+	//Reply code and text received from the server, 0 if no reply has been received
+	ReplyCode_i    int
+	ReplyMessage_S string
+	//Package error giving the error category (ErrInvalidLogin, ErrPasv,...), nil if none
+	Sentinel_I error
+	//Error which has caused the failure
+	Cause_I error
+}
+
+//Returns the error message
+func (this *FtpsError) Error() string {
+	var Message_S string
+
+	if this.Sentinel_I != nil {
+		Message_S = this.Sentinel_I.Error() + ": "
+	} else {
+		Message_S = "Ftps: "
+	}
+	Message_S += this.Phase_E.String()
+	if this.Command_S != "" {
+		Message_S += fmt.Sprintf(" '%s'", this.Command_S)
+	}
+	if (this.ReplyCode_i != 0) && (this.ReplyCode_i == this.ExpectedReplyCode_i) {
+		Message_S += fmt.Sprintf(" reply %d %s", this.ReplyCode_i, this.ReplyMessage_S)
+	} else if this.ReplyCode_i != 0 {
+		Message_S += fmt.Sprintf(" expected %d, got %d %s", this.ExpectedReplyCode_i, this.ReplyCode_i, this.ReplyMessage_S)
+	} else if this.Cause_I != nil {
+		Message_S += ": " + this.Cause_I.Error()
+	}
+	return Message_S
+}
+
+//Returns the package error and the cause of the error for errors.Is and errors.As
+func (this *FtpsError) Unwrap() []error {
+	var ErrorArray_I []error
+
+	if this.Sentinel_I != nil {
+		ErrorArray_I = append(ErrorArray_I, this.Sentinel_I)
+	}
+	if this.Cause_I != nil {
+		ErrorArray_I = append(ErrorArray_I, this.Cause_I)
+	}
+	return ErrorArray_I
+}
+
+//Returns true for a transient negative completion reply (4xx): the command can be retried later
+func (this *FtpsError) IsTransient() bool {
+	return (this.ReplyCode_i >= 400) && (this.ReplyCode_i < 500)
+}
+
+//Returns true for a permanent negative completion reply (5xx): the command should not be retried as is
+func (this *FtpsError) IsPermanent() bool {
+	return (this.ReplyCode_i >= 500) && (this.ReplyCode_i < 600)
+}
+
+//Returns true if '_Err' is a FtpsError reporting a transient negative completion reply (4xx)
+func IsTransient(_Err error) bool {
+	var FtpsErrorPtr_X *FtpsError
+
+	return errors.As(_Err, &FtpsErrorPtr_X) && FtpsErrorPtr_X.IsTransient()
+}
+
+//Returns true if '_Err' is a FtpsError reporting a permanent negative completion reply (5xx)
+func IsPermanent(_Err error) bool {
+	var FtpsErrorPtr_X *FtpsError
+
+	return errors.As(_Err, &FtpsErrorPtr_X) && FtpsErrorPtr_X.IsPermanent()
+}
+
+//Build the FtpsError reporting the failure '_Err' of the ftp command '_Request_S' which was waiting for
+//'_ExpectedReplyCode_i'. '_ReplyCode_i' and '_ReplyMessage_S' is the reply received, if any
+//Returns error object
+func newFtpsError(_Phase_E FTPPHASE, _Request_S string, _ExpectedReplyCode_i int, _ReplyCode_i int, _ReplyMessage_S string, _Err error) error {
+	var TextProtoErrPtr_X *textproto.Error
+
+	pFtpsError_X := &FtpsError{Phase_E: _Phase_E, Command_S: redactCommand(_Request_S, nil), ExpectedReplyCode_i: _ExpectedReplyCode_i, ReplyCode_i: _ReplyCode_i, ReplyMessage_S: _ReplyMessage_S, Cause_I: _Err}
+	if (pFtpsError_X.ReplyCode_i == 0) && errors.As(_Err, &TextProtoErrPtr_X) {
+		pFtpsError_X.ReplyCode_i = TextProtoErrPtr_X.Code
+		pFtpsError_X.ReplyMessage_S = TextProtoErrPtr_X.Msg
+	}
+	return pFtpsError_X
+}
+
+//Set the phase '_Phase_E' and the package error '_Sentinel_I' of the error '_Err'. '_Err' is wrapped in a new
+//FtpsError if it is not already one
+//Returns error object
+func withPhase(_Err error, _Phase_E FTPPHASE, _Sentinel_I error) error {
+	var FtpsErrorPtr_X *FtpsError
+
+	if errors.As(_Err, &FtpsErrorPtr_X) {
+		FtpsError_X := *FtpsErrorPtr_X
+		FtpsErrorPtr_X = &FtpsError_X
+	} else {
+		FtpsErrorPtr_X = &FtpsError{Cause_I: _Err}
+	}
+	FtpsErrorPtr_X.Phase_E = _Phase_E
+	if _Sentinel_I != nil {
+		FtpsErrorPtr_X.Sentinel_I = _Sentinel_I
+	}
+	return FtpsErrorPtr_X
+}
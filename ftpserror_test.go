@@ -0,0 +1,116 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' protocol error unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"net/textproto"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type FtpsErrorTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+}
+
+var _ = Suite(&FtpsErrorTestSuite{})
+
+func (s *FtpsErrorTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	Err = s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	if Err != nil {
+		c.Fatalf("MakeDirectory error: %v\n", Err)
+	}
+}
+
+func (s *FtpsErrorTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client for the test server logging in with '_LoginPassword_S' in '_InitialDirectory_S'
+//Returns pointer to FtpsClient and the Connect error object
+func (s *FtpsErrorTestSuite) connect(_LoginPassword_S string, _InitialDirectory_S string) (rFtpsClientPtr_X *FtpsClient, rRts error) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.LoginPassword_S = _LoginPassword_S
+	FtpsClientParam_X.InitialDirectory_S = _InitialDirectory_S
+
+	rFtpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	rRts = rFtpsClientPtr_X.Connect()
+	return
+}
+
+func (s *FtpsErrorTestSuite) TestLoginError(c *C) {
+	var FtpsErrorPtr_X *FtpsError
+	var TextProtoErrorPtr_X *textproto.Error
+
+	_, Err := s.connect("bad", "/Seq")
+	c.Assert(errors.Is(Err, ErrInvalidLogin), Equals, true)
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_LOGIN)
+	c.Assert(FtpsErrorPtr_X.Command_S, Equals, "PASS ****")
+	c.Assert(FtpsErrorPtr_X.ExpectedReplyCode_i, Equals, 230)
+	c.Assert(FtpsErrorPtr_X.ReplyCode_i, Equals, 530)
+	c.Assert(FtpsErrorPtr_X.IsPermanent(), Equals, true)
+	c.Assert(FtpsErrorPtr_X.IsTransient(), Equals, false)
+	c.Assert(errors.As(Err, &TextProtoErrorPtr_X), Equals, true)
+	c.Assert(TextProtoErrorPtr_X.Code, Equals, 530)
+	c.Assert(Err, ErrorMatches, "Ftps: Invalid loging: login 'PASS \\*\\*\\*\\*' expected 230, got 530 .*")
+
+	_, Err = s.connect("a", "/Missing")
+	c.Assert(errors.Is(Err, ErrInvalidDirectory), Equals, true)
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Command_S, Equals, "CWD /Missing")
+	c.Assert(FtpsErrorPtr_X.ReplyCode_i, Equals, 550)
+}
+
+func (s *FtpsErrorTestSuite) TestConnectError(c *C) {
+	var FtpsErrorPtr_X *FtpsError
+
+	s.ftpsServerPtr_X.Close()
+	_, Err := s.connect("a", "/Seq")
+	c.Assert(errors.Is(Err, ErrNotConnected), Equals, true)
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_CONNECT)
+	c.Assert(FtpsErrorPtr_X.ReplyCode_i, Equals, 0)
+	c.Assert(FtpsErrorPtr_X.Cause_I, NotNil)
+	c.Assert(IsTransient(Err), Equals, false)
+	c.Assert(IsPermanent(Err), Equals, false)
+}
+
+func (s *FtpsErrorTestSuite) TestCommandError(c *C) {
+	var FtpsErrorPtr_X *FtpsError
+
+	FtpsClientPtr_X, Err := s.connect("a", "/Seq")
+	c.Assert(Err, IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "DELE", ReplyCode_i: 450, ReplyMessage_S: "File busy", Count_i: 1})
+
+	Err = FtpsClientPtr_X.DeleteFile("clip.mxf")
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_COMMAND)
+	c.Assert(FtpsErrorPtr_X.Command_S, Equals, "DELE clip.mxf")
+	c.Assert(FtpsErrorPtr_X.ReplyCode_i, Equals, 450)
+	c.Assert(FtpsErrorPtr_X.ReplyMessage_S, Equals, "File busy")
+	c.Assert(IsTransient(Err), Equals, true)
+
+	Err = FtpsClientPtr_X.DeleteFile("clip.mxf")
+	c.Assert(IsPermanent(Err), Equals, true)
+
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "PASV", ReplyCode_i: 227, ReplyMessage_S: "Entering Passive Mode (1,2)", Count_i: 1})
+	_, Err = FtpsClientPtr_X.List()
+	c.Assert(errors.Is(Err, ErrPasv), Equals, true)
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_DATA)
+	c.Assert(FtpsErrorPtr_X.Command_S, Equals, "PASV")
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' robustness unit test.
+	Faults are injected on the test server to simulate misbehaving ftp servers.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type FtpsFaultTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+}
+
+var _ = Suite(&FtpsFaultTestSuite{})
+
+func (s *FtpsFaultTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	Err = s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789"))
+	if Err != nil {
+		c.Fatalf("WriteFile error: %v\n", Err)
+	}
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *FtpsFaultTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client connected to the test server
+//Returns error object
+func (s *FtpsFaultTestSuite) connect(_SecureFtp_B bool) (rRts error) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.CtrlTimeout_S64 = 200
+	FtpsClientParam_X.DataTimeout_S64 = 200
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	rRts = s.ftpsClientPtr_X.Connect()
+	return
+}
+
+//Check that the control connection is still usable after a fault
+func (s *FtpsFaultTestSuite) checkCtrlConnection(c *C) {
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
+
+func (s *FtpsFaultTestSuite) TestDelayedReply(c *C) {
+	c.Assert(s.connect(false), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_DELAY_REPLY, Command_S: "PWD", Delay_S64: 500 * time.Millisecond, Count_i: 1})
+
+	StartTime_X := time.Now()
+	_, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	var NetError_I net.Error
+	c.Assert(errors.As(Err, &NetError_I), Equals, true)
+	c.Assert(NetError_I.Timeout(), Equals, true)
+	c.Assert(time.Since(StartTime_X) < 500*time.Millisecond, Equals, true)
+}
+
+func (s *FtpsFaultTestSuite) TestErrorReply(c *C) {
+	c.Assert(s.connect(false), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "STOR", ReplyCode_i: 452, ReplyMessage_S: "Insufficient storage space", Count_i: 1})
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "MKD", ReplyCode_i: 550, ReplyMessage_S: "Permission denied", Count_i: 1})
+
+	var TextProtoErrorPtr_X *textproto.Error
+	Err := s.ftpsClientPtr_X.StoreFile("upload.mxf", []byte("data"))
+	c.Assert(errors.As(Err, &TextProtoErrorPtr_X), Equals, true)
+	c.Assert(TextProtoErrorPtr_X.Code, Equals, 452)
+	c.Assert(s.ftpsServerPtr_X.Exists("/Seq/upload.mxf"), Equals, false)
+	Err = s.ftpsClientPtr_X.MakeDirectory("shot")
+	c.Assert(errors.As(Err, &TextProtoErrorPtr_X), Equals, true)
+	c.Assert(TextProtoErrorPtr_X.Code, Equals, 550)
+	s.checkCtrlConnection(c)
+
+	//The faults are consumed
+	c.Assert(s.ftpsClientPtr_X.StoreFile("upload.mxf", []byte("data")), IsNil)
+	c.Assert(s.ftpsClientPtr_X.MakeDirectory("shot"), IsNil)
+}
+
+func (s *FtpsFaultTestSuite) TestMalformedPasv(c *C) {
+	c.Assert(s.connect(false), IsNil)
+	for _, ReplyMessage_S := range []string{
+		"Entering Passive Mode",
+		"Entering Passive Mode )127,0,0,1,4,1(",
+		"Entering Passive Mode (127,0,0,1)",
+		"Entering Passive Mode (127,0,0,1,4)",
+		"Entering Passive Mode (127,0,0,1,4,1,7)",
+		"Entering Passive Mode (127,0,0,1,a,b)",
+		"Entering Passive Mode (127,0,0,1,256,1)",
+		"Entering Passive Mode (127, 0, 0, 1, 256, 1)",
+		"Entering Passive Mode (127,0,0,1,-1,1)",
+		"Entering Passive Mode (127,0,0,1,0,0)",
+		"Entering Passive Mode ()",
+	} {
+		s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "PASV", ReplyCode_i: 227, ReplyMessage_S: ReplyMessage_S, Count_i: 1})
+		_, Err := s.ftpsClientPtr_X.List()
+		c.Assert(errors.Is(Err, ErrPasv), Equals, true, Commentf("Reply '%s'", ReplyMessage_S))
+	}
+	s.checkCtrlConnection(c)
+	_, Err := s.ftpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+}
+
+func (s *FtpsFaultTestSuite) TestDroppedDataConnection(c *C) {
+	c.Assert(s.connect(false), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_DROP_DATA, Command_S: "RETR", ByteCount_i: 4, Count_i: 2})
+
+	Err := s.ftpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf"))
+	c.Assert(errors.As(Err, new(*textproto.Error)), Equals, true)
+	s.checkCtrlConnection(c)
+
+	Reader_I, Err := s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+	Data_U8, Err := io.ReadAll(Reader_I)
+	c.Assert(errors.As(Err, new(*textproto.Error)), Equals, true)
+	c.Assert(string(Data_U8), Equals, "0123")
+	c.Assert(Reader_I.Close(), IsNil)
+	s.checkCtrlConnection(c)
+}
+
+func (s *FtpsFaultTestSuite) TestTruncatedList(c *C) {
+	c.Assert(s.connect(false), IsNil)
+	for _, ByteCount_i := range []int{0, 1, 10, 30, 45, 46} {
+		s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_TRUNCATE_LIST, Command_S: "LIST", ByteCount_i: ByteCount_i, Count_i: 1})
+		DirEntryArray_X, Err := s.ftpsClientPtr_X.List()
+		c.Assert(Err, IsNil)
+		c.Assert(len(DirEntryArray_X), Equals, 0, Commentf("Truncated to %d bytes", ByteCount_i))
+	}
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_TRUNCATE_LIST, Command_S: "MLSD", ByteCount_i: 10, Count_i: 1})
+	DirEntryArray_X, Err := s.ftpsClientPtr_X.MachineListDirectory("")
+	c.Assert(Err, IsNil)
+	c.Assert(len(DirEntryArray_X), Equals, 0)
+	s.checkCtrlConnection(c)
+}
+
+func (s *FtpsFaultTestSuite) TestMalformedListLine(c *C) {
+	var FtpsClient_X FtpsClient
+
+	for _, Line_S := range []string{
+		"",
+		"-",
+		"-rw-r--r-- 1 ftp ftp",
+		"-rw-r--r-- 1 ftp ftp 12 Jan 2 14 clip.mxf",
+		"-rw-r--r-- 1 ftp ftp 12 Jan 2 2014",
+		"-rw-r--r-- 1 ftp ftp size Jan 2 2014 clip.mxf",
+		"-rw-r--r-- 1 ftp ftp 12 Foo 2 2014 clip.mxf",
+		"-rw-r--r-- 1 ftp ftp 12 Jan 2 14: clip.mxf",
+		"-rw-r--r-- 1 ftp ftp 12 Jan 2 14:00 \r\n",
+	} {
+		DirEntryPtr_X, Err := FtpsClient_X.parseEntryLine(Line_S)
+		c.Assert(Err, NotNil, Commentf("Line '%s'", Line_S))
+		c.Assert(DirEntryPtr_X, IsNil)
+	}
+}
+
+func (s *FtpsFaultTestSuite) TestStalledTlsHandshake(c *C) {
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_STALL_TLS, Command_S: "AUTH", Delay_S64: time.Second, Count_i: 1})
+	StartTime_X := time.Now()
+	c.Assert(errors.Is(s.connect(true), ErrSecure), Equals, true)
+	c.Assert(time.Since(StartTime_X) < time.Second, Equals, true)
+
+	c.Assert(s.connect(true), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_STALL_TLS, Command_S: "RETR", Delay_S64: time.Second, Count_i: 1})
+	StartTime_X = time.Now()
+	Err := s.ftpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf"))
+	c.Assert(Err, NotNil)
+	c.Assert(time.Since(StartTime_X) < time.Second, Equals, true)
+}
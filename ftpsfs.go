@@ -0,0 +1,363 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"path"
+	"sort"
+	"time"
+)
+
+//Read only io/fs file system view of the remote ftp server tree. As a FtpsClient has a single data channel, a
+//file returned by Open must be closed before another one is read.
+type FtpsFs struct {
+	ftpsClientPtr_X *FtpsClient
+	root_S          string
+}
+
+//Check interface compliance
+var (
+	_ fs.FS         = (*FtpsFs)(nil)
+	_ fs.ReadDirFS  = (*FtpsFs)(nil)
+	_ fs.StatFS     = (*FtpsFs)(nil)
+	_ fs.ReadFileFS = (*FtpsFs)(nil)
+)
+
+//Information about a remote file or directory (fs.FileInfo)
+type ftpsFileInfo struct {
+	name_S     string
+	dirEntry_X DirEntry
+}
+
+//Opened remote file. The RETR transfer is started on the first Read
+type ftpsFsFile struct {
+	fsPtr_X      *FtpsFs
+	name_S       string
+	info_X       ftpsFileInfo
+	reader_I     io.ReadCloser
+	closed_B     bool
+	readRts      error
+	remotePath_S string
+}
+
+//Opened remote directory whose content has been read when it was opened
+type ftpsFsDir struct {
+	name_S          string
+	info_X          ftpsFileInfo
+	dirEntryArray_X []fs.DirEntry
+	offset_i        int
+	closed_B        bool
+}
+
+//Create a new io/fs file system view of the remote ftp server tree located under '_Root_S'. An empty root
+//refers to the current working ftp directory
+//Returns pointer to FtpsFs
+func NewFtpsFs(_FtpsClientPtr_X *FtpsClient, _Root_S string) *FtpsFs {
+	p := new(FtpsFs)
+	p.ftpsClientPtr_X = _FtpsClientPtr_X
+	p.root_S = _Root_S
+	return p
+}
+
+//Open the file or directory called '_Name_S' (fs.FS)
+//Returns fs.File and error object
+func (this *FtpsFs) Open(_Name_S string) (rFile_I fs.File, rRts error) {
+	var Info_X ftpsFileInfo
+	var DirEntryArray_X []fs.DirEntry
+
+	rFile_I = nil
+	Info_X, rRts = this.stat("open", _Name_S)
+	if rRts == nil {
+		if Info_X.IsDir() {
+			DirEntryArray_X, rRts = this.readDir("open", _Name_S)
+			if rRts == nil {
+				rFile_I = &ftpsFsDir{name_S: _Name_S, info_X: Info_X, dirEntryArray_X: DirEntryArray_X}
+			}
+		} else {
+			rFile_I = &ftpsFsFile{fsPtr_X: this, name_S: _Name_S, info_X: Info_X, remotePath_S: this.remotePath(_Name_S)}
+		}
+	}
+	return
+}
+
+//Read the content of the directory called '_Name_S' (fs.ReadDirFS)
+//Returns the directory entries sorted by name and error object
+func (this *FtpsFs) ReadDir(_Name_S string) (rDirEntryArray_X []fs.DirEntry, rRts error) {
+	rDirEntryArray_X, rRts = this.readDir("readdir", _Name_S)
+	return
+}
+
+//Get information about the file or directory called '_Name_S' (fs.StatFS)
+//Returns fs.FileInfo and error object
+func (this *FtpsFs) Stat(_Name_S string) (rFileInfo_I fs.FileInfo, rRts error) {
+	var Info_X ftpsFileInfo
+
+	rFileInfo_I = nil
+	Info_X, rRts = this.stat("stat", _Name_S)
+	if rRts == nil {
+		rFileInfo_I = Info_X
+	}
+	return
+}
+
+//Read the whole content of the file called '_Name_S' (fs.ReadFileFS)
+//Returns file content and error object
+func (this *FtpsFs) ReadFile(_Name_S string) (rDataArray_U8 []byte, rRts error) {
+	var Reader_I io.ReadCloser
+
+	rDataArray_U8 = nil
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: "readfile", Path: _Name_S, Err: fs.ErrInvalid}
+	} else {
+		Reader_I, rRts = this.ftpsClientPtr_X.RetrieveFileStream(this.remotePath(_Name_S))
+		if rRts == nil {
+			rDataArray_U8, rRts = io.ReadAll(Reader_I)
+			Reader_I.Close()
+		}
+		if rRts != nil {
+			rDataArray_U8 = nil
+			rRts = newFsPathError("readfile", _Name_S, rRts)
+		}
+	}
+	return
+}
+
+//Compute the remote path of the file system name '_Name_S'
+//Returns remote path
+func (this *FtpsFs) remotePath(_Name_S string) string {
+	if _Name_S == "." {
+		return this.root_S
+	}
+	return path.Join(this.root_S, _Name_S)
+}
+
+//Get information about '_Name_S' using MLST, or SIZE/MDTM and the parent directory listing when MLST is not
+//supported by the server
+//Returns file information and error object (*fs.PathError)
+func (this *FtpsFs) stat(_Op_S string, _Name_S string) (rInfo_X ftpsFileInfo, rRts error) {
+	var DirEntryPtr_X *DirEntry
+	var DirEntryArray_X []DirEntry
+	var Size_U64 uint64
+	var Time_X time.Time
+	var Sts error
+
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: _Op_S, Path: _Name_S, Err: fs.ErrInvalid}
+		return
+	}
+	rInfo_X.name_S = path.Base(_Name_S)
+	RemotePath_S := this.remotePath(_Name_S)
+	DirEntryPtr_X, rRts = this.ftpsClientPtr_X.MachineListEntry(RemotePath_S)
+	if rRts == nil {
+		rInfo_X.dirEntry_X = *DirEntryPtr_X
+	} else if isFtpCommandNotSupported(rRts) {
+		Size_U64, rRts = this.ftpsClientPtr_X.GetFileSize(RemotePath_S)
+		if rRts == nil {
+			Time_X, Sts = this.ftpsClientPtr_X.GetModificationTime(RemotePath_S)
+			rInfo_X.dirEntry_X = DirEntry{Type_E: DIRENTRYTYPE_FILE, Size_U64: Size_U64, Time_X: Time_X}
+			rInfo_X.dirEntry_X.setFullName(rInfo_X.name_S)
+			if !isFtpCommandNotSupported(Sts) {
+				rRts = Sts
+			}
+		} else if _Name_S == "." {
+			rRts = nil
+			rInfo_X.dirEntry_X = DirEntry{Type_E: DIRENTRYTYPE_FOLDER}
+		} else {
+			//Not a plain file: look for the entry in its parent directory
+			DirEntryArray_X, rRts = this.listDirectory(this.remotePath(path.Dir(_Name_S)))
+			if rRts == nil {
+				rRts = fs.ErrNotExist
+				for _, DirEntry_X := range DirEntryArray_X {
+					if DirEntry_X.FullName() == rInfo_X.name_S {
+						rInfo_X.dirEntry_X = DirEntry_X
+						rRts = nil
+						break
+					}
+				}
+			}
+		}
+	}
+	if rRts != nil {
+		rRts = newFsPathError(_Op_S, _Name_S, rRts)
+	}
+	return
+}
+
+//Read the content of the directory called '_Name_S'
+//Returns the directory entries sorted by name and error object (*fs.PathError)
+func (this *FtpsFs) readDir(_Op_S string, _Name_S string) (rDirEntryArray_X []fs.DirEntry, rRts error) {
+	var DirEntryArray_X []DirEntry
+
+	rDirEntryArray_X = nil
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: _Op_S, Path: _Name_S, Err: fs.ErrInvalid}
+	} else {
+		DirEntryArray_X, rRts = this.listDirectory(this.remotePath(_Name_S))
+		if rRts == nil {
+			for _, DirEntry_X := range DirEntryArray_X {
+				Name_S := DirEntry_X.FullName()
+				if (Name_S != ".") && (Name_S != "..") && (Name_S != "") {
+					rDirEntryArray_X = append(rDirEntryArray_X, fs.FileInfoToDirEntry(ftpsFileInfo{name_S: Name_S, dirEntry_X: DirEntry_X}))
+				}
+			}
+			sort.Slice(rDirEntryArray_X, func(i, j int) bool { return rDirEntryArray_X[i].Name() < rDirEntryArray_X[j].Name() })
+		} else {
+			rRts = newFsPathError(_Op_S, _Name_S, rRts)
+		}
+	}
+	return
+}
+
+//List the remote directory '_RemotePath_S' with MLSD or with LIST when MLSD is not supported by the server
+//Returns the list of file object present in the directory and error object
+func (this *FtpsFs) listDirectory(_RemotePath_S string) (rDirEntryArray_X []DirEntry, rRts error) {
+	rDirEntryArray_X, rRts = this.ftpsClientPtr_X.MachineListDirectory(_RemotePath_S)
+	if isFtpCommandNotSupported(rRts) {
+		rDirEntryArray_X, rRts = this.ftpsClientPtr_X.ListDirectory(_RemotePath_S)
+	}
+	return
+}
+
+//Check if '_Err' is the ftp server answer to an unknown or unimplemented command
+func isFtpCommandNotSupported(_Err error) bool {
+	var TextProtoErrPtr_X *textproto.Error
+
+	if errors.As(_Err, &TextProtoErrPtr_X) {
+		return (TextProtoErrPtr_X.Code == 500) || (TextProtoErrPtr_X.Code == 502) || (TextProtoErrPtr_X.Code == 504)
+	}
+	return false
+}
+
+//Turn the ftp error '_Err' into a *fs.PathError
+//Returns error object
+func newFsPathError(_Op_S string, _Name_S string, _Err error) error {
+	return &fs.PathError{Op: _Op_S, Path: _Name_S, Err: toFsError(_Err)}
+}
+
+//Turn the ftp error '_Err' into an io/fs error. A 550 ftp reply (file unavailable) is reported as fs.ErrNotExist
+//Returns error object
+func toFsError(_Err error) error {
+	var TextProtoErrPtr_X *textproto.Error
+
+	if errors.As(_Err, &TextProtoErrPtr_X) && (TextProtoErrPtr_X.Code == 550) {
+		return fs.ErrNotExist
+	}
+	return _Err
+}
+
+//fs.FileInfo implementation
+func (this ftpsFileInfo) Name() string       { return this.name_S }
+func (this ftpsFileInfo) Size() int64        { return int64(this.dirEntry_X.Size_U64) }
+func (this ftpsFileInfo) ModTime() time.Time { return this.dirEntry_X.Time_X.UTC() }
+func (this ftpsFileInfo) IsDir() bool        { return this.dirEntry_X.Type_E == DIRENTRYTYPE_FOLDER }
+func (this ftpsFileInfo) Sys() any           { return this.dirEntry_X }
+func (this ftpsFileInfo) Mode() fs.FileMode {
+	switch this.dirEntry_X.Type_E {
+	case DIRENTRYTYPE_FOLDER:
+		return fs.ModeDir | 0755
+	case DIRENTRYTYPE_LINK:
+		return fs.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+//Get information about the opened file (fs.File)
+//Returns fs.FileInfo and error object
+func (this *ftpsFsFile) Stat() (fs.FileInfo, error) {
+	return this.info_X, nil
+}
+
+//Read the next part of the file, the RETR transfer being started on the first call (fs.File)
+//Returns number of byte read and error object
+func (this *ftpsFsFile) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i = 0
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "read", Path: this.name_S, Err: fs.ErrClosed}
+	} else if this.readRts != nil {
+		rRts = this.readRts
+	} else {
+		if this.reader_I == nil {
+			this.reader_I, rRts = this.fsPtr_X.ftpsClientPtr_X.RetrieveFileStream(this.remotePath_S)
+			if rRts != nil {
+				this.readRts = newFsPathError("read", this.name_S, rRts)
+				rRts = this.readRts
+				return
+			}
+		}
+		rNbRead_i, rRts = this.reader_I.Read(_DataArray_U8)
+		if rRts != nil {
+			if rRts != io.EOF {
+				rRts = newFsPathError("read", this.name_S, rRts)
+			}
+			this.readRts = rRts
+		}
+	}
+	return
+}
+
+//Close the file, aborting the transfer if it is not complete (fs.File)
+//Returns error object
+func (this *ftpsFsFile) Close() (rRts error) {
+	rRts = nil
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "close", Path: this.name_S, Err: fs.ErrClosed}
+	} else {
+		this.closed_B = true
+		if this.reader_I != nil {
+			rRts = this.reader_I.Close()
+		}
+	}
+	return
+}
+
+//Get information about the opened directory (fs.File)
+//Returns fs.FileInfo and error object
+func (this *ftpsFsDir) Stat() (fs.FileInfo, error) {
+	return this.info_X, nil
+}
+
+//A directory can't be read (fs.File)
+//Returns error object
+func (this *ftpsFsDir) Read(_DataArray_U8 []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: this.name_S, Err: errors.New("is a directory")}
+}
+
+//Close the directory (fs.File)
+//Returns error object
+func (this *ftpsFsDir) Close() (rRts error) {
+	rRts = nil
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "close", Path: this.name_S, Err: fs.ErrClosed}
+	}
+	this.closed_B = true
+	return
+}
+
+//Read the next '_Count_i' directory entries, or all the remaining ones if '_Count_i' <= 0 (fs.ReadDirFile)
+//Returns directory entries and error object
+func (this *ftpsFsDir) ReadDir(_Count_i int) (rDirEntryArray_X []fs.DirEntry, rRts error) {
+	rDirEntryArray_X = nil
+	rRts = nil
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "readdir", Path: this.name_S, Err: fs.ErrClosed}
+	} else {
+		NbLeft_i := len(this.dirEntryArray_X) - this.offset_i
+		if _Count_i > 0 {
+			if NbLeft_i == 0 {
+				rRts = io.EOF
+			} else if _Count_i < NbLeft_i {
+				NbLeft_i = _Count_i
+			}
+		}
+		rDirEntryArray_X = make([]fs.DirEntry, NbLeft_i)
+		copy(rDirEntryArray_X, this.dirEntryArray_X[this.offset_i:this.offset_i+NbLeft_i])
+		this.offset_i += NbLeft_i
+	}
+	return
+}
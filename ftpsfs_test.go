@@ -0,0 +1,181 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' io/fs adapter unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing/fstest"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type FtpsFsTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	mlsd_B          bool
+}
+
+var _ = Suite(&FtpsFsTestSuite{mlsd_B: true})
+var _ = Suite(&FtpsFsTestSuite{mlsd_B: false})
+
+//Content of the remote file tree used by the tests
+var GL_FsFileMap_X = map[string]string{
+	"/Seq/clip.mxf":              "0123456789",
+	"/Seq/empty.txt":             "",
+	"/Seq/shot/shot_0001.dpx":    "frame 1",
+	"/Seq/shot/shot_0002.dpx":    "frame 2",
+	"/Seq/shot/sub/readme.txt":   "hello world",
+	"/Seq/.hidden":               "hidden",
+	"/Seq/name with space.txt":   "spaces",
+	"/Seq/audio/track.wav":       "RIFF",
+	"/Seq/audio/track.wav.bak":   "RIFF.bak",
+	"/Other/not_in_the_root.txt": "outside",
+}
+
+func (s *FtpsFsTestSuite) SetUpSuite(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a", DisableMlsd_B: !s.mlsd_B})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	for Path_S, Data_S := range GL_FsFileMap_X {
+		Err = s.ftpsServerPtr_X.WriteFile(Path_S, []byte(Data_S))
+		if Err != nil {
+			c.Fatalf("WriteFile error: %v\n", Err)
+		}
+	}
+	Err = s.ftpsServerPtr_X.MakeDirectory("/Seq/emptydir")
+	if Err != nil {
+		c.Fatalf("MakeDirectory error: %v\n", Err)
+	}
+}
+
+func (s *FtpsFsTestSuite) TearDownSuite(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+func (s *FtpsFsTestSuite) SetUpTest(c *C) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.Id_U32 = CONID
+	FtpsClientParam_X.DataTimeout_S64 = 5000
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	Err := s.ftpsClientPtr_X.Connect()
+	if Err != nil {
+		c.Fatalf("Connect error: %v\n", Err)
+	}
+}
+
+func (s *FtpsFsTestSuite) TearDownTest(c *C) {
+	Err := s.ftpsClientPtr_X.Disconnect()
+	if Err != nil {
+		c.Fatalf("Disconnect error: %v\n", Err)
+	}
+}
+
+func (s *FtpsFsTestSuite) TestFs(c *C) {
+	Err := fstest.TestFS(NewFtpsFs(s.ftpsClientPtr_X, "/Seq"), "clip.mxf", "empty.txt", "shot/shot_0001.dpx", "shot/sub/readme.txt", "emptydir", "name with space.txt")
+	if Err != nil {
+		c.Fatalf("TestFS error: %v\n", Err)
+	}
+}
+
+func (s *FtpsFsTestSuite) TestFsRelativeRoot(c *C) {
+	Err := fstest.TestFS(NewFtpsFs(s.ftpsClientPtr_X, "shot"), "shot_0001.dpx", "shot_0002.dpx", "sub/readme.txt")
+	if Err != nil {
+		c.Fatalf("TestFS error: %v\n", Err)
+	}
+}
+
+func (s *FtpsFsTestSuite) TestFsWalkDir(c *C) {
+	var PathArray_S []string
+
+	Err := fs.WalkDir(NewFtpsFs(s.ftpsClientPtr_X, "/Seq/shot"), ".", func(_Path_S string, _DirEntry_I fs.DirEntry, _Err error) error {
+		PathArray_S = append(PathArray_S, _Path_S)
+		return _Err
+	})
+	if Err != nil {
+		c.Fatalf("WalkDir error: %v\n", Err)
+	}
+	c.Assert(PathArray_S, DeepEquals, []string{".", "shot_0001.dpx", "shot_0002.dpx", "sub", "sub/readme.txt"})
+}
+
+func (s *FtpsFsTestSuite) TestFsWalkDirWorkingDirectory(c *C) {
+	var PathArray_S []string
+
+	Err := s.ftpsClientPtr_X.ChangeWorkingDirectory("/Seq/shot")
+	if Err != nil {
+		c.Fatalf("ChangeWorkingDirectory error: %v\n", Err)
+	}
+	//The MLST reply describes the working directory with 'type=cdir'
+	Err = fs.WalkDir(NewFtpsFs(s.ftpsClientPtr_X, ""), ".", func(_Path_S string, _DirEntry_I fs.DirEntry, _Err error) error {
+		PathArray_S = append(PathArray_S, _Path_S)
+		return _Err
+	})
+	if Err != nil {
+		c.Fatalf("WalkDir error: %v\n", Err)
+	}
+	c.Assert(PathArray_S, DeepEquals, []string{".", "shot_0001.dpx", "shot_0002.dpx", "sub", "sub/readme.txt"})
+}
+
+func (s *FtpsFsTestSuite) TestFsStat(c *C) {
+	FileInfo_I, Err := fs.Stat(NewFtpsFs(s.ftpsClientPtr_X, "/Seq"), "audio/track.wav")
+	if Err != nil {
+		c.Fatalf("Stat error: %v\n", Err)
+	}
+	c.Assert(FileInfo_I.Name(), Equals, "track.wav")
+	c.Assert(FileInfo_I.Size(), Equals, int64(4))
+	c.Assert(FileInfo_I.IsDir(), Equals, false)
+
+	FileInfo_I, Err = fs.Stat(NewFtpsFs(s.ftpsClientPtr_X, "/Seq"), "audio")
+	if Err != nil {
+		c.Fatalf("Stat error: %v\n", Err)
+	}
+	c.Assert(FileInfo_I.IsDir(), Equals, true)
+}
+
+func (s *FtpsFsTestSuite) TestFsNotExist(c *C) {
+	FtpsFsPtr_X := NewFtpsFs(s.ftpsClientPtr_X, "/Seq")
+	_, Err := FtpsFsPtr_X.Open("missing.txt")
+	c.Assert(errors.Is(Err, fs.ErrNotExist), Equals, true)
+	_, Err = FtpsFsPtr_X.ReadDir("missing")
+	c.Assert(errors.Is(Err, fs.ErrNotExist), Equals, true)
+	_, Err = FtpsFsPtr_X.ReadFile("missing.txt")
+	c.Assert(errors.Is(Err, fs.ErrNotExist), Equals, true)
+	_, Err = FtpsFsPtr_X.Open("../Other/not_in_the_root.txt")
+	c.Assert(errors.Is(Err, fs.ErrInvalid), Equals, true)
+}
+
+func (s *FtpsFsTestSuite) TestFsPartialRead(c *C) {
+	var DataArray_U8 [4]byte
+
+	FtpsFsPtr_X := NewFtpsFs(s.ftpsClientPtr_X, "/Seq")
+	File_I, Err := FtpsFsPtr_X.Open("clip.mxf")
+	if Err != nil {
+		c.Fatalf("Open error: %v\n", Err)
+	}
+	_, Err = io.ReadFull(File_I, DataArray_U8[:])
+	if Err != nil {
+		c.Fatalf("Read error: %v\n", Err)
+	}
+	c.Assert(string(DataArray_U8[:]), Equals, "0123")
+	Err = File_I.Close()
+	if Err != nil {
+		c.Fatalf("Close error: %v\n", Err)
+	}
+	//The control connection must still be usable after an aborted transfer
+	DataArray_U8b, Err := FtpsFsPtr_X.ReadFile("shot/sub/readme.txt")
+	if Err != nil {
+		c.Fatalf("ReadFile error: %v\n", Err)
+	}
+	c.Assert(string(DataArray_U8b), Equals, "hello world")
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpstest
+
+import (
+	"strings"
+	"time"
+)
+
+//Fault type container
+type FAULTTYPE int
+
+//Misbehaviours which can be scripted on the server
+const (
+	//Wait Delay_S64 before processing the command
+	FAULTTYPE_DELAY_REPLY FAULTTYPE = iota
+	//Answer ReplyCode_i/ReplyMessage_S instead of processing the command (4xx/5xx, malformed PASV reply,...)
+	FAULTTYPE_REPLY
+	//Close the data connection after ByteCount_i bytes (sent or received) and answer 426
+	FAULTTYPE_DROP_DATA
+	//Truncate each line of a LIST/MLSD listing to ByteCount_i bytes
+	FAULTTYPE_TRUNCATE_LIST
+	//Wait Delay_S64 before the TLS handshake of the control (AUTH) or data connection
+	FAULTTYPE_STALL_TLS
+)
+
+//Scripted server misbehaviour
+type Fault struct {
+	Type_E FAULTTYPE
+	//Command triggering the fault, an empty one matches all the commands
+	Command_S      string
+	Delay_S64      time.Duration
+	ReplyCode_i    int
+	ReplyMessage_S string
+	ByteCount_i    int
+	//Number of times the fault is triggered, 0 keeps it active until ClearFault is called
+	Count_i int
+}
+
+//Add the fault '_Fault_X' to the server. Faults are checked in their injection order
+func (this *Server) InjectFault(_Fault_X Fault) {
+	this.mutex_X.Lock()
+	_Fault_X.Command_S = strings.ToUpper(_Fault_X.Command_S)
+	this.faultArray_X = append(this.faultArray_X, _Fault_X)
+	this.mutex_X.Unlock()
+}
+
+//Remove all the injected faults
+func (this *Server) ClearFault() {
+	this.mutex_X.Lock()
+	this.faultArray_X = nil
+	this.mutex_X.Unlock()
+}
+
+//Look for a fault of type '_Type_E' matching the command '_Command_S' and consume one of its occurrences
+//Returns the fault and true if one has been found
+func (this *Server) takeFault(_Command_S string, _Type_E FAULTTYPE) (rFault_X Fault, rOk_B bool) {
+	rOk_B = false
+	this.mutex_X.Lock()
+	for i := range this.faultArray_X {
+		pFault_X := &this.faultArray_X[i]
+		if (pFault_X.Type_E == _Type_E) && ((pFault_X.Command_S == "") || (pFault_X.Command_S == _Command_S)) {
+			rFault_X = *pFault_X
+			rOk_B = true
+			if pFault_X.Count_i > 0 {
+				pFault_X.Count_i--
+				if pFault_X.Count_i == 0 {
+					this.faultArray_X = append(this.faultArray_X[:i], this.faultArray_X[i+1:]...)
+				}
+			}
+			break
+		}
+	}
+	this.mutex_X.Unlock()
+	return
+}
+
+//Apply the command level faults to the command currently processed by the session
+//Returns true if the command has been answered by a fault
+func (this *Session) applyCommandFault() (rHandled_B bool) {
+	rHandled_B = false
+	if Fault_X, Ok_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_DELAY_REPLY); Ok_B {
+		time.Sleep(Fault_X.Delay_S64)
+	}
+	if Fault_X, Ok_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_REPLY); Ok_B {
+		this.Reply(Fault_X.ReplyCode_i, Fault_X.ReplyMessage_S)
+		rHandled_B = true
+	}
+	return
+}
+
+//Wait before a TLS handshake if a FAULTTYPE_STALL_TLS fault matches the command currently processed by the session
+func (this *Session) applyTlsFault() {
+	if Fault_X, Ok_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_STALL_TLS); Ok_B {
+		time.Sleep(Fault_X.Delay_S64)
+	}
+}
+
+//Truncate the lines of the listing '_Data_U8' if a FAULTTYPE_TRUNCATE_LIST fault matches the command currently
+//processed by the session
+//Returns the listing
+func (this *Session) applyListFault(_Data_U8 []byte) []byte {
+	if Fault_X, Ok_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_TRUNCATE_LIST); Ok_B {
+		LineArray_S := strings.SplitAfter(string(_Data_U8), "\r\n")
+		for i, Line_S := range LineArray_S {
+			if len(Line_S) > Fault_X.ByteCount_i {
+				LineArray_S[i] = Line_S[:Fault_X.ByteCount_i] + "\r\n"
+			}
+		}
+		_Data_U8 = []byte(strings.Join(LineArray_S, ""))
+	}
+	return _Data_U8
+}
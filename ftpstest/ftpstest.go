@@ -0,0 +1,1071 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	Package ftpstest implements an in-memory ftp server listening on the loopback interface.
+	It is used to run the 'ftpsclient' package unit tests without an external ftp server.
+
+	The file tree is kept in a map and can be filled/checked by the test code with
+	MakeDirectory, WriteFile and ReadFile. Explicit FTPS (AUTH TLS) is supported with a
+	self-signed certificate (or the one of ServerParam) and the control connection can go back
+	to clear text after the login with CCC. The client certificates can be
+	checked to log in without password. A CommandHook can be installed to intercept the commands and
+	scripted faults (delayed or error replies, dropped data connections, truncated listings,
+	stalled TLS handshakes) can be injected with InjectFault.
+
+	A ReplayServer plays back a transcript recorded by the 'ftpsclient' TranscriptRecorder.
+*/
+package ftpstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Error messages generated by this package
+var (
+	ErrNotExist = errors.New("Ftpstest: File does not exist")
+	ErrIsDir    = errors.New("Ftpstest: File is a directory")
+	ErrNotDir   = errors.New("Ftpstest: Not a directory")
+	ErrNotEmpty = errors.New("Ftpstest: Directory not empty")
+)
+
+//Ftp test server working parameters
+type ServerParam struct {
+	LoginName_S      string
+	LoginPassword_S  string
+	DataTimeout_S64  time.Duration
+	DisableMlsd_B    bool
+	WelcomeMessage_S string
+	//Server certificate used by AUTH TLS, a self-signed one for 127.0.0.1 is generated if nil
+	TlsConfigPtr_X *tls.Config
+	//Authorities of the client certificates. When defined, the client certificate is requested in the TLS handshake
+	//and a client presenting one signed by them whose common name is the user name is logged in by USER (232 reply)
+	ClientCaPoolPtr_X *x509.CertPool
+	//IPv4 address advertised in the PASV replies (a NAT or spoofed address), 127.0.0.1 if empty. The data connections
+	//are always accepted on 127.0.0.1
+	PasvAddress_S string
+}
+
+//Node of the in-memory file tree
+type fileEntry struct {
+	dir_B     bool
+	data_U8   []byte
+	modTime_X time.Time
+	mode_X    fs.FileMode
+}
+
+//Ftp test server characteristics
+type Server struct {
+	Param_X ServerParam
+
+	listener_I     net.Listener
+	mutex_X        sync.Mutex
+	fileEntryMap_X map[string]*fileEntry
+	connMap_X      map[net.Conn]bool
+	waitGroup_X    sync.WaitGroup
+	tlsConfigPtr_X *tls.Config
+	commandHook    CommandHook
+	faultArray_X   []Fault
+}
+
+//Ftp control connection of a client
+type Session struct {
+	serverPtr_X        *Server
+	ctrlConnection_I   net.Conn
+	textProtocolPtr_X  *textproto.Conn
+	userName_S         string
+	loggedIn_B         bool
+	workingDirectory_S string
+	pasvListener_I     net.Listener
+	renameFrom_S       string
+	restOffset_U64     uint64
+	dataProtected_B    bool
+	tlsEnabled_B       bool
+	ctrlCleared_B      bool
+	command_S          string
+}
+
+//Function called before each command is processed by the server. It returns true when it has handled the
+//command (replies included) itself, or false to let the server process it
+type CommandHook func(_SessionPtr_X *Session, _Command_S string, _Argument_S string) bool
+
+//Ftp command handler
+type commandHandler func(_SessionPtr_X *Session, _Argument_S string)
+
+//Ftp commands supported by the server. The bool tells if the command needs a logged in user. It is read only and
+//private so that no test can change the behaviour of all the servers
+var commandMap_X = map[string]struct {
+	handler     commandHandler
+	needLogin_B bool
+}{
+	"USER": {(*Session).handleUser, false},
+	"PASS": {(*Session).handlePass, false},
+	"QUIT": {(*Session).handleQuit, false},
+	"NOOP": {(*Session).handleNoop, false},
+	"FEAT": {(*Session).handleFeat, false},
+	"SYST": {(*Session).handleSyst, false},
+	"TYPE": {(*Session).handleType, true},
+	"PWD":  {(*Session).handlePwd, true},
+	"CWD":  {(*Session).handleCwd, true},
+	"CDUP": {(*Session).handleCdup, true},
+	"PASV": {(*Session).handlePasv, true},
+	"LIST": {(*Session).handleList, true},
+	"MLSD": {(*Session).handleMlsd, true},
+	"MLST": {(*Session).handleMlst, true},
+	"SIZE": {(*Session).handleSize, true},
+	"MDTM": {(*Session).handleMdtm, true},
+	"RETR": {(*Session).handleRetr, true},
+	"STOR": {(*Session).handleStor, true},
+	"APPE": {(*Session).handleAppe, true},
+	"DELE": {(*Session).handleDele, true},
+	"MKD":  {(*Session).handleMkd, true},
+	"RMD":  {(*Session).handleRmd, true},
+	"RNFR": {(*Session).handleRnfr, true},
+	"RNTO": {(*Session).handleRnto, true},
+	"SITE": {(*Session).handleSite, true},
+	"AUTH": {(*Session).handleAuth, false},
+	"PBSZ": {(*Session).handlePbsz, false},
+	"PROT": {(*Session).handleProt, false},
+	"CCC":  {(*Session).handleCcc, true},
+	"EPSV": {(*Session).handleEpsv, true},
+	"REST": {(*Session).handleRest, true},
+}
+
+//Create and start a new ftp test server listening on a random loopback port
+//Returns pointer to Server and error object
+func NewServer(_ServerParamPtr_X *ServerParam) (rServerPtr_X *Server, rRts error) {
+	p := new(Server)
+	p.Param_X = *_ServerParamPtr_X
+	if p.Param_X.DataTimeout_S64 == 0 {
+		p.Param_X.DataTimeout_S64 = 5 * time.Second
+	}
+	if p.Param_X.WelcomeMessage_S == "" {
+		p.Param_X.WelcomeMessage_S = "ftpstest ready"
+	}
+	p.fileEntryMap_X = map[string]*fileEntry{"/": {dir_B: true, modTime_X: now(), mode_X: fs.ModeDir | 0755}}
+	p.connMap_X = make(map[net.Conn]bool)
+
+	rServerPtr_X = nil
+	p.tlsConfigPtr_X = p.Param_X.TlsConfigPtr_X
+	if p.tlsConfigPtr_X == nil {
+		p.tlsConfigPtr_X, rRts = newSelfSignedTlsConfig()
+		if rRts != nil {
+			return
+		}
+	}
+	if p.Param_X.ClientCaPoolPtr_X != nil {
+		p.tlsConfigPtr_X = p.tlsConfigPtr_X.Clone()
+		p.tlsConfigPtr_X.ClientAuth = tls.VerifyClientCertIfGiven
+		p.tlsConfigPtr_X.ClientCAs = p.Param_X.ClientCaPoolPtr_X
+	}
+	p.listener_I, rRts = net.Listen("tcp4", "127.0.0.1:0")
+	if rRts == nil {
+		rServerPtr_X = p
+		p.waitGroup_X.Add(1)
+		go p.acceptLoop()
+	}
+	return
+}
+
+//Returns the host name of the server
+func (this *Server) Host() string {
+	return this.listener_I.Addr().(*net.TCPAddr).IP.String()
+}
+
+//Returns the control port of the server
+func (this *Server) Port() uint16 {
+	return uint16(this.listener_I.Addr().(*net.TCPAddr).Port)
+}
+
+//Returns the certificate presented by the server in the TLS handshakes
+func (this *Server) Certificate() (rCertificatePtr_X *x509.Certificate) {
+	rCertificatePtr_X, _ = x509.ParseCertificate(this.tlsConfigPtr_X.Certificates[0].Certificate[0])
+	return
+}
+
+//Install '_CommandHook' to intercept the commands received by the server, nil removes the current one
+func (this *Server) SetCommandHook(_CommandHook CommandHook) {
+	this.mutex_X.Lock()
+	this.commandHook = _CommandHook
+	this.mutex_X.Unlock()
+}
+
+//Stop the server and close all the client connections
+//Returns error object
+func (this *Server) Close() (rRts error) {
+	rRts = this.listener_I.Close()
+	this.mutex_X.Lock()
+	for Conn_I := range this.connMap_X {
+		Conn_I.Close()
+	}
+	this.mutex_X.Unlock()
+	this.waitGroup_X.Wait()
+	return
+}
+
+//Create the directory '_Path_S' and all its missing parents
+//Returns error object
+func (this *Server) MakeDirectory(_Path_S string) (rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	rRts = this.makeDirectory(cleanPath(_Path_S), true)
+	return
+}
+
+//Create or replace the file '_Path_S' with the content '_Data_U8'. Missing parent directories are created
+//Returns error object
+func (this *Server) WriteFile(_Path_S string, _Data_U8 []byte) (rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	Path_S := cleanPath(_Path_S)
+	rRts = this.makeDirectory(path.Dir(Path_S), true)
+	if rRts == nil {
+		rRts = this.writeFile(Path_S, _Data_U8)
+	}
+	return
+}
+
+//Read the content of the file '_Path_S'
+//Returns a copy of the file content and error object
+func (this *Server) ReadFile(_Path_S string) (rData_U8 []byte, rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	rData_U8 = nil
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[cleanPath(_Path_S)]
+	if !Ok_B {
+		rRts = ErrNotExist
+	} else if FileEntryPtr_X.dir_B {
+		rRts = ErrIsDir
+	} else {
+		rData_U8 = append([]byte{}, FileEntryPtr_X.data_U8...)
+	}
+	return
+}
+
+//Get the permission bits of the file or directory '_Path_S'
+//Returns the permission bits and error object
+func (this *Server) Mode(_Path_S string) (rMode_X fs.FileMode, rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	rMode_X = 0
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[cleanPath(_Path_S)]
+	if !Ok_B {
+		rRts = ErrNotExist
+	} else {
+		rMode_X = FileEntryPtr_X.mode_X.Perm()
+	}
+	return
+}
+
+//Check if the file or directory '_Path_S' exists
+func (this *Server) Exists(_Path_S string) bool {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	_, Ok_B := this.fileEntryMap_X[cleanPath(_Path_S)]
+	return Ok_B
+}
+
+//Create the directory '_Path_S', and its parents if '_Parent_B' is set. Must be called with mutex_X locked
+//Returns error object
+func (this *Server) makeDirectory(_Path_S string, _Parent_B bool) (rRts error) {
+	rRts = nil
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]
+	if Ok_B {
+		if !FileEntryPtr_X.dir_B {
+			rRts = ErrNotDir
+		}
+	} else {
+		ParentPtr_X, Ok_B := this.fileEntryMap_X[path.Dir(_Path_S)]
+		if !Ok_B && _Parent_B {
+			rRts = this.makeDirectory(path.Dir(_Path_S), true)
+			ParentPtr_X, Ok_B = this.fileEntryMap_X[path.Dir(_Path_S)]
+		}
+		if rRts == nil {
+			if !Ok_B {
+				rRts = ErrNotExist
+			} else if !ParentPtr_X.dir_B {
+				rRts = ErrNotDir
+			} else {
+				this.fileEntryMap_X[_Path_S] = &fileEntry{dir_B: true, modTime_X: now(), mode_X: fs.ModeDir | 0755}
+			}
+		}
+	}
+	return
+}
+
+//Create or replace the file '_Path_S'. Must be called with mutex_X locked
+//Returns error object
+func (this *Server) writeFile(_Path_S string, _Data_U8 []byte) (rRts error) {
+	rRts = nil
+	ParentPtr_X, Ok_B := this.fileEntryMap_X[path.Dir(_Path_S)]
+	if !Ok_B {
+		rRts = ErrNotExist
+	} else if !ParentPtr_X.dir_B {
+		rRts = ErrNotDir
+	} else if FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]; Ok_B && FileEntryPtr_X.dir_B {
+		rRts = ErrIsDir
+	} else {
+		this.fileEntryMap_X[_Path_S] = &fileEntry{data_U8: append([]byte{}, _Data_U8...), modTime_X: now(), mode_X: 0644}
+	}
+	return
+}
+
+//Append '_Data_U8' to the file '_Path_S', the file is created if it does not exist. Must be called with mutex_X locked
+//Returns error object
+func (this *Server) appendFile(_Path_S string, _Data_U8 []byte) (rRts error) {
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]
+	if !Ok_B {
+		rRts = this.writeFile(_Path_S, _Data_U8)
+	} else if FileEntryPtr_X.dir_B {
+		rRts = ErrIsDir
+	} else {
+		FileEntryPtr_X.data_U8 = append(FileEntryPtr_X.data_U8, _Data_U8...)
+		FileEntryPtr_X.modTime_X = now()
+	}
+	return
+}
+
+//Store '_Data_U8' in the file '_Path_S': it is appended if '_Append_B' is set or written from '_Offset_U64' (the
+//file is truncated at this position)
+//Returns error object
+func (this *Server) storeFile(_Path_S string, _Data_U8 []byte, _Append_B bool, _Offset_U64 uint64) (rRts error) {
+	if _Append_B {
+		rRts = this.appendFile(_Path_S, _Data_U8)
+	} else if _Offset_U64 != 0 {
+		rRts = ErrNotExist
+		if FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]; Ok_B && !FileEntryPtr_X.dir_B && (_Offset_U64 <= uint64(len(FileEntryPtr_X.data_U8))) {
+			FileEntryPtr_X.data_U8 = append(FileEntryPtr_X.data_U8[:_Offset_U64:_Offset_U64], _Data_U8...)
+			FileEntryPtr_X.modTime_X = now()
+			rRts = nil
+		}
+	} else {
+		rRts = this.writeFile(_Path_S, _Data_U8)
+	}
+	return
+}
+
+//Remove the file '_Path_S', or the directory '_Path_S' if '_Dir_B' is set (it must be empty)
+//Returns error object
+func (this *Server) remove(_Path_S string, _Dir_B bool) (rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	rRts = nil
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]
+	if !Ok_B || (_Path_S == "/") {
+		rRts = ErrNotExist
+	} else if FileEntryPtr_X.dir_B != _Dir_B {
+		rRts = ErrIsDir
+		if _Dir_B {
+			rRts = ErrNotDir
+		}
+	} else {
+		for Path_S := range this.fileEntryMap_X {
+			if strings.HasPrefix(Path_S, _Path_S+"/") {
+				rRts = ErrNotEmpty
+				return
+			}
+		}
+		delete(this.fileEntryMap_X, _Path_S)
+	}
+	return
+}
+
+//Move the file or directory '_FromPath_S' (and its content) to '_ToPath_S'
+//Returns error object
+func (this *Server) rename(_FromPath_S string, _ToPath_S string) (rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	rRts = nil
+	ParentPtr_X, Ok_B := this.fileEntryMap_X[path.Dir(_ToPath_S)]
+	if _, Found_B := this.fileEntryMap_X[_FromPath_S]; !Found_B || (_FromPath_S == "/") {
+		rRts = ErrNotExist
+	} else if !Ok_B || !ParentPtr_X.dir_B || strings.HasPrefix(_ToPath_S, _FromPath_S+"/") {
+		rRts = ErrNotDir
+	} else {
+		for Path_S, FileEntryPtr_X := range this.fileEntryMap_X {
+			if (Path_S == _FromPath_S) || strings.HasPrefix(Path_S, _FromPath_S+"/") {
+				delete(this.fileEntryMap_X, Path_S)
+				this.fileEntryMap_X[_ToPath_S+Path_S[len(_FromPath_S):]] = FileEntryPtr_X
+			}
+		}
+	}
+	return
+}
+
+//Get a copy of the entry '_Path_S'
+//Returns the entry and true if it exists
+func (this *Server) getEntry(_Path_S string) (rFileEntry_X fileEntry, rOk_B bool) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	FileEntryPtr_X, rOk_B := this.fileEntryMap_X[_Path_S]
+	if rOk_B {
+		rFileEntry_X = *FileEntryPtr_X
+	}
+	return
+}
+
+//Get the content of the directory '_Path_S'
+//Returns the entries of the directory sorted by name and error object
+func (this *Server) getDirectoryContent(_Path_S string) (rNameArray_S []string, rFileEntryArray_X []fileEntry, rRts error) {
+	this.mutex_X.Lock()
+	defer this.mutex_X.Unlock()
+	FileEntryPtr_X, Ok_B := this.fileEntryMap_X[_Path_S]
+	if !Ok_B {
+		rRts = ErrNotExist
+	} else if !FileEntryPtr_X.dir_B {
+		rRts = ErrNotDir
+	} else {
+		for Path_S := range this.fileEntryMap_X {
+			if (Path_S != "/") && (path.Dir(Path_S) == _Path_S) {
+				rNameArray_S = append(rNameArray_S, path.Base(Path_S))
+			}
+		}
+		sort.Strings(rNameArray_S)
+		for _, Name_S := range rNameArray_S {
+			rFileEntryArray_X = append(rFileEntryArray_X, *this.fileEntryMap_X[path.Join(_Path_S, Name_S)])
+		}
+	}
+	return
+}
+
+//Accept the incoming control connections
+func (this *Server) acceptLoop() {
+	defer this.waitGroup_X.Done()
+	for {
+		Conn_I, Sts := this.listener_I.Accept()
+		if Sts != nil {
+			break
+		}
+		this.mutex_X.Lock()
+		this.connMap_X[Conn_I] = true
+		this.mutex_X.Unlock()
+		this.waitGroup_X.Add(1)
+		go func() {
+			defer this.waitGroup_X.Done()
+			pSession_X := &Session{serverPtr_X: this, ctrlConnection_I: Conn_I, workingDirectory_S: "/"}
+			pSession_X.serve()
+			this.mutex_X.Lock()
+			delete(this.connMap_X, Conn_I)
+			this.mutex_X.Unlock()
+		}()
+	}
+}
+
+//Process the commands of a control connection until it is closed
+func (this *Session) serve() {
+	this.textProtocolPtr_X = textproto.NewConn(this.ctrlConnection_I)
+	defer this.Close()
+	this.Reply(220, this.serverPtr_X.Param_X.WelcomeMessage_S)
+	for {
+		Line_S, Sts := this.textProtocolPtr_X.ReadLine()
+		if Sts != nil {
+			break
+		}
+		Command_S, Argument_S, _ := strings.Cut(Line_S, " ")
+		Command_S = strings.ToUpper(Command_S)
+		this.serverPtr_X.mutex_X.Lock()
+		CommandHook_X := this.serverPtr_X.commandHook
+		this.serverPtr_X.mutex_X.Unlock()
+		if (CommandHook_X != nil) && CommandHook_X(this, Command_S, Argument_S) {
+			continue
+		}
+		this.command_S = Command_S
+		if this.applyCommandFault() {
+			continue
+		}
+		Command_X, Ok_B := commandMap_X[Command_S]
+		if (Command_S == "MLSD" || Command_S == "MLST") && this.serverPtr_X.Param_X.DisableMlsd_B {
+			Ok_B = false
+		}
+		if !Ok_B {
+			this.Reply(502, "Command not implemented")
+		} else if Command_X.needLogin_B && !this.loggedIn_B {
+			this.Reply(530, "Please login with USER and PASS")
+		} else {
+			Command_X.handler(this, Argument_S)
+			if Command_S == "QUIT" {
+				break
+			}
+		}
+	}
+}
+
+//Close the control connection and release the resources of the session
+func (this *Session) Close() {
+	if this.pasvListener_I != nil {
+		this.pasvListener_I.Close()
+		this.pasvListener_I = nil
+	}
+	this.ctrlConnection_I.Close()
+}
+
+//Send the single line reply '_Message_S' with code '_Code_i'
+func (this *Session) Reply(_Code_i int, _Message_S string) {
+	this.textProtocolPtr_X.PrintfLine("%d %s", _Code_i, _Message_S)
+}
+
+//Send a multi-line reply with code '_Code_i': '_First_S', the lines '_LineArray_S' (prefixed by a space) and '_Last_S'
+func (this *Session) replyMultiLine(_Code_i int, _First_S string, _LineArray_S []string, _Last_S string) {
+	Reply_S := fmt.Sprintf("%d-%s\r\n", _Code_i, _First_S)
+	for _, Line_S := range _LineArray_S {
+		Reply_S += " " + Line_S + "\r\n"
+	}
+	Reply_S += fmt.Sprintf("%d %s\r\n", _Code_i, _Last_S)
+	this.WriteRaw(Reply_S)
+}
+
+//Send '_Data_S' as is over the control connection. It can be used by a CommandHook to send malformed replies
+func (this *Session) WriteRaw(_Data_S string) {
+	this.textProtocolPtr_X.W.WriteString(_Data_S)
+	this.textProtocolPtr_X.W.Flush()
+}
+
+//Returns the current working directory of the session
+func (this *Session) WorkingDirectory() string {
+	return this.workingDirectory_S
+}
+
+//Compute the absolute path of '_Argument_S' from the session working directory
+//Returns absolute path
+func (this *Session) absolutePath(_Argument_S string) string {
+	if strings.HasPrefix(_Argument_S, "/") {
+		return cleanPath(_Argument_S)
+	}
+	return cleanPath(path.Join(this.workingDirectory_S, _Argument_S))
+}
+
+//Accept the data connection opened by the client after a PASV command. The '150' reply with '_Message_S' is sent first
+//Returns data connection and error object
+func (this *Session) openDataConnection(_Message_S string) (rConnection_I net.Conn, rRts error) {
+	rConnection_I = nil
+	if this.pasvListener_I == nil {
+		rRts = errors.New("Ftpstest: No passive listener")
+		this.Reply(425, "Use PASV first")
+	} else {
+		this.Reply(150, _Message_S)
+		pListener_X := this.pasvListener_I.(*net.TCPListener)
+		pListener_X.SetDeadline(time.Now().Add(this.serverPtr_X.Param_X.DataTimeout_S64))
+		rConnection_I, rRts = pListener_X.Accept()
+		pListener_X.Close()
+		this.pasvListener_I = nil
+		if rRts != nil {
+			this.Reply(425, "Can't open data connection")
+		} else {
+			rConnection_I.SetDeadline(time.Now().Add(this.serverPtr_X.Param_X.DataTimeout_S64))
+			if this.dataProtected_B {
+				this.applyTlsFault()
+				rConnection_I = tls.Server(rConnection_I, this.serverPtr_X.tlsConfigPtr_X)
+			}
+		}
+	}
+	return
+}
+
+//Close the pending passive listener when a transfer command is refused
+func (this *Session) cancelDataConnection() {
+	if this.pasvListener_I != nil {
+		this.pasvListener_I.Close()
+		this.pasvListener_I = nil
+	}
+}
+
+//Send '_Data_U8' over a new data connection announced by the '150' reply '_Message_S' and close it
+func (this *Session) sendData(_Message_S string, _Data_U8 []byte) {
+	Connection_I, Sts := this.openDataConnection(_Message_S)
+	if Sts == nil {
+		Count_i := len(_Data_U8)
+		if Fault_X, Ok_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_DROP_DATA); Ok_B && (Fault_X.ByteCount_i < Count_i) {
+			Count_i = Fault_X.ByteCount_i
+		}
+		_, Sts = Connection_I.Write(_Data_U8[:Count_i])
+		Connection_I.Close()
+		if (Sts != nil) || (Count_i != len(_Data_U8)) {
+			this.Reply(426, "Connection closed; transfer aborted")
+		} else {
+			this.Reply(226, "Transfer complete")
+		}
+	}
+}
+
+func (this *Session) handleUser(_Argument_S string) {
+	this.userName_S = _Argument_S
+	this.loggedIn_B = false
+	if pTlsConnection_X, Ok_B := this.ctrlConnection_I.(*tls.Conn); Ok_B && (this.userName_S == this.serverPtr_X.Param_X.LoginName_S) {
+		State_X := pTlsConnection_X.ConnectionState()
+		this.loggedIn_B = (len(State_X.VerifiedChains) != 0) && (State_X.PeerCertificates[0].Subject.CommonName == this.userName_S)
+	}
+	if this.loggedIn_B {
+		this.Reply(232, "User logged in, authorized by security data exchange")
+	} else {
+		this.Reply(331, "Password required")
+	}
+}
+
+func (this *Session) handlePass(_Argument_S string) {
+	if (this.userName_S == this.serverPtr_X.Param_X.LoginName_S) && (_Argument_S == this.serverPtr_X.Param_X.LoginPassword_S) {
+		this.loggedIn_B = true
+		this.Reply(230, "Logged on")
+	} else {
+		this.Reply(530, "Login or password incorrect")
+	}
+}
+
+func (this *Session) handleQuit(_Argument_S string) {
+	this.Reply(221, "Goodbye")
+}
+
+func (this *Session) handleNoop(_Argument_S string) {
+	this.Reply(200, "OK")
+}
+
+func (this *Session) handleFeat(_Argument_S string) {
+	FeatureArray_S := []string{"AUTH TLS", "PBSZ", "PROT", "CCC", "EPSV", "REST STREAM", "SIZE", "MDTM", "UTF8"}
+	if !this.serverPtr_X.Param_X.DisableMlsd_B {
+		FeatureArray_S = append(FeatureArray_S, "MLST type*;size*;modify*;")
+	}
+	this.replyMultiLine(211, "Features:", FeatureArray_S, "End")
+}
+
+func (this *Session) handleSyst(_Argument_S string) {
+	this.Reply(215, "UNIX Type: L8")
+}
+
+func (this *Session) handleType(_Argument_S string) {
+	this.Reply(200, "Type set to "+_Argument_S)
+}
+
+func (this *Session) handlePwd(_Argument_S string) {
+	this.Reply(257, fmt.Sprintf("\"%s\" is current directory.", this.workingDirectory_S))
+}
+
+func (this *Session) handleCwd(_Argument_S string) {
+	Path_S := this.absolutePath(_Argument_S)
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(Path_S)
+	if Ok_B && FileEntry_X.dir_B {
+		this.workingDirectory_S = Path_S
+		this.Reply(250, "CWD successful")
+	} else {
+		this.Reply(550, "CWD failed: directory not found")
+	}
+}
+
+func (this *Session) handleCdup(_Argument_S string) {
+	this.handleCwd("..")
+}
+
+func (this *Session) handlePasv(_Argument_S string) {
+	Port_i, Sts := this.listenDataConnection()
+	if Sts != nil {
+		this.Reply(425, "Can't open passive connection")
+	} else {
+		Address_S := "127.0.0.1"
+		if this.serverPtr_X.Param_X.PasvAddress_S != "" {
+			Address_S = this.serverPtr_X.Param_X.PasvAddress_S
+		}
+		this.Reply(227, fmt.Sprintf("Entering Passive Mode (%s,%d,%d)", strings.ReplaceAll(Address_S, ".", ","), Port_i/256, Port_i%256))
+	}
+}
+
+func (this *Session) handleEpsv(_Argument_S string) {
+	Port_i, Sts := this.listenDataConnection()
+	if Sts != nil {
+		this.Reply(425, "Can't open passive connection")
+	} else {
+		this.Reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", Port_i))
+	}
+}
+
+//Open the passive listener waiting for the next data connection
+//Returns the listening port and error object
+func (this *Session) listenDataConnection() (rPort_i int, rRts error) {
+	rPort_i = 0
+	this.cancelDataConnection()
+	this.pasvListener_I, rRts = net.Listen("tcp4", "127.0.0.1:0")
+	if rRts == nil {
+		rPort_i = this.pasvListener_I.Addr().(*net.TCPAddr).Port
+	}
+	return
+}
+
+func (this *Session) handleAuth(_Argument_S string) {
+	if (strings.ToUpper(_Argument_S) != "TLS") && (strings.ToUpper(_Argument_S) != "SSL") {
+		this.Reply(504, "Auth type not supported")
+	} else if this.tlsEnabled_B {
+		this.Reply(503, "Already using TLS")
+	} else {
+		this.Reply(234, "Using authentication type "+_Argument_S)
+		this.applyTlsFault()
+		pTlsConnection_X := tls.Server(this.ctrlConnection_I, this.serverPtr_X.tlsConfigPtr_X)
+		pTlsConnection_X.SetDeadline(time.Now().Add(this.serverPtr_X.Param_X.DataTimeout_S64))
+		if pTlsConnection_X.Handshake() != nil {
+			this.ctrlConnection_I.Close()
+		} else {
+			pTlsConnection_X.SetDeadline(time.Time{})
+			this.tlsEnabled_B = true
+			this.ctrlConnection_I = pTlsConnection_X
+			this.textProtocolPtr_X = textproto.NewConn(pTlsConnection_X)
+		}
+	}
+}
+
+func (this *Session) handleCcc(_Argument_S string) {
+	var Sts error
+
+	if !this.tlsEnabled_B || this.ctrlCleared_B {
+		this.Reply(533, "Command channel is not protected")
+	} else {
+		this.Reply(200, "Command channel cleared")
+		this.ctrlConnection_I, Sts = clearCommandChannel(this.ctrlConnection_I, this.serverPtr_X.Param_X.DataTimeout_S64)
+		if Sts != nil {
+			this.ctrlConnection_I.Close()
+		} else {
+			this.ctrlCleared_B = true
+			this.textProtocolPtr_X = textproto.NewConn(this.ctrlConnection_I)
+		}
+	}
+}
+
+func (this *Session) handlePbsz(_Argument_S string) {
+	if !this.tlsEnabled_B {
+		this.Reply(503, "PBSZ not allowed on insecure control connection")
+	} else {
+		this.Reply(200, "PBSZ=0")
+	}
+}
+
+func (this *Session) handleProt(_Argument_S string) {
+	switch strings.ToUpper(_Argument_S) {
+	case "C":
+		this.dataProtected_B = false
+		this.Reply(200, "Protection level set to C")
+	case "P":
+		if !this.tlsEnabled_B {
+			this.Reply(503, "PROT not allowed on insecure control connection")
+		} else {
+			this.dataProtected_B = true
+			this.Reply(200, "Protection level set to P")
+		}
+	default:
+		this.Reply(504, "Protection level not supported")
+	}
+}
+
+func (this *Session) handleRest(_Argument_S string) {
+	Offset_U64, Sts := strconv.ParseUint(_Argument_S, 10, 64)
+	if Sts != nil {
+		this.Reply(501, "Invalid restart position")
+	} else {
+		this.restOffset_U64 = Offset_U64
+		this.Reply(350, fmt.Sprintf("Restarting at %d", Offset_U64))
+	}
+}
+
+func (this *Session) handleList(_Argument_S string) {
+	var Listing_S string
+
+	//Skip the ls like options
+	for strings.HasPrefix(_Argument_S, "-") {
+		_, _Argument_S, _ = strings.Cut(_Argument_S, " ")
+	}
+	Path_S := this.absolutePath(_Argument_S)
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(Path_S)
+	if !Ok_B {
+		this.cancelDataConnection()
+		this.Reply(550, "Directory not found")
+	} else {
+		if FileEntry_X.dir_B {
+			NameArray_S, FileEntryArray_X, _ := this.serverPtr_X.getDirectoryContent(Path_S)
+			for i, Name_S := range NameArray_S {
+				Listing_S += formatListLine(Name_S, &FileEntryArray_X[i])
+			}
+		} else {
+			Listing_S = formatListLine(path.Base(Path_S), &FileEntry_X)
+		}
+		this.sendData("Opening data connection", this.applyListFault([]byte(Listing_S)))
+	}
+}
+
+func (this *Session) handleMlsd(_Argument_S string) {
+	var Listing_S string
+
+	Path_S := this.absolutePath(_Argument_S)
+	NameArray_S, FileEntryArray_X, Sts := this.serverPtr_X.getDirectoryContent(Path_S)
+	if Sts != nil {
+		this.cancelDataConnection()
+		this.Reply(550, "Directory not found")
+	} else {
+		for i, Name_S := range NameArray_S {
+			Listing_S += formatMachineFacts(&FileEntryArray_X[i], false) + " " + Name_S + "\r\n"
+		}
+		this.sendData("Opening data connection", this.applyListFault([]byte(Listing_S)))
+	}
+}
+
+func (this *Session) handleMlst(_Argument_S string) {
+	Path_S := this.absolutePath(_Argument_S)
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(Path_S)
+	if !Ok_B {
+		this.Reply(550, "File not found")
+	} else {
+		this.replyMultiLine(250, "Listing "+Path_S, []string{formatMachineFacts(&FileEntry_X, Path_S == this.workingDirectory_S) + " " + Path_S}, "End")
+	}
+}
+
+func (this *Session) handleSize(_Argument_S string) {
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(this.absolutePath(_Argument_S))
+	if !Ok_B || FileEntry_X.dir_B {
+		this.Reply(550, "File not found")
+	} else {
+		this.Reply(213, fmt.Sprintf("%d", len(FileEntry_X.data_U8)))
+	}
+}
+
+func (this *Session) handleMdtm(_Argument_S string) {
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(this.absolutePath(_Argument_S))
+	if !Ok_B || FileEntry_X.dir_B {
+		this.Reply(550, "File not found")
+	} else {
+		this.Reply(213, FileEntry_X.modTime_X.Format("20060102150405"))
+	}
+}
+
+func (this *Session) handleRetr(_Argument_S string) {
+	Offset_U64 := this.restOffset_U64
+	this.restOffset_U64 = 0
+	FileEntry_X, Ok_B := this.serverPtr_X.getEntry(this.absolutePath(_Argument_S))
+	if !Ok_B || FileEntry_X.dir_B {
+		this.cancelDataConnection()
+		this.Reply(550, "File not found")
+	} else if Offset_U64 > uint64(len(FileEntry_X.data_U8)) {
+		this.cancelDataConnection()
+		this.Reply(554, "Invalid restart position")
+	} else {
+		this.sendData(fmt.Sprintf("Opening data connection for %s (%d bytes)", _Argument_S, len(FileEntry_X.data_U8)), FileEntry_X.data_U8[Offset_U64:])
+	}
+}
+
+func (this *Session) handleStor(_Argument_S string) {
+	this.receiveFile(this.absolutePath(_Argument_S), false)
+}
+
+func (this *Session) handleAppe(_Argument_S string) {
+	this.receiveFile(this.absolutePath(_Argument_S), true)
+}
+
+func (this *Session) handleDele(_Argument_S string) {
+	if this.serverPtr_X.remove(this.absolutePath(_Argument_S), false) != nil {
+		this.Reply(550, "File not found")
+	} else {
+		this.Reply(250, "File deleted successfully")
+	}
+}
+
+func (this *Session) handleMkd(_Argument_S string) {
+	Path_S := this.absolutePath(_Argument_S)
+	this.serverPtr_X.mutex_X.Lock()
+	_, Exist_B := this.serverPtr_X.fileEntryMap_X[Path_S]
+	Sts := this.serverPtr_X.makeDirectory(Path_S, false)
+	this.serverPtr_X.mutex_X.Unlock()
+	if Exist_B || (Sts != nil) {
+		this.Reply(550, "Directory already exists or parent not found")
+	} else {
+		this.Reply(257, fmt.Sprintf("\"%s\" created successfully", Path_S))
+	}
+}
+
+func (this *Session) handleRmd(_Argument_S string) {
+	if this.serverPtr_X.remove(this.absolutePath(_Argument_S), true) != nil {
+		this.Reply(550, "Directory not found or not empty")
+	} else {
+		this.Reply(250, "Directory deleted successfully")
+	}
+}
+
+func (this *Session) handleRnfr(_Argument_S string) {
+	Path_S := this.absolutePath(_Argument_S)
+	if _, Ok_B := this.serverPtr_X.getEntry(Path_S); !Ok_B {
+		this.Reply(550, "File not found")
+	} else {
+		this.renameFrom_S = Path_S
+		this.Reply(350, "File exists, ready for destination name")
+	}
+}
+
+func (this *Session) handleRnto(_Argument_S string) {
+	if this.renameFrom_S == "" {
+		this.Reply(503, "Bad sequence of commands")
+	} else if this.serverPtr_X.rename(this.renameFrom_S, this.absolutePath(_Argument_S)) != nil {
+		this.Reply(553, "Rename failed")
+	} else {
+		this.Reply(250, "File renamed successfully")
+	}
+	this.renameFrom_S = ""
+}
+
+func (this *Session) handleSite(_Argument_S string) {
+	var Mode_U64 uint64
+	var Sts error
+
+	SiteCommand_S, SiteArgument_S, _ := strings.Cut(_Argument_S, " ")
+	if strings.ToUpper(SiteCommand_S) != "CHMOD" {
+		this.Reply(504, "SITE command not implemented")
+	} else {
+		Mode_S, Path_S, _ := strings.Cut(SiteArgument_S, " ")
+		Mode_U64, Sts = strconv.ParseUint(Mode_S, 8, 32)
+		Path_S = this.absolutePath(Path_S)
+		this.serverPtr_X.mutex_X.Lock()
+		FileEntryPtr_X, Ok_B := this.serverPtr_X.fileEntryMap_X[Path_S]
+		if Ok_B && (Sts == nil) {
+			FileEntryPtr_X.mode_X = (FileEntryPtr_X.mode_X &^ fs.ModePerm) | (fs.FileMode(Mode_U64) & fs.ModePerm)
+		}
+		this.serverPtr_X.mutex_X.Unlock()
+		if Sts != nil {
+			this.Reply(501, "Invalid mode")
+		} else if !Ok_B {
+			this.Reply(550, "File not found")
+		} else {
+			this.Reply(200, "CHMOD command successful")
+		}
+	}
+}
+
+//Receive a file over a new data connection and store or append it to '_Path_S'
+func (this *Session) receiveFile(_Path_S string, _Append_B bool) {
+	Offset_U64 := this.restOffset_U64
+	this.restOffset_U64 = 0
+	ParentEntry_X, Ok_B := this.serverPtr_X.getEntry(path.Dir(_Path_S))
+	if !Ok_B || !ParentEntry_X.dir_B {
+		this.cancelDataConnection()
+		this.Reply(550, "Directory not found")
+	} else {
+		Connection_I, Sts := this.openDataConnection("Opening data connection")
+		if Sts == nil {
+			var Reader_I io.Reader = Connection_I
+			Fault_X, Drop_B := this.serverPtr_X.takeFault(this.command_S, FAULTTYPE_DROP_DATA)
+			if Drop_B {
+				Reader_I = io.LimitReader(Connection_I, int64(Fault_X.ByteCount_i))
+			}
+			Data_U8, Sts := io.ReadAll(Reader_I)
+			Connection_I.Close()
+			if Sts != nil {
+				this.Reply(426, "Connection closed; transfer aborted")
+			} else {
+				//A dropped transfer keeps what has been received as a real server would do
+				this.serverPtr_X.mutex_X.Lock()
+				Sts = this.serverPtr_X.storeFile(_Path_S, Data_U8, _Append_B, Offset_U64)
+				this.serverPtr_X.mutex_X.Unlock()
+				if Drop_B {
+					this.Reply(426, "Connection closed; transfer aborted")
+				} else if Sts != nil {
+					this.Reply(550, "Can't store file")
+				} else {
+					this.Reply(226, "Transfer complete")
+				}
+			}
+		}
+	}
+}
+
+//Format a 'ls -l' like LIST line for the entry '_FileEntryPtr_X' called '_Name_S'
+//Returns the line
+func formatListLine(_Name_S string, _FileEntryPtr_X *fileEntry) string {
+	var Time_S string
+
+	if _FileEntryPtr_X.modTime_X.Year() == time.Now().UTC().Year() {
+		Time_S = _FileEntryPtr_X.modTime_X.Format("Jan _2 15:04")
+	} else {
+		Time_S = _FileEntryPtr_X.modTime_X.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s\r\n", _FileEntryPtr_X.mode_X.String(), len(_FileEntryPtr_X.data_U8), Time_S, _Name_S)
+}
+
+//Format the MLSD/MLST facts of the entry '_FileEntryPtr_X'. The current working directory is reported with
+//'type=cdir' if '_WorkingDirectory_B' is true
+//Returns the facts
+func formatMachineFacts(_FileEntryPtr_X *fileEntry, _WorkingDirectory_B bool) string {
+	Type_S := "file"
+	if _WorkingDirectory_B {
+		Type_S = "cdir"
+	} else if _FileEntryPtr_X.dir_B {
+		Type_S = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;", Type_S, len(_FileEntryPtr_X.data_U8), _FileEntryPtr_X.modTime_X.Format("20060102150405"))
+}
+
+//Clean the absolute path '_Path_S'
+//Returns clean path
+func cleanPath(_Path_S string) string {
+	return path.Clean("/" + _Path_S)
+}
+
+//Returns the current UTC time truncated to the minute as it is the best resolution of a LIST reply
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Minute)
+}
+
+//Shut down the TLS layer of the control connection '_Connection_I' after a CCC command: the close_notify of the
+//client is awaited and answered within '_Timeout_S64'
+//Returns the underlying clear connection and error object
+func clearCommandChannel(_Connection_I net.Conn, _Timeout_S64 time.Duration) (rConnection_I net.Conn, rRts error) {
+	rConnection_I = _Connection_I
+	if pTlsConnection_X, Ok_B := _Connection_I.(*tls.Conn); Ok_B {
+		rRts = pTlsConnection_X.SetDeadline(time.Now().Add(_Timeout_S64))
+		if rRts == nil {
+			_, rRts = io.Copy(io.Discard, pTlsConnection_X)
+			if rRts == nil {
+				rRts = pTlsConnection_X.CloseWrite()
+				if rRts == nil {
+					rConnection_I = pTlsConnection_X.NetConn()
+					rRts = rConnection_I.SetDeadline(time.Time{})
+				}
+			}
+		}
+	}
+	return
+}
+
+//Create a tls configuration with a self-signed certificate for 127.0.0.1
+//Returns tls configuration and error object
+func newSelfSignedTlsConfig() (rTlsConfigPtr_X *tls.Config, rRts error) {
+	var PrivateKeyPtr_X *ecdsa.PrivateKey
+	var Certificate_U8 []byte
+
+	rTlsConfigPtr_X = nil
+	PrivateKeyPtr_X, rRts = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if rRts == nil {
+		Template_X := x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "ftpstest"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			DNSNames:     []string{"localhost"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		Certificate_U8, rRts = x509.CreateCertificate(rand.Reader, &Template_X, &Template_X, &PrivateKeyPtr_X.PublicKey, PrivateKeyPtr_X)
+		if rRts == nil {
+			rTlsConfigPtr_X = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{Certificate_U8}, PrivateKey: PrivateKeyPtr_X}}}
+		}
+	}
+	return
+}
@@ -0,0 +1,312 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpstest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Error messages generated by the proxy server
+var (
+	ErrProxyRequest = errors.New("Ftpstest: Invalid proxy request")
+	ErrProxyAuth    = errors.New("Ftpstest: Proxy authentication refused")
+)
+
+//Proxy type container
+type PROXYTYPE int
+
+//Protocols of the proxy server
+const (
+	//SOCKS5 proxy (RFC 1928) with the user name/password authentication (RFC 1929)
+	PROXYTYPE_SOCKS5 PROXYTYPE = iota
+	//HTTP proxy with the CONNECT method and the basic authentication
+	PROXYTYPE_HTTP
+)
+
+//Proxy server relaying the tcp connections of its clients to the targets they ask for. The user name and password
+//are checked if they are not empty
+type ProxyServer struct {
+	type_E        PROXYTYPE
+	userName_S    string
+	password_S    string
+	listener_I    net.Listener
+	mutex_X       sync.Mutex
+	targetArray_S []string
+	errArray_X    []error
+	connMap_X     map[net.Conn]bool
+	waitGroup_X   sync.WaitGroup
+}
+
+//Create and start a new proxy server of type '_Type_E' listening on a random loopback port. '_UserName_S' and
+//'_Password_S' are empty if no authentication is needed
+//Returns pointer to ProxyServer and error object
+func NewProxyServer(_Type_E PROXYTYPE, _UserName_S string, _Password_S string) (rProxyServerPtr_X *ProxyServer, rRts error) {
+	rProxyServerPtr_X = nil
+	p := new(ProxyServer)
+	p.type_E = _Type_E
+	p.userName_S = _UserName_S
+	p.password_S = _Password_S
+	p.connMap_X = make(map[net.Conn]bool)
+	p.listener_I, rRts = net.Listen("tcp4", "127.0.0.1:0")
+	if rRts == nil {
+		rProxyServerPtr_X = p
+		p.waitGroup_X.Add(1)
+		go p.acceptLoop()
+	}
+	return
+}
+
+//Returns the host:port address of the proxy
+func (this *ProxyServer) Address() string {
+	return this.listener_I.Addr().String()
+}
+
+//Returns the targets (host:port) of the connections relayed so far
+func (this *ProxyServer) Target() (rTargetArray_S []string) {
+	this.mutex_X.Lock()
+	rTargetArray_S = append(rTargetArray_S, this.targetArray_S...)
+	this.mutex_X.Unlock()
+	return
+}
+
+//Returns the errors of the proxy requests refused so far (ErrProxyAuth,...), nil if they have all been relayed
+func (this *ProxyServer) Err() (rRts error) {
+	this.mutex_X.Lock()
+	rRts = errors.Join(this.errArray_X...)
+	this.mutex_X.Unlock()
+	return
+}
+
+//Stop the proxy and close all the relayed connections
+//Returns error object
+func (this *ProxyServer) Close() (rRts error) {
+	rRts = this.listener_I.Close()
+	this.mutex_X.Lock()
+	for Conn_I := range this.connMap_X {
+		Conn_I.Close()
+	}
+	this.mutex_X.Unlock()
+	this.waitGroup_X.Wait()
+	return
+}
+
+func (this *ProxyServer) acceptLoop() {
+	defer this.waitGroup_X.Done()
+	for {
+		Conn_I, Sts := this.listener_I.Accept()
+		if Sts != nil {
+			break
+		}
+		this.track(Conn_I, true)
+		this.waitGroup_X.Add(1)
+		go func() {
+			defer this.waitGroup_X.Done()
+			this.serve(Conn_I)
+			this.track(Conn_I, false)
+		}()
+	}
+}
+
+//Add '_Conn_I' to the connections closed by Close if '_Add_B' is true, otherwise close and remove it
+func (this *ProxyServer) track(_Conn_I net.Conn, _Add_B bool) {
+	this.mutex_X.Lock()
+	if _Add_B {
+		this.connMap_X[_Conn_I] = true
+	} else {
+		_Conn_I.Close()
+		delete(this.connMap_X, _Conn_I)
+	}
+	this.mutex_X.Unlock()
+}
+
+//Negotiate the proxy request of the client connection '_Connection_I' and relay it to its target
+func (this *ProxyServer) serve(_Connection_I net.Conn) {
+	var Target_S string
+	var Sts error
+
+	_Connection_I.SetDeadline(time.Now().Add(5 * time.Second))
+	pReader_X := bufio.NewReader(_Connection_I)
+	if this.type_E == PROXYTYPE_SOCKS5 {
+		Target_S, Sts = this.readSocks5Request(_Connection_I, pReader_X)
+	} else {
+		Target_S, Sts = this.readHttpRequest(_Connection_I, pReader_X)
+	}
+	if Sts == nil {
+		var TargetConn_I net.Conn
+
+		TargetConn_I, Sts = net.DialTimeout("tcp4", Target_S, 2*time.Second)
+		if Sts == nil {
+			if this.type_E == PROXYTYPE_SOCKS5 {
+				_, Sts = _Connection_I.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			} else {
+				_, Sts = io.WriteString(_Connection_I, "HTTP/1.1 200 Connection established\r\n\r\n")
+			}
+			if Sts == nil {
+				this.mutex_X.Lock()
+				this.targetArray_S = append(this.targetArray_S, Target_S)
+				this.mutex_X.Unlock()
+				_Connection_I.SetDeadline(time.Time{})
+				this.relay(_Connection_I, pReader_X, TargetConn_I)
+			} else {
+				TargetConn_I.Close()
+			}
+		} else if this.type_E == PROXYTYPE_SOCKS5 {
+			_Connection_I.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		} else {
+			io.WriteString(_Connection_I, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		}
+	}
+	if Sts != nil {
+		this.mutex_X.Lock()
+		this.errArray_X = append(this.errArray_X, Sts)
+		this.mutex_X.Unlock()
+	}
+}
+
+//Copy the data between the client connection '_Connection_I', read with '_Reader_I', and '_TargetConn_I' until one
+//of them is closed
+func (this *ProxyServer) relay(_Connection_I net.Conn, _Reader_I io.Reader, _TargetConn_I net.Conn) {
+	var WaitGroup_X sync.WaitGroup
+
+	this.track(_TargetConn_I, true)
+	WaitGroup_X.Add(1)
+	go func() {
+		defer WaitGroup_X.Done()
+		io.Copy(_TargetConn_I, _Reader_I)
+		//Half close to let the target see the end of the upload
+		if TcpConnPtr_X, Ok_B := _TargetConn_I.(*net.TCPConn); Ok_B {
+			TcpConnPtr_X.CloseWrite()
+		}
+	}()
+	io.Copy(_Connection_I, _TargetConn_I)
+	_Connection_I.Close()
+	this.track(_TargetConn_I, false)
+	WaitGroup_X.Wait()
+}
+
+//Read the method negotiation, authentication and CONNECT request of a SOCKS5 client
+//Returns the target address and error object
+func (this *ProxyServer) readSocks5Request(_Connection_I net.Conn, _Reader_I *bufio.Reader) (rTarget_S string, rRts error) {
+	var Header_U8 [4]byte
+	var MethodArray_U8, Buffer_U8 []byte
+
+	_, rRts = io.ReadFull(_Reader_I, Header_U8[:2])
+	if (rRts == nil) && (Header_U8[0] != 5) {
+		rRts = ErrProxyRequest
+	}
+	if rRts == nil {
+		MethodArray_U8 = make([]byte, Header_U8[1])
+		_, rRts = io.ReadFull(_Reader_I, MethodArray_U8)
+	}
+	if rRts == nil {
+		Method_U8 := byte(0)
+		if this.userName_S != "" {
+			Method_U8 = 2
+		}
+		rRts = ErrProxyAuth
+		for _, Value_U8 := range MethodArray_U8 {
+			if Value_U8 == Method_U8 {
+				rRts = nil
+			}
+		}
+		if rRts != nil {
+			_Connection_I.Write([]byte{5, 0xFF})
+		} else {
+			_, rRts = _Connection_I.Write([]byte{5, Method_U8})
+		}
+		if (rRts == nil) && (Method_U8 == 2) {
+			var UserName_S, Password_S string
+
+			_, rRts = io.ReadFull(_Reader_I, Header_U8[:1])
+			if rRts == nil {
+				UserName_S, rRts = readSocks5String(_Reader_I)
+			}
+			if rRts == nil {
+				Password_S, rRts = readSocks5String(_Reader_I)
+			}
+			if rRts == nil {
+				if (UserName_S == this.userName_S) && (Password_S == this.password_S) {
+					_, rRts = _Connection_I.Write([]byte{1, 0})
+				} else {
+					_Connection_I.Write([]byte{1, 1})
+					rRts = ErrProxyAuth
+				}
+			}
+		}
+	}
+	if rRts == nil {
+		_, rRts = io.ReadFull(_Reader_I, Header_U8[:])
+		if (rRts == nil) && ((Header_U8[0] != 5) || (Header_U8[1] != 1)) {
+			rRts = ErrProxyRequest
+		}
+	}
+	if rRts == nil {
+		switch Header_U8[3] {
+		case 1:
+			Buffer_U8 = make([]byte, 4)
+			_, rRts = io.ReadFull(_Reader_I, Buffer_U8)
+			rTarget_S = net.IP(Buffer_U8).String()
+		case 4:
+			Buffer_U8 = make([]byte, 16)
+			_, rRts = io.ReadFull(_Reader_I, Buffer_U8)
+			rTarget_S = net.IP(Buffer_U8).String()
+		case 3:
+			rTarget_S, rRts = readSocks5String(_Reader_I)
+		default:
+			rRts = ErrProxyRequest
+		}
+	}
+	if rRts == nil {
+		_, rRts = io.ReadFull(_Reader_I, Header_U8[:2])
+		rTarget_S = net.JoinHostPort(rTarget_S, strconv.Itoa(int(binary.BigEndian.Uint16(Header_U8[:2]))))
+	}
+	return
+}
+
+//Read a SOCKS5 string prefixed by its length
+//Returns the string and error object
+func readSocks5String(_Reader_I *bufio.Reader) (rValue_S string, rRts error) {
+	var Length_U8 byte
+
+	Length_U8, rRts = _Reader_I.ReadByte()
+	if rRts == nil {
+		Buffer_U8 := make([]byte, Length_U8)
+		_, rRts = io.ReadFull(_Reader_I, Buffer_U8)
+		rValue_S = string(Buffer_U8)
+	}
+	return
+}
+
+//Read the CONNECT request of an HTTP client and check its basic authentication
+//Returns the target address and error object
+func (this *ProxyServer) readHttpRequest(_Connection_I net.Conn, _Reader_I *bufio.Reader) (rTarget_S string, rRts error) {
+	var RequestPtr_X *http.Request
+
+	RequestPtr_X, rRts = http.ReadRequest(_Reader_I)
+	if rRts == nil {
+		if RequestPtr_X.Method != http.MethodConnect {
+			io.WriteString(_Connection_I, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			rRts = ErrProxyRequest
+		} else if this.userName_S != "" {
+			Expected_S := "Basic " + base64.StdEncoding.EncodeToString([]byte(this.userName_S+":"+this.password_S))
+			if RequestPtr_X.Header.Get("Proxy-Authorization") != Expected_S {
+				io.WriteString(_Connection_I, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"ftpstest\"\r\n\r\n")
+				rRts = fmt.Errorf("%w: %s", ErrProxyAuth, RequestPtr_X.Host)
+			}
+		}
+		rTarget_S = RequestPtr_X.Host
+	}
+	return
+}
@@ -0,0 +1,295 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpstest
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Error messages generated by the replay server
+var (
+	ErrTranscriptMismatch = errors.New("Ftpstest: Command does not match the transcript")
+	ErrNoSession          = errors.New("Ftpstest: No more session in the transcript")
+)
+
+//Text replacing the argument of a redacted command in the transcript
+const redactedArgument_S = "****"
+
+//Line of a transcript file written by the 'ftpsclient' TranscriptRecorder
+type replayEntry struct {
+	Id_U32      uint32 `json:"id"`
+	Direction_S string `json:"direction"`
+	Line_S      string `json:"line"`
+	NbRead_U64  uint64 `json:"read"`
+	NbWrite_U64 uint64 `json:"write"`
+	Data_U8     []byte `json:"data"`
+}
+
+//Ftp server replaying the control connection of a transcript. Each control connection accepted plays the next
+//session of the transcript: the recorded replies are sent and the commands received must match the recorded ones
+//(any argument matches a redacted one). The PASV replies are rewritten with the port of the replay server and the
+//data connections send the recorded data completed with zeros up to the recorded size or consume the uploaded data
+type ReplayServer struct {
+	listener_I     net.Listener
+	tlsConfigPtr_X *tls.Config
+	mutex_X        sync.Mutex
+	sessionArray_X [][]replayEntry
+	nextSession_i  int
+	errArray_X     []error
+	connMap_X      map[net.Conn]bool
+	waitGroup_X    sync.WaitGroup
+}
+
+//Create and start a new replay server listening on a random loopback port and playing the transcript read from
+//'_Reader_I'. AUTH TLS is answered with a self-signed certificate
+//Returns pointer to ReplayServer and error object
+func NewReplayServer(_Reader_I io.Reader) (rReplayServerPtr_X *ReplayServer, rRts error) {
+	var EntryArray_X []replayEntry
+
+	rReplayServerPtr_X = nil
+	p := new(ReplayServer)
+	p.connMap_X = make(map[net.Conn]bool)
+	EntryArray_X, rRts = readReplayEntry(_Reader_I)
+	if rRts == nil {
+		p.sessionArray_X = splitReplaySession(EntryArray_X)
+		p.tlsConfigPtr_X, rRts = newSelfSignedTlsConfig()
+		if rRts == nil {
+			p.listener_I, rRts = net.Listen("tcp4", "127.0.0.1:0")
+			if rRts == nil {
+				rReplayServerPtr_X = p
+				p.waitGroup_X.Add(1)
+				go p.acceptLoop()
+			}
+		}
+	}
+	return
+}
+
+//Returns the host name of the server
+func (this *ReplayServer) Host() string {
+	return this.listener_I.Addr().(*net.TCPAddr).IP.String()
+}
+
+//Returns the control port of the server
+func (this *ReplayServer) Port() uint16 {
+	return uint16(this.listener_I.Addr().(*net.TCPAddr).Port)
+}
+
+//Returns the errors of the sessions replayed so far (ErrTranscriptMismatch,...), nil if they have all followed the
+//transcript
+func (this *ReplayServer) Err() (rRts error) {
+	this.mutex_X.Lock()
+	rRts = errors.Join(this.errArray_X...)
+	this.mutex_X.Unlock()
+	return
+}
+
+//Stop the server and close all the client connections
+//Returns error object
+func (this *ReplayServer) Close() (rRts error) {
+	rRts = this.listener_I.Close()
+	this.mutex_X.Lock()
+	for Conn_I := range this.connMap_X {
+		Conn_I.Close()
+	}
+	this.mutex_X.Unlock()
+	this.waitGroup_X.Wait()
+	return
+}
+
+func (this *ReplayServer) acceptLoop() {
+	defer this.waitGroup_X.Done()
+	for {
+		Conn_I, Sts := this.listener_I.Accept()
+		if Sts != nil {
+			break
+		}
+		this.mutex_X.Lock()
+		this.connMap_X[Conn_I] = true
+		Sts = ErrNoSession
+		var EntryArray_X []replayEntry
+		if this.nextSession_i < len(this.sessionArray_X) {
+			EntryArray_X = this.sessionArray_X[this.nextSession_i]
+			this.nextSession_i++
+			Sts = nil
+		}
+		this.mutex_X.Unlock()
+		this.waitGroup_X.Add(1)
+		go func() {
+			defer this.waitGroup_X.Done()
+			if Sts == nil {
+				Sts = this.replay(Conn_I, EntryArray_X)
+			}
+			Conn_I.Close()
+			this.mutex_X.Lock()
+			if Sts != nil {
+				this.errArray_X = append(this.errArray_X, Sts)
+			}
+			delete(this.connMap_X, Conn_I)
+			this.mutex_X.Unlock()
+		}()
+	}
+}
+
+//Play the session '_EntryArray_X' on the control connection '_Connection_I'
+//Returns error object
+func (this *ReplayServer) replay(_Connection_I net.Conn, _EntryArray_X []replayEntry) (rRts error) {
+	var PasvListener_I net.Listener
+	var Line_S, Command_S string
+	var DataProtected_B bool
+
+	defer func() {
+		if PasvListener_I != nil {
+			PasvListener_I.Close()
+		}
+	}()
+	TextProtocolPtr_X := textproto.NewConn(_Connection_I)
+	for _, Entry_X := range _EntryArray_X {
+		switch Entry_X.Direction_S {
+		case "send":
+			Line_S, rRts = TextProtocolPtr_X.ReadLine()
+			if (rRts == nil) && !matchReplayCommand(Entry_X.Line_S, Line_S) {
+				rRts = fmt.Errorf("%w: expected '%s', got '%s'", ErrTranscriptMismatch, Entry_X.Line_S, Line_S)
+				TextProtocolPtr_X.PrintfLine("500 Transcript mismatch")
+			}
+			Command_S = strings.ToUpper(Line_S)
+		case "recv":
+			Line_S = Entry_X.Line_S
+			if strings.HasPrefix(Line_S, "227 ") {
+				if PasvListener_I != nil {
+					PasvListener_I.Close()
+				}
+				PasvListener_I, rRts = net.Listen("tcp4", "127.0.0.1:0")
+				if rRts == nil {
+					Port_i := PasvListener_I.Addr().(*net.TCPAddr).Port
+					Line_S = fmt.Sprintf("227 Entering Passive Mode (127,0,0,1,%d,%d)", Port_i/256, Port_i%256)
+				}
+			}
+			if rRts == nil {
+				rRts = TextProtocolPtr_X.PrintfLine("%s", Line_S)
+			}
+			if rRts == nil {
+				if strings.HasPrefix(Line_S, "234 ") {
+					pTlsConnection_X := tls.Server(_Connection_I, this.tlsConfigPtr_X)
+					pTlsConnection_X.SetDeadline(time.Now().Add(5 * time.Second))
+					rRts = pTlsConnection_X.Handshake()
+					pTlsConnection_X.SetDeadline(time.Time{})
+					_Connection_I = pTlsConnection_X
+					TextProtocolPtr_X = textproto.NewConn(pTlsConnection_X)
+				} else if (Command_S == "CCC") && strings.HasPrefix(Line_S, "200 ") {
+					_Connection_I, rRts = clearCommandChannel(_Connection_I, 5*time.Second)
+					TextProtocolPtr_X = textproto.NewConn(_Connection_I)
+				} else if strings.HasPrefix(Command_S, "PROT ") && strings.HasPrefix(Line_S, "200 ") {
+					DataProtected_B = (Command_S == "PROT P")
+				}
+			}
+		case "data":
+			if PasvListener_I == nil {
+				rRts = fmt.Errorf("%w: data transfer without PASV", ErrTranscriptMismatch)
+			} else {
+				rRts = replayData(PasvListener_I, Entry_X, DataProtected_B, this.tlsConfigPtr_X)
+				PasvListener_I.Close()
+				PasvListener_I = nil
+			}
+		}
+		if rRts != nil {
+			break
+		}
+	}
+	return
+}
+
+//Accept the data connection on '_PasvListener_I' and play the transfer '_Entry_X'
+//Returns error object
+func replayData(_PasvListener_I net.Listener, _Entry_X replayEntry, _DataProtected_B bool, _TlsConfigPtr_X *tls.Config) (rRts error) {
+	var Connection_I net.Conn
+
+	pListener_X := _PasvListener_I.(*net.TCPListener)
+	pListener_X.SetDeadline(time.Now().Add(5 * time.Second))
+	Connection_I, rRts = pListener_X.Accept()
+	if rRts == nil {
+		Connection_I.SetDeadline(time.Now().Add(5 * time.Second))
+		if _DataProtected_B {
+			Connection_I = tls.Server(Connection_I, _TlsConfigPtr_X)
+		}
+		if _Entry_X.NbRead_U64 != 0 {
+			Data_U8 := make([]byte, _Entry_X.NbRead_U64)
+			copy(Data_U8, _Entry_X.Data_U8)
+			_, rRts = Connection_I.Write(Data_U8)
+		} else if _Entry_X.NbWrite_U64 != 0 {
+			_, rRts = io.Copy(io.Discard, Connection_I)
+		}
+		Connection_I.Close()
+	}
+	return
+}
+
+//Returns true if the command '_Line_S' matches the recorded one '_Expected_S'. A redacted argument matches any
+//argument of the same command
+func matchReplayCommand(_Expected_S string, _Line_S string) bool {
+	if strings.HasSuffix(_Expected_S, " "+redactedArgument_S) {
+		Verb_S, _, _ := strings.Cut(_Line_S, " ")
+		return strings.EqualFold(strings.TrimSuffix(_Expected_S, " "+redactedArgument_S), Verb_S)
+	}
+	return _Expected_S == _Line_S
+}
+
+//Read the transcript entries from '_Reader_I'
+//Returns the entries and error object
+func readReplayEntry(_Reader_I io.Reader) (rEntryArray_X []replayEntry, rRts error) {
+	DecoderPtr_X := json.NewDecoder(_Reader_I)
+	for {
+		var Entry_X replayEntry
+
+		rRts = DecoderPtr_X.Decode(&Entry_X)
+		if rRts != nil {
+			if rRts == io.EOF {
+				rRts = nil
+			}
+			break
+		}
+		rEntryArray_X = append(rEntryArray_X, Entry_X)
+	}
+	return
+}
+
+//Split the transcript entries '_EntryArray_X' into sessions: the entries are grouped by client id, in the order of
+//their first appearance, and a new session starts at each control connection opening
+//Returns the sessions
+func splitReplaySession(_EntryArray_X []replayEntry) (rSessionArray_X [][]replayEntry) {
+	var IdArray_U32 []uint32
+
+	EntryMap_X := make(map[uint32][]replayEntry)
+	for _, Entry_X := range _EntryArray_X {
+		if _, Ok_B := EntryMap_X[Entry_X.Id_U32]; !Ok_B {
+			IdArray_U32 = append(IdArray_U32, Entry_X.Id_U32)
+		}
+		EntryMap_X[Entry_X.Id_U32] = append(EntryMap_X[Entry_X.Id_U32], Entry_X)
+	}
+	for _, Id_U32 := range IdArray_U32 {
+		var Session_X []replayEntry
+
+		for _, Entry_X := range EntryMap_X[Id_U32] {
+			if (Entry_X.Direction_S == "open") && (len(Session_X) != 0) {
+				rSessionArray_X = append(rSessionArray_X, Session_X)
+				Session_X = nil
+			}
+			Session_X = append(Session_X, Entry_X)
+		}
+		if len(Session_X) != 0 {
+			rSessionArray_X = append(rSessionArray_X, Session_X)
+		}
+	}
+	return
+}
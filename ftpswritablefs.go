@@ -0,0 +1,246 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+//File returned by FtpsWritableFs. A file opened for reading can't be written and vice versa
+type FtpsFile interface {
+	fs.File
+	io.Writer
+	Name() string
+}
+
+//Read/write file system view of the remote ftp server tree. It extends FtpsFs with the creation, update, rename
+//and removal of remote files. As a FtpsClient has a single data channel, a file must be closed before another one
+//is read or written.
+type FtpsWritableFs struct {
+	*FtpsFs
+}
+
+//Remote file opened for writing. The data are streamed through STOR or APPE and the transfer is completed by Close
+type ftpsFsWriter struct {
+	name_S   string
+	info_X   ftpsFileInfo
+	writer_I io.WriteCloser
+	closed_B bool
+}
+
+//Check interface compliance
+var (
+	_ FtpsFile = (*ftpsFsFile)(nil)
+	_ FtpsFile = (*ftpsFsDir)(nil)
+	_ FtpsFile = (*ftpsFsWriter)(nil)
+)
+
+//Create a new read/write file system view of the remote ftp server tree located under '_Root_S'. An empty root
+//refers to the current working ftp directory
+//Returns pointer to FtpsWritableFs
+func NewFtpsWritableFs(_FtpsClientPtr_X *FtpsClient, _Root_S string) *FtpsWritableFs {
+	p := new(FtpsWritableFs)
+	p.FtpsFs = NewFtpsFs(_FtpsClientPtr_X, _Root_S)
+	return p
+}
+
+//Create or truncate the file called '_Name_S' and open it for writing
+//Returns the opened file and error object
+func (this *FtpsWritableFs) Create(_Name_S string) (rFile_I FtpsFile, rRts error) {
+	rFile_I, rRts = this.OpenFile(_Name_S, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	return
+}
+
+//Open the file called '_Name_S' with the os.O_XXX flags '_Flag_i'. os.O_RDWR is not supported and a file opened
+//for writing is always rewritten from its beginning unless os.O_APPEND is set. The permission bits '_Perm_X' are
+//left to the ftp server, use Chmod to change them
+//Returns the opened file and error object
+func (this *FtpsWritableFs) OpenFile(_Name_S string, _Flag_i int, _Perm_X fs.FileMode) (rFile_I FtpsFile, rRts error) {
+	var File_I fs.File
+	var Info_X ftpsFileInfo
+	var Writer_I io.WriteCloser
+
+	rFile_I = nil
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: "open", Path: _Name_S, Err: fs.ErrInvalid}
+		return
+	}
+	switch _Flag_i & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		File_I, rRts = this.Open(_Name_S)
+		if rRts == nil {
+			rFile_I = File_I.(FtpsFile)
+		}
+	case os.O_WRONLY:
+		Info_X, rRts = this.stat("open", _Name_S)
+		if rRts == nil {
+			if Info_X.IsDir() {
+				rRts = &fs.PathError{Op: "open", Path: _Name_S, Err: errors.New("is a directory")}
+			} else if (_Flag_i&os.O_CREATE != 0) && (_Flag_i&os.O_EXCL != 0) {
+				rRts = &fs.PathError{Op: "open", Path: _Name_S, Err: fs.ErrExist}
+			}
+		} else if errors.Is(rRts, fs.ErrNotExist) && (_Flag_i&os.O_CREATE != 0) {
+			rRts = nil
+			Info_X = ftpsFileInfo{name_S: path.Base(_Name_S), dirEntry_X: DirEntry{Type_E: DIRENTRYTYPE_FILE, Time_X: time.Now().UTC()}}
+			Info_X.dirEntry_X.setFullName(Info_X.name_S)
+		}
+		if rRts == nil {
+			if _Flag_i&os.O_APPEND != 0 {
+				Writer_I, rRts = this.ftpsClientPtr_X.AppendFileStream(this.remotePath(_Name_S))
+			} else {
+				Info_X.dirEntry_X.Size_U64 = 0
+				Writer_I, rRts = this.ftpsClientPtr_X.StoreFileStream(this.remotePath(_Name_S))
+			}
+			if rRts == nil {
+				rFile_I = &ftpsFsWriter{name_S: _Name_S, info_X: Info_X, writer_I: Writer_I}
+			} else {
+				rRts = newFsPathError("open", _Name_S, rRts)
+			}
+		}
+	default:
+		rRts = &fs.PathError{Op: "open", Path: _Name_S, Err: fs.ErrInvalid}
+	}
+	return
+}
+
+//Create the directory called '_Name_S'. The permission bits '_Perm_X' are left to the ftp server
+//Returns error object
+func (this *FtpsWritableFs) Mkdir(_Name_S string, _Perm_X fs.FileMode) (rRts error) {
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: "mkdir", Path: _Name_S, Err: fs.ErrInvalid}
+	} else {
+		rRts = this.ftpsClientPtr_X.MakeDirectory(this.remotePath(_Name_S))
+		if rRts != nil {
+			if _, Sts := this.stat("mkdir", _Name_S); Sts == nil {
+				rRts = fs.ErrExist
+			}
+			rRts = newFsPathError("mkdir", _Name_S, rRts)
+		}
+	}
+	return
+}
+
+//Remove the file or empty directory called '_Name_S'
+//Returns error object
+func (this *FtpsWritableFs) Remove(_Name_S string) (rRts error) {
+	if !fs.ValidPath(_Name_S) || (_Name_S == ".") {
+		rRts = &fs.PathError{Op: "remove", Path: _Name_S, Err: fs.ErrInvalid}
+	} else {
+		RemotePath_S := this.remotePath(_Name_S)
+		rRts = this.ftpsClientPtr_X.DeleteFile(RemotePath_S)
+		if rRts != nil {
+			if this.ftpsClientPtr_X.RemoveDirectory(RemotePath_S) == nil {
+				rRts = nil
+			} else {
+				rRts = newFsPathError("remove", _Name_S, rRts)
+			}
+		}
+	}
+	return
+}
+
+//Rename the file or directory called '_OldName_S' into '_NewName_S'
+//Returns error object
+func (this *FtpsWritableFs) Rename(_OldName_S string, _NewName_S string) (rRts error) {
+	if !fs.ValidPath(_OldName_S) || !fs.ValidPath(_NewName_S) {
+		rRts = &os.LinkError{Op: "rename", Old: _OldName_S, New: _NewName_S, Err: fs.ErrInvalid}
+	} else {
+		rRts = this.ftpsClientPtr_X.Rename(this.remotePath(_OldName_S), this.remotePath(_NewName_S))
+		if rRts != nil {
+			rRts = &os.LinkError{Op: "rename", Old: _OldName_S, New: _NewName_S, Err: toFsError(rRts)}
+		}
+	}
+	return
+}
+
+//Change the permission bits of the file or directory called '_Name_S' (SITE CHMOD)
+//Returns error object
+func (this *FtpsWritableFs) Chmod(_Name_S string, _Mode_X fs.FileMode) (rRts error) {
+	if !fs.ValidPath(_Name_S) {
+		rRts = &fs.PathError{Op: "chmod", Path: _Name_S, Err: fs.ErrInvalid}
+	} else {
+		rRts = this.ftpsClientPtr_X.ChangeMode(this.remotePath(_Name_S), _Mode_X)
+		if rRts != nil {
+			rRts = newFsPathError("chmod", _Name_S, rRts)
+		}
+	}
+	return
+}
+
+//Returns the name of the file as given to Open
+func (this *ftpsFsFile) Name() string {
+	return this.name_S
+}
+
+//A file opened for reading can't be written
+//Returns error object
+func (this *ftpsFsFile) Write(_DataArray_U8 []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: this.name_S, Err: fs.ErrPermission}
+}
+
+//Returns the name of the directory as given to Open
+func (this *ftpsFsDir) Name() string {
+	return this.name_S
+}
+
+//A directory can't be written
+//Returns error object
+func (this *ftpsFsDir) Write(_DataArray_U8 []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: this.name_S, Err: errors.New("is a directory")}
+}
+
+//Returns the name of the file as given to OpenFile
+func (this *ftpsFsWriter) Name() string {
+	return this.name_S
+}
+
+//Get information about the file being written: its size is the number of bytes written so far
+//Returns fs.FileInfo and error object
+func (this *ftpsFsWriter) Stat() (fs.FileInfo, error) {
+	return this.info_X, nil
+}
+
+//A file opened for writing can't be read
+//Returns error object
+func (this *ftpsFsWriter) Read(_DataArray_U8 []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: this.name_S, Err: fs.ErrPermission}
+}
+
+//Send the next part of the file to the ftp server
+//Returns number of byte written and error object
+func (this *ftpsFsWriter) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i = 0
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "write", Path: this.name_S, Err: fs.ErrClosed}
+	} else {
+		rNbWrite_i, rRts = this.writer_I.Write(_DataArray_U8)
+		this.info_X.dirEntry_X.Size_U64 += uint64(rNbWrite_i)
+		if rRts != nil {
+			rRts = &fs.PathError{Op: "write", Path: this.name_S, Err: rRts}
+		}
+	}
+	return
+}
+
+//Complete the transfer and wait for the ftp server acknowledge
+//Returns error object
+func (this *ftpsFsWriter) Close() (rRts error) {
+	rRts = nil
+	if this.closed_B {
+		rRts = &fs.PathError{Op: "close", Path: this.name_S, Err: fs.ErrClosed}
+	} else {
+		this.closed_B = true
+		rRts = this.writer_I.Close()
+		if rRts != nil {
+			rRts = &fs.PathError{Op: "close", Path: this.name_S, Err: rRts}
+		}
+	}
+	return
+}
@@ -0,0 +1,157 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' writable file system unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type FtpsWritableFsTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	ftpsFsPtr_X     *FtpsWritableFs
+}
+
+var _ = Suite(&FtpsWritableFsTestSuite{})
+
+func (s *FtpsWritableFsTestSuite) SetUpTest(c *C) {
+	var FtpsClientParam_X FtpsClientParam
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+
+	FtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.DataTimeout_S64 = 5000
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	Err = s.ftpsClientPtr_X.Connect()
+	if Err != nil {
+		c.Fatalf("Connect error: %v\n", Err)
+	}
+	s.ftpsFsPtr_X = NewFtpsWritableFs(s.ftpsClientPtr_X, "/Seq")
+}
+
+func (s *FtpsWritableFsTestSuite) TearDownTest(c *C) {
+	s.ftpsClientPtr_X.Disconnect()
+	s.ftpsServerPtr_X.Close()
+}
+
+//Write '_Data_S' in the file '_Name_S' opened with the flags '_Flag_i'
+func (s *FtpsWritableFsTestSuite) writeFile(c *C, _Name_S string, _Flag_i int, _Data_S string) {
+	File_I, Err := s.ftpsFsPtr_X.OpenFile(_Name_S, _Flag_i, 0644)
+	if Err != nil {
+		c.Fatalf("OpenFile error: %v\n", Err)
+	}
+	_, Err = io.WriteString(File_I, _Data_S)
+	if Err != nil {
+		c.Fatalf("Write error: %v\n", Err)
+	}
+	Err = File_I.Close()
+	if Err != nil {
+		c.Fatalf("Close error: %v\n", Err)
+	}
+}
+
+func (s *FtpsWritableFsTestSuite) TestCreate(c *C) {
+	File_I, Err := s.ftpsFsPtr_X.Create("clip.mxf")
+	if Err != nil {
+		c.Fatalf("Create error: %v\n", Err)
+	}
+	c.Assert(File_I.Name(), Equals, "clip.mxf")
+	_, Err = File_I.Write([]byte("0123"))
+	c.Assert(Err, IsNil)
+	_, Err = File_I.Write([]byte("456789"))
+	c.Assert(Err, IsNil)
+	FileInfo_I, Err := File_I.Stat()
+	c.Assert(Err, IsNil)
+	c.Assert(FileInfo_I.Size(), Equals, int64(10))
+	c.Assert(File_I.Close(), IsNil)
+	c.Assert(errors.Is(File_I.Close(), fs.ErrClosed), Equals, true)
+
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/clip.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+
+	//The file can be read back through the same file system
+	Data_U8, Err = fs.ReadFile(s.ftpsFsPtr_X, "clip.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+}
+
+func (s *FtpsWritableFsTestSuite) TestOpenFileFlags(c *C) {
+	s.writeFile(c, "log.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, "line 1\n")
+	s.writeFile(c, "log.txt", os.O_WRONLY|os.O_APPEND, "line 2\n")
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/log.txt")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "line 1\nline 2\n")
+
+	s.writeFile(c, "log.txt", os.O_WRONLY|os.O_TRUNC, "new")
+	Data_U8, Err = s.ftpsServerPtr_X.ReadFile("/Seq/log.txt")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "new")
+
+	_, Err = s.ftpsFsPtr_X.OpenFile("log.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	c.Assert(errors.Is(Err, fs.ErrExist), Equals, true)
+	_, Err = s.ftpsFsPtr_X.OpenFile("missing.txt", os.O_WRONLY, 0644)
+	c.Assert(errors.Is(Err, fs.ErrNotExist), Equals, true)
+	_, Err = s.ftpsFsPtr_X.OpenFile("log.txt", os.O_RDWR, 0644)
+	c.Assert(errors.Is(Err, fs.ErrInvalid), Equals, true)
+
+	File_I, Err := s.ftpsFsPtr_X.OpenFile("log.txt", os.O_RDONLY, 0)
+	c.Assert(Err, IsNil)
+	_, Err = File_I.Write([]byte("x"))
+	c.Assert(errors.Is(Err, fs.ErrPermission), Equals, true)
+	Data_U8, Err = io.ReadAll(File_I)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "new")
+	c.Assert(File_I.Close(), IsNil)
+}
+
+func (s *FtpsWritableFsTestSuite) TestMkdirRemove(c *C) {
+	c.Assert(s.ftpsFsPtr_X.Mkdir("shot", 0755), IsNil)
+	c.Assert(errors.Is(s.ftpsFsPtr_X.Mkdir("shot", 0755), fs.ErrExist), Equals, true)
+	s.writeFile(c, "shot/shot_0001.dpx", os.O_WRONLY|os.O_CREATE, "frame 1")
+
+	c.Assert(s.ftpsFsPtr_X.Remove("shot"), NotNil)
+	c.Assert(s.ftpsFsPtr_X.Remove("shot/shot_0001.dpx"), IsNil)
+	c.Assert(s.ftpsFsPtr_X.Remove("shot"), IsNil)
+	c.Assert(s.ftpsServerPtr_X.Exists("/Seq/shot"), Equals, false)
+	c.Assert(errors.Is(s.ftpsFsPtr_X.Remove("shot"), fs.ErrNotExist), Equals, true)
+}
+
+func (s *FtpsWritableFsTestSuite) TestRename(c *C) {
+	s.writeFile(c, "upload.tmp", os.O_WRONLY|os.O_CREATE, "media")
+	c.Assert(s.ftpsFsPtr_X.Mkdir("done", 0755), IsNil)
+	c.Assert(s.ftpsFsPtr_X.Rename("upload.tmp", "done/upload.mxf"), IsNil)
+	c.Assert(s.ftpsServerPtr_X.Exists("/Seq/upload.tmp"), Equals, false)
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/done/upload.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media")
+
+	Err = s.ftpsFsPtr_X.Rename("upload.tmp", "other.mxf")
+	c.Assert(errors.Is(Err, fs.ErrNotExist), Equals, true)
+}
+
+func (s *FtpsWritableFsTestSuite) TestChmod(c *C) {
+	s.writeFile(c, "script.sh", os.O_WRONLY|os.O_CREATE, "#!/bin/sh")
+	c.Assert(s.ftpsFsPtr_X.Chmod("script.sh", 0750), IsNil)
+	Mode_X, Err := s.ftpsServerPtr_X.Mode("/Seq/script.sh")
+	c.Assert(Err, IsNil)
+	c.Assert(Mode_X, Equals, fs.FileMode(0750))
+	c.Assert(errors.Is(s.ftpsFsPtr_X.Chmod("missing.sh", 0750), fs.ErrNotExist), Equals, true)
+}
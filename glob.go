@@ -0,0 +1,115 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+//Pattern element which matches zero or more directory levels
+const GLOB_ANY_LEVEL = "**"
+
+//Returns the list of remote paths matching '_Pattern_S'. The syntax is the one of path.Match, each '/' separated
+//element being matched against one directory level. The '**' element matches zero or more directory levels.
+//The pattern is evaluated with the 'LIST' command so it does not depend on the ftp server NLST glob support.
+//A relative pattern is evaluated from the current working ftp directory and gives relative paths
+//Returns the sorted matching remote paths and error object
+func (this *FtpsClient) Glob(_Pattern_S string) (rMatchArray_S []string, rRts error) {
+	var Root_S string
+	var ElementArray_S []string
+
+	rMatchArray_S = nil
+	rRts = nil
+	if strings.HasPrefix(_Pattern_S, "/") {
+		Root_S = "/"
+	}
+	for _, Element_S := range strings.Split(_Pattern_S, "/") {
+		if Element_S != "" {
+			if Element_S != GLOB_ANY_LEVEL {
+				if _, rRts = path.Match(Element_S, ""); rRts != nil {
+					return
+				}
+			}
+			ElementArray_S = append(ElementArray_S, Element_S)
+		}
+	}
+	//Leading elements without wildcard are joined to the root directory instead of being matched against the
+	//listing of their parent, the last one is kept to check that the path exists
+	for (len(ElementArray_S) > 1) && !hasGlobMeta(ElementArray_S[0]) {
+		Root_S = path.Join(Root_S, ElementArray_S[0])
+		ElementArray_S = ElementArray_S[1:]
+	}
+	if len(ElementArray_S) != 0 {
+		MatchMap_B := make(map[string]bool)
+		rRts = this.globDirectory(Root_S, ElementArray_S, make(map[string][]DirEntry), MatchMap_B)
+		if rRts == nil {
+			for Match_S := range MatchMap_B {
+				rMatchArray_S = append(rMatchArray_S, Match_S)
+			}
+			sort.Strings(rMatchArray_S)
+		}
+	}
+	return
+}
+
+//Match the pattern elements '_ElementArray_S' against the content of remote directory '_Directory_S'.
+//Directory listings are kept in '_ListCache_X' as '**' can visit the same directory several times
+//Returns error object, matching paths are added to '_MatchMap_B'
+func (this *FtpsClient) globDirectory(_Directory_S string, _ElementArray_S []string, _ListCache_X map[string][]DirEntry, _MatchMap_B map[string]bool) (rRts error) {
+	var DirEntryArray_X []DirEntry
+	var Ok_B, Match_B bool
+
+	DirEntryArray_X, Ok_B = _ListCache_X[_Directory_S]
+	if !Ok_B {
+		DirEntryArray_X, rRts = this.ListDirectory(_Directory_S)
+		if rRts != nil {
+			return
+		}
+		_ListCache_X[_Directory_S] = DirEntryArray_X
+	}
+
+	Element_S := _ElementArray_S[0]
+	Last_B := (len(_ElementArray_S) == 1)
+	if (Element_S == GLOB_ANY_LEVEL) && !Last_B {
+		//Zero level: the remaining elements apply to this directory
+		rRts = this.globDirectory(_Directory_S, _ElementArray_S[1:], _ListCache_X, _MatchMap_B)
+	}
+	for _, DirEntry_X := range DirEntryArray_X {
+		if rRts != nil {
+			break
+		}
+		Name_S := DirEntry_X.FullName()
+		if (Name_S == ".") || (Name_S == "..") || (Name_S == "") {
+			continue
+		}
+		Path_S := path.Join(_Directory_S, Name_S)
+		IsFolder_B := (DirEntry_X.Type_E == DIRENTRYTYPE_FOLDER)
+		if Element_S == GLOB_ANY_LEVEL {
+			if Last_B {
+				_MatchMap_B[Path_S] = true
+			}
+			if IsFolder_B {
+				rRts = this.globDirectory(Path_S, _ElementArray_S, _ListCache_X, _MatchMap_B)
+			}
+		} else {
+			Match_B, _ = path.Match(Element_S, Name_S)
+			if Match_B {
+				if Last_B {
+					_MatchMap_B[Path_S] = true
+				} else if IsFolder_B {
+					rRts = this.globDirectory(Path_S, _ElementArray_S[1:], _ListCache_X, _MatchMap_B)
+				}
+			}
+		}
+	}
+	return
+}
+
+//Returns true if the pattern element '_Element_S' contains a path.Match special character or is '**'
+func hasGlobMeta(_Element_S string) bool {
+	return strings.ContainsAny(_Element_S, "*?[\\")
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"net/textproto"
+	"time"
+)
+
+//Start the keep-alive goroutine if a KeepAliveInterval_S64 is defined
+func (this *FtpsClient) startKeepAlive() {
+	if this.FtpsParam_X.KeepAliveInterval_S64 > 0 {
+		this.keepAliveStopChan_X = make(chan bool)
+		this.keepAliveWaitGroup_X.Add(1)
+		go this.keepAlive(this.keepAliveStopChan_X, this.FtpsParam_X.KeepAliveInterval_S64*time.Millisecond)
+	}
+}
+
+//Stop the keep-alive goroutine and wait for its end
+func (this *FtpsClient) stopKeepAlive() {
+	if this.keepAliveStopChan_X != nil {
+		close(this.keepAliveStopChan_X)
+		this.keepAliveStopChan_X = nil
+		this.keepAliveWaitGroup_X.Wait()
+	}
+}
+
+//Keep-alive goroutine: check the control connection activity until '_StopChan_X' is closed
+func (this *FtpsClient) keepAlive(_StopChan_X chan bool, _Interval_S64 time.Duration) {
+	defer this.keepAliveWaitGroup_X.Done()
+
+	Ticker_X := time.NewTicker(_Interval_S64 / 4)
+	defer Ticker_X.Stop()
+	for {
+		select {
+		case <-_StopChan_X:
+			return
+		case <-Ticker_X.C:
+			this.sendKeepAlive(_Interval_S64)
+		}
+	}
+}
+
+//Send a NOOP command if the control connection has been idle for '_Interval_S64'. Nothing is done if the client is
+//used by another operation, except during a data transfer if KeepAliveDuringTransfer_B is true: the NOOP reply is
+//then not read here but by readTransferResponse
+func (this *FtpsClient) sendKeepAlive(_Interval_S64 time.Duration) {
+	if this.tryLock() {
+		this.ctrlMutex_X.Lock()
+		if (this.ctrlConnection_I != nil) && (time.Since(this.lastActivity_X) >= _Interval_S64) {
+			this.sendRequestToFtpServerLocked("NOOP", 200)
+		}
+		this.ctrlMutex_X.Unlock()
+		this.unlock()
+	} else if this.FtpsParam_X.KeepAliveDuringTransfer_B && this.ctrlMutex_X.TryLock() {
+		if (this.ctrlConnection_I != nil) && this.transferInProgress_B && (time.Since(this.lastActivity_X) >= _Interval_S64) {
+			this.debugInfo("command", "command", "NOOP", "transfer", true)
+			if this.ctrlConnection_I.SetDeadline(time.Now().Add(time.Duration(this.FtpsParam_X.CtrlTimeout_S64)*time.Millisecond)) == nil {
+				//A failure will be detected when the transfer reply is read
+				if _, Sts := this.textProtocolPtr_X.Cmd("NOOP"); Sts == nil {
+					this.emit(Event{Type_E: EVENTTYPE_COMMAND_SENT, Command_S: "NOOP"})
+					this.pendingNoop_i++
+				}
+			}
+			this.lastActivity_X = time.Now()
+		}
+		this.ctrlMutex_X.Unlock()
+	}
+}
+
+//Wait for the reply ending a data transfer. The replies of the NOOP commands sent by the keep-alive during the
+//transfer can be received before or after it: one reply is consumed per pending NOOP, whatever its code. The
+//transfer reply is the first one equal to '_ExpectedReplyCode_i', or else the first one which is not a 200 NOOP
+//reply. Success when '_ExpectedReplyCode_i' is detected (0 accepts any reply)
+//Returns error code, reply message and error object
+func (this *FtpsClient) readTransferResponse(_ExpectedReplyCode_i int) (rReplyCode_i int, rReplyMessage_S string, rRts error) {
+	var ReplyCode_i, Rank_i, BestRank_i int
+	var ReplyMessage_S string
+
+	this.ctrlMutex_X.Lock()
+	for i := 0; (rRts == nil) && (i <= this.pendingNoop_i); i++ {
+		ReplyCode_i, ReplyMessage_S, rRts = this.readFtpServerResponseLocked(0)
+		Rank_i = 1
+		if ReplyCode_i == _ExpectedReplyCode_i {
+			Rank_i = 3
+		} else if ReplyCode_i != 200 {
+			Rank_i = 2
+		}
+		if (Rank_i > BestRank_i) || (rRts != nil) {
+			BestRank_i = Rank_i
+			rReplyCode_i = ReplyCode_i
+			rReplyMessage_S = ReplyMessage_S
+		}
+	}
+	if (rRts == nil) && (_ExpectedReplyCode_i != 0) && (rReplyCode_i != _ExpectedReplyCode_i) {
+		rRts = &textproto.Error{Code: rReplyCode_i, Msg: rReplyMessage_S}
+	}
+	this.transferInProgress_B = false
+	this.pendingNoop_i = 0
+	if this.transferSpan_I != nil {
+		this.transferSpan_I.SetAttribute("ftp.reply_code", rReplyCode_i)
+		this.endTransferSpan(rRts)
+	}
+	this.endTransferEvent(rReplyCode_i, rReplyMessage_S, rRts)
+	this.ctrlMutex_X.Unlock()
+	return
+}
@@ -0,0 +1,167 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' keep-alive unit test.
+*/
+package ftpsclient
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type KeepAliveTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	mutex_X         sync.Mutex
+	noopCount_i     int
+}
+
+var _ = Suite(&KeepAliveTestSuite{})
+
+func (s *KeepAliveTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	Err = s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	if Err != nil {
+		c.Fatalf("MakeDirectory error: %v\n", Err)
+	}
+	s.noopCount_i = 0
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "NOOP" {
+			s.mutex_X.Lock()
+			s.noopCount_i++
+			s.mutex_X.Unlock()
+		}
+		return false
+	})
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *KeepAliveTestSuite) TearDownTest(c *C) {
+	if s.ftpsClientPtr_X != nil {
+		s.ftpsClientPtr_X.Disconnect()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client connected to the test server sending a NOOP after '_KeepAliveInterval_S64' ms of inactivity
+//Returns error object
+func (s *KeepAliveTestSuite) connect(_KeepAliveInterval_S64 time.Duration, _KeepAliveDuringTransfer_B bool) (rRts error) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.KeepAliveInterval_S64 = _KeepAliveInterval_S64
+	FtpsClientParam_X.KeepAliveDuringTransfer_B = _KeepAliveDuringTransfer_B
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	rRts = s.ftpsClientPtr_X.Connect()
+	return
+}
+
+//Returns the number of NOOP commands received by the server
+func (s *KeepAliveTestSuite) noopCount() (rCount_i int) {
+	s.mutex_X.Lock()
+	rCount_i = s.noopCount_i
+	s.mutex_X.Unlock()
+	return
+}
+
+//Upload a file as a stream which stays open for '_Duration_S64'
+func (s *KeepAliveTestSuite) slowStore(c *C, _Duration_S64 time.Duration) {
+	Writer_I, Err := s.ftpsClientPtr_X.StoreFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+	_, Err = Writer_I.Write([]byte("01234"))
+	c.Assert(Err, IsNil)
+	time.Sleep(_Duration_S64)
+	_, Err = Writer_I.Write([]byte("56789"))
+	c.Assert(Err, IsNil)
+	c.Assert(Writer_I.Close(), IsNil)
+
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/clip.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+}
+
+func (s *KeepAliveTestSuite) TestIdle(c *C) {
+	c.Assert(s.connect(40, false), IsNil)
+	time.Sleep(300 * time.Millisecond)
+	c.Assert(s.noopCount() >= 2, Equals, true)
+
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+
+	//No more NOOP once disconnected
+	c.Assert(s.ftpsClientPtr_X.Disconnect(), IsNil)
+	s.ftpsClientPtr_X = nil
+	Count_i := s.noopCount()
+	time.Sleep(150 * time.Millisecond)
+	c.Assert(s.noopCount(), Equals, Count_i)
+}
+
+func (s *KeepAliveTestSuite) TestDisabled(c *C) {
+	c.Assert(s.connect(0, false), IsNil)
+	time.Sleep(150 * time.Millisecond)
+	c.Assert(s.noopCount(), Equals, 0)
+}
+
+func (s *KeepAliveTestSuite) TestBusy(c *C) {
+	c.Assert(s.connect(100, false), IsNil)
+	for i := 0; i < 20; i++ {
+		_, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+		c.Assert(Err, IsNil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(s.noopCount(), Equals, 0)
+}
+
+func (s *KeepAliveTestSuite) TestDuringTransfer(c *C) {
+	c.Assert(s.connect(40, true), IsNil)
+	s.slowStore(c, 300*time.Millisecond)
+	c.Assert(s.noopCount() >= 2, Equals, true)
+
+	//The NOOP replies have been consumed: the control connection is still in sync
+	_, Err := s.ftpsClientPtr_X.GetFileSize("clip.mxf")
+	c.Assert(Err, IsNil)
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
+
+func (s *KeepAliveTestSuite) TestSkippedDuringTransfer(c *C) {
+	c.Assert(s.connect(40, false), IsNil)
+	s.slowStore(c, 300*time.Millisecond)
+	c.Assert(s.noopCount(), Equals, 0)
+
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
+
+func (s *KeepAliveTestSuite) TestNoopRefusedDuringTransfer(c *C) {
+	c.Assert(s.connect(40, true), IsNil)
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789")), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "NOOP", ReplyCode_i: 500, ReplyMessage_S: "NOOP refused", Count_i: 1})
+	Reader_I, Err := s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+	time.Sleep(300 * time.Millisecond)
+	Data_U8, Err := io.ReadAll(Reader_I)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+	//The 500 reply is the one of a NOOP, not the transfer reply
+	c.Assert(Reader_I.Close(), IsNil)
+	c.Assert(s.noopCount() >= 2, Equals, true)
+
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+}
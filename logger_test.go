@@ -0,0 +1,114 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' structured logger unit test.
+*/
+package ftpsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type LoggerTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	buffer_X        bytes.Buffer
+}
+
+var _ = Suite(&LoggerTestSuite{})
+
+func (s *LoggerTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.buffer_X.Reset()
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *LoggerTestSuite) TearDownTest(c *C) {
+	if s.ftpsClientPtr_X != nil {
+		s.ftpsClientPtr_X.Disconnect()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client of the test server logging to '_LoggerPtr_X'
+func (s *LoggerTestSuite) newClient(_LoggerPtr_X *slog.Logger) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.Id_U32 = 40
+	FtpsClientParam_X.Logger_X = _LoggerPtr_X
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the records written by the JSON logger
+func (s *LoggerTestSuite) recordArray(c *C) (rRecordArray_X []map[string]any) {
+	for _, Line_S := range strings.Split(strings.TrimSpace(s.buffer_X.String()), "\n") {
+		var Record_X map[string]any
+
+		c.Assert(json.Unmarshal([]byte(Line_S), &Record_X), IsNil)
+		rRecordArray_X = append(rRecordArray_X, Record_X)
+	}
+	return
+}
+
+func (s *LoggerTestSuite) TestStructuredField(c *C) {
+	s.newClient(slog.New(slog.NewJSONHandler(&s.buffer_X, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+	_, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+
+	Command_B := false
+	Reply_B := false
+	for _, Record_X := range s.recordArray(c) {
+		c.Assert(Record_X["level"], Equals, "DEBUG")
+		c.Assert(Record_X["id"], Equals, float64(40))
+		switch Record_X["msg"] {
+		case "command":
+			if Record_X["command"] == "PWD" {
+				Command_B = true
+			}
+		case "reply":
+			if Record_X["code"] == float64(257) {
+				Reply_B = true
+				c.Assert(Record_X["expected"], Equals, float64(257))
+				_, Ok_B := Record_X["duration"].(float64)
+				c.Assert(Ok_B, Equals, true)
+			}
+		}
+	}
+	c.Assert(Command_B, Equals, true)
+	c.Assert(Reply_B, Equals, true)
+}
+
+func (s *LoggerTestSuite) TestLevel(c *C) {
+	s.newClient(slog.New(slog.NewJSONHandler(&s.buffer_X, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+	c.Assert(s.buffer_X.Len(), Equals, 0)
+}
+
+func (s *LoggerTestSuite) TestGlobalLogUntouched(c *C) {
+	Flag_i := log.Flags()
+	Writer_X := log.Writer()
+	log.SetOutput(&s.buffer_X)
+	defer log.SetOutput(Writer_X)
+	log.SetFlags(log.LstdFlags)
+	defer log.SetFlags(Flag_i)
+
+	s.newClient(nil)
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+	c.Assert(log.Flags(), Equals, log.LstdFlags)
+	c.Assert(s.buffer_X.Len(), Equals, 0)
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+//Interface receiving the measures of the clients. It can be shared by several clients (a pool) and must be safe
+//for concurrent use
+type Metrics interface {
+	//Connection attempt to the ftp server, '_Err' is nil if the client is connected and logged in
+	ObserveConnect(_Err error)
+	//Ftp command '_Verb_S' answered with '_ReplyCode_i' (0 if no reply has been received) after '_Latency_S64'
+	ObserveCommand(_Verb_S string, _ReplyCode_i int, _Latency_S64 time.Duration)
+	//Bytes received and sent on a data connection
+	AddDataByte(_NbRead_U64 uint64, _NbWrite_U64 uint64)
+	//Delay between the start of a transfer and the first byte received on the data connection
+	ObserveDataWait(_Wait_S64 time.Duration)
+	//Transfer '_Verb_S' (RETR, STOR, LIST,...) ended after '_Duration_S64' when its data connection is closed
+	ObserveTransfer(_Verb_S string, _Duration_S64 time.Duration)
+}
+
+//Data connection giving its bytes, wait time and duration to the Metrics
+type metricsDataConn struct {
+	net.Conn
+	metrics_I   Metrics
+	verb_S      string
+	startTime_X time.Time
+	waiting_B   bool
+	closed_B    bool
+}
+
+//Returns the verb of the ftp command '_Request_S' in upper case
+func commandVerb(_Request_S string) string {
+	Verb_S, _, _ := strings.Cut(_Request_S, " ")
+	return strings.ToUpper(Verb_S)
+}
+
+//Give the result '_Err' of a connection attempt to the Metrics if they are defined
+func (this *FtpsClient) observeConnect(_Err error) {
+	if this.FtpsParam_X.Metrics_I != nil {
+		this.FtpsParam_X.Metrics_I.ObserveConnect(_Err)
+	}
+}
+
+//Give the reply '_ReplyCode_i' to the ftp command '_Request_S' sent at requestTime_X to the Metrics if they are
+//defined
+func (this *FtpsClient) observeCommand(_Request_S string, _ReplyCode_i int) {
+	if this.FtpsParam_X.Metrics_I != nil {
+		this.FtpsParam_X.Metrics_I.ObserveCommand(commandVerb(_Request_S), _ReplyCode_i, time.Since(this.requestTime_X))
+	}
+}
+
+//Wrap the data connection '_Connection_I' of the transfer started with '_Request_S' to measure it if Metrics are
+//defined
+//Returns the wrapped connection
+func (this *FtpsClient) newMetricsDataConn(_Connection_I net.Conn, _Request_S string) (rConnection_I net.Conn) {
+	rConnection_I = _Connection_I
+	if this.FtpsParam_X.Metrics_I != nil {
+		rConnection_I = &metricsDataConn{Conn: _Connection_I, metrics_I: this.FtpsParam_X.Metrics_I, verb_S: commandVerb(_Request_S), startTime_X: time.Now(), waiting_B: true}
+	}
+	return
+}
+
+//Read from the data connection and count the bytes received
+//Returns number of byte read and error object
+func (this *metricsDataConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	if rNbRead_i > 0 {
+		if this.waiting_B {
+			this.waiting_B = false
+			this.metrics_I.ObserveDataWait(time.Since(this.startTime_X))
+		}
+		this.metrics_I.AddDataByte(uint64(rNbRead_i), 0)
+	}
+	return
+}
+
+//Write to the data connection and count the bytes sent
+//Returns number of byte written and error object
+func (this *metricsDataConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i, rRts = this.Conn.Write(_DataArray_U8)
+	if rNbWrite_i > 0 {
+		this.metrics_I.AddDataByte(0, uint64(rNbWrite_i))
+	}
+	return
+}
+
+//Close the data connection and give the transfer duration
+//Returns error object
+func (this *metricsDataConn) Close() (rRts error) {
+	rRts = this.Conn.Close()
+	if !this.closed_B {
+		this.closed_B = true
+		this.metrics_I.ObserveTransfer(this.verb_S, time.Since(this.startTime_X))
+	}
+	return
+}
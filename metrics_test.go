@@ -0,0 +1,128 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' metrics unit test.
+*/
+package ftpsclient
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type MetricsTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	metricsPtr_X    *PrometheusMetrics
+}
+
+var _ = Suite(&MetricsTestSuite{})
+
+func (s *MetricsTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.metricsPtr_X = NewPrometheusMetrics("", nil)
+}
+
+func (s *MetricsTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of the test server logging in with '_LoginPassword_S' and measured by the suite metrics
+func (s *MetricsTestSuite) newClient(_LoginPassword_S string) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.LoginPassword_S = _LoginPassword_S
+	FtpsClientParam_X.Metrics_I = s.metricsPtr_X
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the metrics exposed by the http handler
+func (s *MetricsTestSuite) scrape(c *C) string {
+	ResponseRecorderPtr_X := httptest.NewRecorder()
+	s.metricsPtr_X.ServeHTTP(ResponseRecorderPtr_X, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(ResponseRecorderPtr_X.Code, Equals, 200)
+	c.Assert(strings.HasPrefix(ResponseRecorderPtr_X.Header().Get("Content-Type"), "text/plain; version=0.0.4"), Equals, true)
+	return ResponseRecorderPtr_X.Body.String()
+}
+
+func (s *MetricsTestSuite) TestClient(c *C) {
+	c.Assert(s.newClient("wrong").Connect(), NotNil)
+	FtpsClientPtr_X := s.newClient("a")
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content")), IsNil)
+	c.Assert(FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	c.Assert(FtpsClientPtr_X.DeleteFile("missing.mxf"), NotNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	Text_S := s.scrape(c)
+	for _, Line_S := range []string{
+		"# TYPE ftpsclient_commands_total counter",
+		`ftpsclient_commands_total{verb="PASS",code="230"} 1`,
+		`ftpsclient_commands_total{verb="PASS",code="530"} 1`,
+		`ftpsclient_commands_total{verb="STOR",code="150"} 1`,
+		`ftpsclient_commands_total{verb="RETR",code="150"} 1`,
+		`ftpsclient_commands_total{verb="DELE",code="550"} 1`,
+		"ftpsclient_connect_attempts_total 2",
+		"ftpsclient_connect_failures_total 1",
+		`ftpsclient_data_bytes_total{direction="received"} 13`,
+		`ftpsclient_data_bytes_total{direction="sent"} 13`,
+		"# TYPE ftpsclient_command_latency_seconds histogram",
+		`ftpsclient_command_latency_seconds_count{verb="PASV"} 2`,
+		`ftpsclient_command_latency_seconds_bucket{verb="PASV",le="+Inf"} 2`,
+		"ftpsclient_data_wait_seconds_count 1",
+		`ftpsclient_transfer_duration_seconds_count{verb="STOR"} 1`,
+		`ftpsclient_transfer_duration_seconds_count{verb="RETR"} 1`,
+	} {
+		c.Assert(strings.Contains(Text_S, Line_S+"\n"), Equals, true, Commentf("'%s' not found in\n%s", Line_S, Text_S))
+	}
+}
+
+func (s *MetricsTestSuite) TestHistogram(c *C) {
+	s.metricsPtr_X = NewPrometheusMetrics("media", nil)
+	s.metricsPtr_X.ObserveTransfer("RETR", 20*time.Millisecond)
+	s.metricsPtr_X.ObserveTransfer("RETR", 2*time.Second)
+	s.metricsPtr_X.ObserveTransfer("RETR", time.Hour)
+	Text_S := s.scrape(c)
+	for _, Line_S := range []string{
+		`media_transfer_duration_seconds_bucket{verb="RETR",le="0.01"} 0`,
+		`media_transfer_duration_seconds_bucket{verb="RETR",le="0.025"} 1`,
+		`media_transfer_duration_seconds_bucket{verb="RETR",le="2.5"} 2`,
+		`media_transfer_duration_seconds_bucket{verb="RETR",le="300"} 2`,
+		`media_transfer_duration_seconds_bucket{verb="RETR",le="+Inf"} 3`,
+		`media_transfer_duration_seconds_sum{verb="RETR"} 3602.02`,
+		`media_transfer_duration_seconds_count{verb="RETR"} 3`,
+		"media_connect_attempts_total 0",
+	} {
+		c.Assert(strings.Contains(Text_S, Line_S+"\n"), Equals, true, Commentf("'%s' not found in\n%s", Line_S, Text_S))
+	}
+}
+
+func (s *MetricsTestSuite) TestHistogramBucket(c *C) {
+	BucketArray_F64 := []float64{1, 0.1}
+	s.metricsPtr_X = NewPrometheusMetrics("media", BucketArray_F64)
+	//The buckets are copied: changing the slice of the caller has no effect
+	BucketArray_F64[0] = 60
+	BucketArray_F64 = append(BucketArray_F64, 600)
+	s.metricsPtr_X.ObserveTransfer("STOR", 500*time.Millisecond)
+	Text_S := s.scrape(c)
+	for _, Line_S := range []string{
+		`media_transfer_duration_seconds_bucket{verb="STOR",le="0.1"} 0`,
+		`media_transfer_duration_seconds_bucket{verb="STOR",le="1"} 1`,
+		`media_transfer_duration_seconds_bucket{verb="STOR",le="+Inf"} 1`,
+	} {
+		c.Assert(strings.Contains(Text_S, Line_S+"\n"), Equals, true, Commentf("'%s' not found in\n%s", Line_S, Text_S))
+	}
+	c.Assert(strings.Contains(Text_S, `le="60"`), Equals, false)
+	c.Assert(strings.Contains(Text_S, `le="600"`), Equals, false)
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"net"
+)
+
+//Choice of the host of the passive data connections
+type PASVPOLICY int
+
+const (
+	//Connect to the control host, the address of the PASV reply is ignored (NAT servers advertising a private one)
+	PASVPOLICY_CONTROL_HOST PASVPOLICY = iota
+	//Connect to the address of the PASV reply (servers sending the data connections to another host)
+	PASVPOLICY_ADVERTISED
+	//Connect to the address of the PASV reply if it is routable and not private, to the control host otherwise
+	//(protection against a PASV reply pointing to an internal host)
+	PASVPOLICY_ADVERTISED_PUBLIC
+)
+
+//Returns the name of the policy
+func (this PASVPOLICY) String() string {
+	switch this {
+	case PASVPOLICY_CONTROL_HOST:
+		return "control host"
+	case PASVPOLICY_ADVERTISED:
+		return "advertised"
+	case PASVPOLICY_ADVERTISED_PUBLIC:
+		return "advertised public"
+	}
+	return "unknown"
+}
+
+//Select the host of the data connection for the address '_Advertised_X' of the PASV reply according to the
+//PasvPolicy_E of the client. An unspecified, loopback or multicast address is never used whatever the policy: the
+//control host is used instead. A warning is logged if it is not the address of the control connection, when this
+//one is known. '_Advertised_X' is nil when the address of the reply can't be parsed (PASVPOLICY_CONTROL_HOST only)
+//Returns the host to connect to
+func (this *FtpsClient) selectPasvHost(_Advertised_X net.IP) (rHost_S string) {
+	rHost_S = this.FtpsParam_X.TargetHost_S
+	Control_X := this.controlIp()
+	if (_Advertised_X != nil) && !_Advertised_X.Equal(Control_X) {
+		switch this.FtpsParam_X.PasvPolicy_E {
+		case PASVPOLICY_ADVERTISED:
+			if isUsableIp(_Advertised_X) {
+				rHost_S = _Advertised_X.String()
+			}
+		case PASVPOLICY_ADVERTISED_PUBLIC:
+			if isPublicIp(_Advertised_X) {
+				rHost_S = _Advertised_X.String()
+			}
+		}
+		//0.0.0.0 is sent by the servers which do not know their address
+		if (Control_X != nil) && !_Advertised_X.IsUnspecified() {
+			this.warn("PASV address differs from the control address", "advertised", _Advertised_X.String(), "control", Control_X.String(), "policy", this.FtpsParam_X.PasvPolicy_E.String(), "host", rHost_S)
+		}
+	}
+	return
+}
+
+//Returns the ip address of the control host: TargetHost_S if it is an ip address, otherwise the remote address of
+//the control connection. It is nil if TargetHost_S is a host name reached with a DialContext: the remote address
+//can then be the one of a proxy
+func (this *FtpsClient) controlIp() (rIp_X net.IP) {
+	rIp_X = net.ParseIP(this.FtpsParam_X.TargetHost_S)
+	if (rIp_X == nil) && (this.FtpsParam_X.DialContext == nil) && (this.ctrlConnection_I != nil) {
+		if TcpAddrPtr_X, Ok_B := this.ctrlConnection_I.RemoteAddr().(*net.TCPAddr); Ok_B {
+			rIp_X = TcpAddrPtr_X.IP
+		}
+	}
+	return
+}
+
+//Returns true if a data connection can be opened to '_Ip_X': it is not an unspecified, loopback or multicast address
+func isUsableIp(_Ip_X net.IP) bool {
+	return !_Ip_X.IsUnspecified() && !_Ip_X.IsLoopback() && !_Ip_X.IsMulticast()
+}
+
+//Returns true if '_Ip_X' is a routable unicast address which is not private, loopback or link-local
+func isPublicIp(_Ip_X net.IP) bool {
+	return _Ip_X.IsGlobalUnicast() && !_Ip_X.IsPrivate()
+}
@@ -0,0 +1,202 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' passive mode address policy unit test.
+	The test server advertises a NAT address in its PASV replies. The data connections are redirected to it by
+	a DialContext recording the addresses asked by the client.
+*/
+package ftpsclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type PasvTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	mutex_X         sync.Mutex
+	hostArray_S     []string
+	log_X           bytes.Buffer
+}
+
+var _ = Suite(&PasvTestSuite{})
+
+func (s *PasvTestSuite) SetUpTest(c *C) {
+	s.hostArray_S = nil
+	s.log_X.Reset()
+}
+
+func (s *PasvTestSuite) TearDownTest(c *C) {
+	if s.ftpsServerPtr_X != nil {
+		s.ftpsServerPtr_X.Close()
+		s.ftpsServerPtr_X = nil
+	}
+}
+
+//Start the test server advertising '_PasvAddress_S' in its PASV replies
+func (s *PasvTestSuite) startServer(c *C, _PasvAddress_S string) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a", PasvAddress_S: _PasvAddress_S})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("media content"))
+}
+
+//Returns a client of the test server selecting the data host with '_PasvPolicy_E'
+func (s *PasvTestSuite) newClient(_PasvPolicy_E PASVPOLICY) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = true
+	FtpsClientParam_X.PasvPolicy_E = _PasvPolicy_E
+	FtpsClientParam_X.Logger_X = slog.New(slog.NewTextHandler(&s.log_X, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	FtpsClientParam_X.DialContext = func(_Context_X context.Context, _Network_S string, _Address_S string) (net.Conn, error) {
+		var Dialer_X net.Dialer
+
+		Host_S, Port_S, _ := net.SplitHostPort(_Address_S)
+		s.mutex_X.Lock()
+		s.hostArray_S = append(s.hostArray_S, Host_S)
+		s.mutex_X.Unlock()
+		//All the addresses lead to the test server
+		return Dialer_X.DialContext(_Context_X, _Network_S, net.JoinHostPort(s.ftpsServerPtr_X.Host(), Port_S))
+	}
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Retrieve the test file with a client using '_PasvPolicy_E'
+//Returns the host of the data connection and the warnings logged
+func (s *PasvTestSuite) retrieve(c *C, _PasvPolicy_E PASVPOLICY) (rHost_S string, rLog_S string) {
+	FtpsClientPtr_X := s.newClient(_PasvPolicy_E)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+	s.mutex_X.Lock()
+	c.Assert(s.hostArray_S, HasLen, 2)
+	c.Assert(s.hostArray_S[0], Equals, s.ftpsServerPtr_X.Host())
+	rHost_S = s.hostArray_S[1]
+	s.hostArray_S = nil
+	s.mutex_X.Unlock()
+	rLog_S = s.log_X.String()
+	s.log_X.Reset()
+	return
+}
+
+func (s *PasvTestSuite) TestSameAddress(c *C) {
+	s.startServer(c, "")
+	for _, PasvPolicy_E := range []PASVPOLICY{PASVPOLICY_CONTROL_HOST, PASVPOLICY_ADVERTISED, PASVPOLICY_ADVERTISED_PUBLIC} {
+		Host_S, Log_S := s.retrieve(c, PasvPolicy_E)
+		c.Assert(Host_S, Equals, "127.0.0.1")
+		c.Assert(Log_S, Equals, "")
+	}
+}
+
+func (s *PasvTestSuite) TestPrivateAddress(c *C) {
+	s.startServer(c, "10.1.2.3")
+	Host_S, Log_S := s.retrieve(c, PASVPOLICY_CONTROL_HOST)
+	c.Assert(Host_S, Equals, "127.0.0.1")
+	c.Assert(Log_S, Matches, "(?s).*level=WARN msg=\"PASV address differs from the control address\".*advertised=10.1.2.3 control=127.0.0.1 policy=\"control host\" host=127.0.0.1\n")
+	Host_S, Log_S = s.retrieve(c, PASVPOLICY_ADVERTISED)
+	c.Assert(Host_S, Equals, "10.1.2.3")
+	c.Assert(strings.Contains(Log_S, "host=10.1.2.3"), Equals, true, Commentf("%s", Log_S))
+	//A private address is refused
+	Host_S, Log_S = s.retrieve(c, PASVPOLICY_ADVERTISED_PUBLIC)
+	c.Assert(Host_S, Equals, "127.0.0.1")
+	c.Assert(strings.Contains(Log_S, "host=127.0.0.1"), Equals, true, Commentf("%s", Log_S))
+}
+
+func (s *PasvTestSuite) TestPublicAddress(c *C) {
+	s.startServer(c, "203.0.113.7")
+	Host_S, _ := s.retrieve(c, PASVPOLICY_CONTROL_HOST)
+	c.Assert(Host_S, Equals, "127.0.0.1")
+	Host_S, _ = s.retrieve(c, PASVPOLICY_ADVERTISED)
+	c.Assert(Host_S, Equals, "203.0.113.7")
+	Host_S, Log_S := s.retrieve(c, PASVPOLICY_ADVERTISED_PUBLIC)
+	c.Assert(Host_S, Equals, "203.0.113.7")
+	c.Assert(strings.Contains(Log_S, "advertised=203.0.113.7"), Equals, true, Commentf("%s", Log_S))
+}
+
+func (s *PasvTestSuite) TestUnusableAddress(c *C) {
+	for _, Address_S := range []string{"0.0.0.0", "127.0.0.2", "224.0.0.1"} {
+		s.startServer(c, Address_S)
+		for _, PasvPolicy_E := range []PASVPOLICY{PASVPOLICY_CONTROL_HOST, PASVPOLICY_ADVERTISED, PASVPOLICY_ADVERTISED_PUBLIC} {
+			Host_S, Log_S := s.retrieve(c, PasvPolicy_E)
+			c.Assert(Host_S, Equals, "127.0.0.1", Commentf("%s %s", Address_S, PasvPolicy_E))
+			//No warning for a server which does not know its address
+			c.Assert(Log_S == "", Equals, Address_S == "0.0.0.0", Commentf("%s", Log_S))
+		}
+		s.ftpsServerPtr_X.Close()
+	}
+	s.ftpsServerPtr_X = nil
+}
+
+func (s *PasvTestSuite) TestHostName(c *C) {
+	s.startServer(c, "10.1.2.3")
+	for _, PasvPolicy_E := range []PASVPOLICY{PASVPOLICY_CONTROL_HOST, PASVPOLICY_ADVERTISED} {
+		//The control address is unknown: the remote address of the connection may be the one of a proxy
+		FtpsClientPtr_X := s.newClient(PasvPolicy_E)
+		FtpsClientPtr_X.FtpsParam_X.TargetHost_S = "localhost"
+		c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+		c.Assert(FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+		c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+		s.mutex_X.Lock()
+		c.Assert(s.hostArray_S, HasLen, 2)
+		c.Assert(s.hostArray_S[1], Equals, map[PASVPOLICY]string{PASVPOLICY_CONTROL_HOST: "localhost", PASVPOLICY_ADVERTISED: "10.1.2.3"}[PasvPolicy_E])
+		s.hostArray_S = nil
+		s.mutex_X.Unlock()
+		c.Assert(s.log_X.String(), Equals, "")
+	}
+}
+
+func (s *PasvTestSuite) TestSpacedAddress(c *C) {
+	//The reply is 'Entering Passive Mode ( 10, 1, 2, 3,p1,p2)'
+	s.startServer(c, " 10. 1. 2. 3")
+	Host_S, _ := s.retrieve(c, PASVPOLICY_CONTROL_HOST)
+	c.Assert(Host_S, Equals, "127.0.0.1")
+	Host_S, _ = s.retrieve(c, PASVPOLICY_ADVERTISED)
+	c.Assert(Host_S, Equals, "10.1.2.3")
+}
+
+func (s *PasvTestSuite) TestUnparsableAddress(c *C) {
+	//The address is ignored by PASVPOLICY_CONTROL_HOST
+	s.startServer(c, "a.b.c.d")
+	Host_S, Log_S := s.retrieve(c, PASVPOLICY_CONTROL_HOST)
+	c.Assert(Host_S, Equals, "127.0.0.1")
+	c.Assert(Log_S, Equals, "")
+	for _, PasvPolicy_E := range []PASVPOLICY{PASVPOLICY_ADVERTISED, PASVPOLICY_ADVERTISED_PUBLIC} {
+		FtpsClientPtr_X := s.newClient(PasvPolicy_E)
+		c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+		_, Err := FtpsClientPtr_X.List()
+		c.Assert(errors.Is(Err, ErrPasv), Equals, true, Commentf("%s %v", PasvPolicy_E, Err))
+		c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+	}
+}
+
+func (s *PasvTestSuite) TestMalformedAddress(c *C) {
+	s.startServer(c, "")
+	FtpsClientPtr_X := s.newClient(PASVPOLICY_ADVERTISED)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "PASV", ReplyCode_i: 227, ReplyMessage_S: "Entering Passive Mode (127,0,0,300,4,1)", Count_i: 1})
+	_, Err := FtpsClientPtr_X.List()
+	c.Assert(errors.Is(Err, ErrPasv), Equals, true, Commentf("%v", Err))
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *PasvTestSuite) TestIsPublicIp(c *C) {
+	for Ip_S, Public_B := range map[string]bool{"203.0.113.7": true, "8.8.8.8": true, "10.0.0.1": false, "172.16.5.4": false, "192.168.1.1": false, "127.0.0.1": false, "169.254.1.1": false, "0.0.0.0": false, "224.0.0.1": false, "255.255.255.255": false} {
+		c.Assert(isPublicIp(net.ParseIP(Ip_S)), Equals, Public_B, Commentf("%s", Ip_S))
+	}
+	for Ip_S, Usable_B := range map[string]bool{"203.0.113.7": true, "10.0.0.1": true, "0.0.0.0": false, "::": false, "127.0.0.1": false, "127.0.0.2": false, "::1": false, "224.0.0.1": false, "ff02::1": false} {
+		c.Assert(isUsableIp(net.ParseIP(Ip_S)), Equals, Usable_B, Commentf("%s", Ip_S))
+	}
+}
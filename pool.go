@@ -0,0 +1,257 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//Error messages generated by the pool
+var (
+	ErrPoolClosed  = errors.New("Ftps: Pool is closed")
+	ErrPoolTimeout = errors.New("Ftps: No session available in the pool")
+)
+
+//Ftps client pool working parameters
+type FtpsClientPoolParam struct {
+	//Maximum number of sessions (idle and in use), 0 means no limit
+	MaxOpen_i int
+	//Maximum number of idle sessions kept in the pool, 0 means no limit
+	MaxIdle_i int
+	//Delay in ms after which an idle session is disconnected, 0 keeps them forever
+	IdleTimeout_S64 time.Duration
+	//Maximum delay in ms to wait for a session when MaxOpen_i is reached, 0 waits forever
+	WaitTimeout_S64 time.Duration
+	//Bandwidth limit shared by the data transfers of all the sessions in bytes per second (0 for no limit) with
+	//bursts of MaxBurst_U64 bytes. It can be changed at runtime with SetRateLimit
+	MaxRate_U64  uint64
+	MaxBurst_U64 uint64
+}
+
+//Idle session of the pool
+type pooledClient struct {
+	ftpsClientPtr_X *FtpsClient
+	idleSince_X     time.Time
+}
+
+//Pool of connected and logged in FtpsClient sessions sharing the same FtpsClientParam
+type FtpsClientPool struct {
+	FtpsParam_X FtpsClientParam
+	PoolParam_X FtpsClientPoolParam
+
+	mutex_X             sync.Mutex
+	cond_X              *sync.Cond
+	idleArray_X         []pooledClient
+	nbOpen_i            int
+	closed_B            bool
+	evictionStopChan_X  chan bool
+	evictionWaitGroup_X sync.WaitGroup
+	rateLimiterPtr_X    *RateLimiter
+}
+
+//Create a new FtpsClientPool giving sessions based on the parameters stored in _FtpsClientParamPtr_X
+//Returns pointer to FtpsClientPool
+func NewFtpsClientPool(_FtpsClientParamPtr_X *FtpsClientParam, _FtpsClientPoolParamPtr_X *FtpsClientPoolParam) *FtpsClientPool {
+	p := new(FtpsClientPool)
+	p.FtpsParam_X = *_FtpsClientParamPtr_X
+	p.PoolParam_X = *_FtpsClientPoolParamPtr_X
+	p.cond_X = sync.NewCond(&p.mutex_X)
+	p.rateLimiterPtr_X = NewRateLimiter(p.PoolParam_X.MaxRate_U64, p.PoolParam_X.MaxBurst_U64)
+	if p.PoolParam_X.IdleTimeout_S64 > 0 {
+		p.evictionStopChan_X = make(chan bool)
+		p.evictionWaitGroup_X.Add(1)
+		go p.evictIdle(p.evictionStopChan_X, p.PoolParam_X.IdleTimeout_S64*time.Millisecond)
+	}
+	return p
+}
+
+//Check out a session from the pool. An idle session is checked with a NOOP command before being given, a new one
+//is connected if none is available and MaxOpen_i is not reached, otherwise the call waits for a session to be put
+//back. The session must be given back with Put
+//Returns pointer to FtpsClient and error object (ErrPoolTimeout if no session is available after WaitTimeout_S64)
+func (this *FtpsClientPool) Get() (rFtpsClientPtr_X *FtpsClient, rRts error) {
+	var Timer_X *time.Timer
+	var TimedOut_B bool
+
+	rFtpsClientPtr_X = nil
+	rRts = nil
+	this.mutex_X.Lock()
+	if this.PoolParam_X.WaitTimeout_S64 > 0 {
+		Timer_X = time.AfterFunc(this.PoolParam_X.WaitTimeout_S64*time.Millisecond, func() {
+			this.mutex_X.Lock()
+			TimedOut_B = true
+			this.cond_X.Broadcast()
+			this.mutex_X.Unlock()
+		})
+	}
+	for (rFtpsClientPtr_X == nil) && (rRts == nil) {
+		if this.closed_B {
+			rRts = ErrPoolClosed
+		} else if len(this.idleArray_X) != 0 {
+			FtpsClientPtr_X := this.idleArray_X[len(this.idleArray_X)-1].ftpsClientPtr_X
+			this.idleArray_X = this.idleArray_X[:len(this.idleArray_X)-1]
+			this.mutex_X.Unlock()
+			_, _, Sts := FtpsClientPtr_X.SendFtpCtrlCommand("NOOP", 200)
+			if Sts != nil {
+				closeFtpsClient(FtpsClientPtr_X)
+			}
+			this.mutex_X.Lock()
+			if Sts == nil {
+				rFtpsClientPtr_X = FtpsClientPtr_X
+			} else {
+				this.release()
+			}
+		} else if (this.PoolParam_X.MaxOpen_i == 0) || (this.nbOpen_i < this.PoolParam_X.MaxOpen_i) {
+			this.nbOpen_i++
+			this.mutex_X.Unlock()
+			FtpsClientPtr_X := NewFtpsClient(&this.FtpsParam_X)
+			FtpsClientPtr_X.poolRateLimiterPtr_X = this.rateLimiterPtr_X
+			rRts = FtpsClientPtr_X.Connect()
+			this.mutex_X.Lock()
+			if rRts == nil {
+				rFtpsClientPtr_X = FtpsClientPtr_X
+			} else {
+				this.release()
+			}
+		} else if TimedOut_B {
+			rRts = ErrPoolTimeout
+		} else {
+			this.cond_X.Wait()
+		}
+	}
+	this.mutex_X.Unlock()
+	if Timer_X != nil {
+		Timer_X.Stop()
+	}
+	return
+}
+
+//Give back the session '_FtpsClientPtr_X' to the pool. Its working directory is reset to InitialDirectory_S, it is
+//disconnected if this fails, if MaxIdle_i sessions are already idle or if the pool is closed
+func (this *FtpsClientPool) Put(_FtpsClientPtr_X *FtpsClient) {
+	var Sts error
+
+	this.mutex_X.Lock()
+	Keep_B := !this.closed_B && ((this.PoolParam_X.MaxIdle_i == 0) || (len(this.idleArray_X) < this.PoolParam_X.MaxIdle_i))
+	this.mutex_X.Unlock()
+	if Keep_B {
+		Sts = _FtpsClientPtr_X.ChangeWorkingDirectory(this.FtpsParam_X.InitialDirectory_S)
+	}
+	this.mutex_X.Lock()
+	Keep_B = Keep_B && (Sts == nil) && !this.closed_B && ((this.PoolParam_X.MaxIdle_i == 0) || (len(this.idleArray_X) < this.PoolParam_X.MaxIdle_i))
+	if Keep_B {
+		this.idleArray_X = append(this.idleArray_X, pooledClient{ftpsClientPtr_X: _FtpsClientPtr_X, idleSince_X: time.Now()})
+		this.cond_X.Broadcast()
+	}
+	this.mutex_X.Unlock()
+	if !Keep_B {
+		closeFtpsClient(_FtpsClientPtr_X)
+		this.mutex_X.Lock()
+		this.release()
+		this.mutex_X.Unlock()
+	}
+}
+
+//Close the pool: the idle sessions are disconnected and the call waits for the sessions in use to be put back
+//Returns error object
+func (this *FtpsClientPool) Close() (rRts error) {
+	var IdleArray_X []pooledClient
+
+	rRts = nil
+	this.mutex_X.Lock()
+	if !this.closed_B {
+		this.closed_B = true
+		IdleArray_X = this.idleArray_X
+		this.idleArray_X = nil
+		this.cond_X.Broadcast()
+	}
+	this.mutex_X.Unlock()
+	this.discard(IdleArray_X)
+	this.mutex_X.Lock()
+	for this.nbOpen_i != 0 {
+		this.cond_X.Wait()
+	}
+	StopChan_X := this.evictionStopChan_X
+	this.evictionStopChan_X = nil
+	this.mutex_X.Unlock()
+	if StopChan_X != nil {
+		close(StopChan_X)
+		this.evictionWaitGroup_X.Wait()
+	}
+	return
+}
+
+//Returns the number of sessions opened by the pool (idle and in use) and the number of idle ones
+func (this *FtpsClientPool) Stat() (rNbOpen_i int, rNbIdle_i int) {
+	this.mutex_X.Lock()
+	rNbOpen_i = this.nbOpen_i
+	rNbIdle_i = len(this.idleArray_X)
+	this.mutex_X.Unlock()
+	return
+}
+
+//Change the bandwidth limit shared by the data transfers of all the sessions to '_Rate_U64' bytes per second (0 for
+//no limit) with bursts of '_Burst_U64' bytes. It applies to the transfers in progress
+func (this *FtpsClientPool) SetRateLimit(_Rate_U64 uint64, _Burst_U64 uint64) {
+	this.rateLimiterPtr_X.SetRate(_Rate_U64, _Burst_U64)
+}
+
+//Account for a session which has left the pool, the caller must hold mutex_X
+func (this *FtpsClientPool) release() {
+	this.nbOpen_i--
+	this.cond_X.Broadcast()
+}
+
+//Disconnect the idle sessions '_IdleArray_X' which leave the pool
+func (this *FtpsClientPool) discard(_IdleArray_X []pooledClient) {
+	for _, PooledClient_X := range _IdleArray_X {
+		closeFtpsClient(PooledClient_X.ftpsClientPtr_X)
+	}
+	this.mutex_X.Lock()
+	for range _IdleArray_X {
+		this.release()
+	}
+	this.mutex_X.Unlock()
+}
+
+//Disconnect the session '_FtpsClientPtr_X', its connections are closed even if the QUIT exchange fails
+func closeFtpsClient(_FtpsClientPtr_X *FtpsClient) {
+	if Sts := _FtpsClientPtr_X.Disconnect(); Sts != nil {
+		if _FtpsClientPtr_X.lock() == nil {
+			_FtpsClientPtr_X.dropConnection(Sts)
+			_FtpsClientPtr_X.unlock()
+		}
+	}
+}
+
+//Eviction goroutine: disconnect the sessions idle for more than '_IdleTimeout_S64' until '_StopChan_X' is closed
+func (this *FtpsClientPool) evictIdle(_StopChan_X chan bool, _IdleTimeout_S64 time.Duration) {
+	defer this.evictionWaitGroup_X.Done()
+
+	Ticker_X := time.NewTicker(_IdleTimeout_S64 / 2)
+	defer Ticker_X.Stop()
+	for {
+		select {
+		case <-_StopChan_X:
+			return
+		case <-Ticker_X.C:
+			var ExpiredArray_X, IdleArray_X []pooledClient
+
+			this.mutex_X.Lock()
+			for _, PooledClient_X := range this.idleArray_X {
+				if time.Since(PooledClient_X.idleSince_X) >= _IdleTimeout_S64 {
+					ExpiredArray_X = append(ExpiredArray_X, PooledClient_X)
+				} else {
+					IdleArray_X = append(IdleArray_X, PooledClient_X)
+				}
+			}
+			this.idleArray_X = IdleArray_X
+			this.mutex_X.Unlock()
+			this.discard(ExpiredArray_X)
+		}
+	}
+}
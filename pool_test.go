@@ -0,0 +1,229 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' session pool unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type FtpsClientPoolTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsPoolPtr_X   *FtpsClientPool
+	mutex_X         sync.Mutex
+	nbLogin_i       int
+}
+
+var _ = Suite(&FtpsClientPoolTestSuite{})
+
+func (s *FtpsClientPoolTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/shot/shot_0001.dpx", []byte("frame 1"))
+	s.nbLogin_i = 0
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "PASS" {
+			s.mutex_X.Lock()
+			s.nbLogin_i++
+			s.mutex_X.Unlock()
+		}
+		return false
+	})
+	s.ftpsPoolPtr_X = nil
+}
+
+func (s *FtpsClientPoolTestSuite) TearDownTest(c *C) {
+	if s.ftpsPoolPtr_X != nil {
+		s.ftpsPoolPtr_X.Close()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create the pool under test with the limits '_FtpsClientPoolParam_X'
+func (s *FtpsClientPoolTestSuite) newPool(_FtpsClientPoolParam_X FtpsClientPoolParam) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	s.ftpsPoolPtr_X = NewFtpsClientPool(&FtpsClientParam_X, &_FtpsClientPoolParam_X)
+}
+
+//Returns the number of logins received by the server
+func (s *FtpsClientPoolTestSuite) loginCount() (rCount_i int) {
+	s.mutex_X.Lock()
+	rCount_i = s.nbLogin_i
+	s.mutex_X.Unlock()
+	return
+}
+
+func (s *FtpsClientPoolTestSuite) TestReuse(c *C) {
+	s.newPool(FtpsClientPoolParam{})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+
+	FtpsClient2Ptr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClient2Ptr_X, Equals, FtpsClientPtr_X)
+	c.Assert(s.loginCount(), Equals, 1)
+	s.ftpsPoolPtr_X.Put(FtpsClient2Ptr_X)
+
+	NbOpen_i, NbIdle_i := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i, Equals, 1)
+	c.Assert(NbIdle_i, Equals, 1)
+}
+
+func (s *FtpsClientPoolTestSuite) TestWorkingDirectoryReset(c *C) {
+	s.newPool(FtpsClientPoolParam{})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClientPtr_X.ChangeWorkingDirectory("shot"), IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+
+	FtpsClientPtr_X, Err = s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	Directory_S, Err := FtpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq")
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+}
+
+func (s *FtpsClientPoolTestSuite) TestHealthCheck(c *C) {
+	s.newPool(FtpsClientPoolParam{})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+
+	//The idle session has been closed by the server
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "NOOP", ReplyCode_i: 421, ReplyMessage_S: "Timeout", Count_i: 1})
+	FtpsClient2Ptr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClient2Ptr_X == FtpsClientPtr_X, Equals, false)
+	c.Assert(s.loginCount(), Equals, 2)
+	_, Err = FtpsClient2Ptr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClient2Ptr_X)
+
+	NbOpen_i, _ := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i, Equals, 1)
+}
+
+func (s *FtpsClientPoolTestSuite) TestMaxOpen(c *C) {
+	s.newPool(FtpsClientPoolParam{MaxOpen_i: 2, WaitTimeout_S64: 50})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	FtpsClient2Ptr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	_, Err = s.ftpsPoolPtr_X.Get()
+	c.Assert(errors.Is(Err, ErrPoolTimeout), Equals, true)
+
+	//The waiting call gets the session put back
+	s.ftpsPoolPtr_X.PoolParam_X.WaitTimeout_S64 = 0
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.ftpsPoolPtr_X.Put(FtpsClient2Ptr_X)
+	}()
+	FtpsClient3Ptr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClient3Ptr_X, Equals, FtpsClient2Ptr_X)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+	s.ftpsPoolPtr_X.Put(FtpsClient3Ptr_X)
+	c.Assert(s.loginCount(), Equals, 2)
+}
+
+func (s *FtpsClientPoolTestSuite) TestMaxIdle(c *C) {
+	var FtpsClientArray_X [3]*FtpsClient
+	var Err error
+
+	s.newPool(FtpsClientPoolParam{MaxIdle_i: 1})
+	for i := range FtpsClientArray_X {
+		FtpsClientArray_X[i], Err = s.ftpsPoolPtr_X.Get()
+		c.Assert(Err, IsNil)
+	}
+	for i := range FtpsClientArray_X {
+		s.ftpsPoolPtr_X.Put(FtpsClientArray_X[i])
+	}
+	NbOpen_i, NbIdle_i := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i, Equals, 1)
+	c.Assert(NbIdle_i, Equals, 1)
+}
+
+func (s *FtpsClientPoolTestSuite) TestIdleEviction(c *C) {
+	s.newPool(FtpsClientPoolParam{IdleTimeout_S64: 40})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+	time.Sleep(200 * time.Millisecond)
+
+	NbOpen_i, NbIdle_i := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i, Equals, 0)
+	c.Assert(NbIdle_i, Equals, 0)
+}
+
+func (s *FtpsClientPoolTestSuite) TestClose(c *C) {
+	s.newPool(FtpsClientPoolParam{})
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	FtpsClient2Ptr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	s.ftpsPoolPtr_X.Put(FtpsClient2Ptr_X)
+
+	//Close waits for the session in use
+	DoneChan_X := make(chan error)
+	go func() {
+		DoneChan_X <- s.ftpsPoolPtr_X.Close()
+	}()
+	select {
+	case <-DoneChan_X:
+		c.Fatalf("Close has not waited for the session in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, Err = s.ftpsPoolPtr_X.Get()
+	c.Assert(errors.Is(Err, ErrPoolClosed), Equals, true)
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+	c.Assert(<-DoneChan_X, IsNil)
+
+	NbOpen_i, _ := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i, Equals, 0)
+	c.Assert(FtpsClientPtr_X.isConnEstablished(), Equals, ErrNotConnected)
+}
+
+func (s *FtpsClientPoolTestSuite) TestParallelStore(c *C) {
+	var WaitGroup_X sync.WaitGroup
+
+	s.newPool(FtpsClientPoolParam{MaxOpen_i: 4, MaxIdle_i: 4})
+	ErrArray_X := make([]error, 32)
+	for i := range ErrArray_X {
+		WaitGroup_X.Add(1)
+		go func(_Id_i int) {
+			defer WaitGroup_X.Done()
+			FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+			if Err == nil {
+				Err = FtpsClientPtr_X.StoreFile(fmt.Sprintf("clip_%02d.mxf", _Id_i), []byte("media"))
+				s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+			}
+			ErrArray_X[_Id_i] = Err
+		}(i)
+	}
+	WaitGroup_X.Wait()
+	for _, Err := range ErrArray_X {
+		c.Assert(Err, IsNil)
+	}
+	for i := range ErrArray_X {
+		c.Assert(s.ftpsServerPtr_X.Exists(fmt.Sprintf("/Seq/clip_%02d.mxf", i)), Equals, true)
+	}
+	NbOpen_i, _ := s.ftpsPoolPtr_X.Stat()
+	c.Assert(NbOpen_i <= 4, Equals, true)
+	c.Assert(s.loginCount() <= 4, Equals, true)
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+//Maximum number of bytes transferred at once on a data connection when the progress is reported or limited
+const dataBlockSize_i = 32 * 1024
+
+//Progress of a data channel transfer given to the OnProgress callback
+type TransferProgress struct {
+	Id_U32    uint32
+	Request_S string
+	//Number of bytes done including the restart (REST) offset
+	NbByte_U64 uint64
+	//Expected size of the file, 0 if unknown
+	Total_U64 uint64
+	//Rate in bytes per second since the previous report and since the start of the transfer
+	InstantRate_F64 float64
+	AverageRate_F64 float64
+	Elapsed_S64     time.Duration
+	//Last report of the transfer: the data channel is closed
+	Done_B bool
+}
+
+//Data connection counting the bytes transferred and calling the OnProgress callback
+type progressConn struct {
+	net.Conn
+	ftpsClientPtr_X *FtpsClient
+	progress_X      TransferProgress
+	startTime_X     time.Time
+	reportTime_X    time.Time
+	startByte_U64   uint64
+	reportByte_U64  uint64
+}
+
+//Wrap the data connection '_Connection_I' of the transfer started with '_Request_S' at '_Offset_U64' to report its
+//progress. '_Total_U64' is the expected file size (0 if unknown)
+//Returns the wrapped connection
+func (this *FtpsClient) newProgressConn(_Connection_I net.Conn, _Request_S string, _Offset_U64 uint64, _Total_U64 uint64) (rConnection_I net.Conn) {
+	p := &progressConn{Conn: _Connection_I, ftpsClientPtr_X: this, startByte_U64: _Offset_U64, reportByte_U64: _Offset_U64}
+	p.progress_X.Id_U32 = this.FtpsParam_X.Id_U32
+	p.progress_X.Request_S = _Request_S
+	p.progress_X.NbByte_U64 = _Offset_U64
+	p.progress_X.Total_U64 = _Total_U64
+	p.startTime_X = time.Now()
+	p.reportTime_X = p.startTime_X
+	rConnection_I = p
+	return
+}
+
+//Set the expected size '_Total_U64' of the transfer in progress when it is known by the caller (STOR)
+func (this *FtpsClient) setTransferTotal(_Total_U64 uint64) {
+	if pConnection_X, Ok_B := this.dataConnection_I.(*progressConn); Ok_B {
+		pConnection_X.progress_X.Total_U64 = _Total_U64
+	}
+}
+
+//Read from the data connection and count the bytes received
+//Returns number of byte read and error object
+func (this *progressConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	this.update(rNbRead_i)
+	return
+}
+
+//Write to the data connection by blocks of dataBlockSize_i bytes and count the bytes sent
+//Returns number of byte written and error object
+func (this *progressConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	var NbWrite_i int
+
+	rNbWrite_i = 0
+	for (rRts == nil) && (rNbWrite_i < len(_DataArray_U8)) {
+		End_i := rNbWrite_i + dataBlockSize_i
+		if End_i > len(_DataArray_U8) {
+			End_i = len(_DataArray_U8)
+		}
+		NbWrite_i, rRts = this.Conn.Write(_DataArray_U8[rNbWrite_i:End_i])
+		rNbWrite_i += NbWrite_i
+		this.update(NbWrite_i)
+	}
+	return
+}
+
+//Close the data connection and give the last report of the transfer
+//Returns error object
+func (this *progressConn) Close() (rRts error) {
+	rRts = this.Conn.Close()
+	if !this.progress_X.Done_B {
+		this.progress_X.Done_B = true
+		this.report(time.Now())
+	}
+	return
+}
+
+//Count '_NbByte_i' more bytes and report the progress if ProgressInterval_S64 has elapsed since the previous report
+func (this *progressConn) update(_NbByte_i int) {
+	if _NbByte_i > 0 {
+		this.progress_X.NbByte_U64 += uint64(_NbByte_i)
+		Now_X := time.Now()
+		if Now_X.Sub(this.reportTime_X) >= this.ftpsClientPtr_X.FtpsParam_X.ProgressInterval_S64*time.Millisecond {
+			this.report(Now_X)
+		}
+	}
+}
+
+//Compute the rates at '_Now_X' and call the OnProgress callback
+func (this *progressConn) report(_Now_X time.Time) {
+	this.progress_X.Elapsed_S64 = _Now_X.Sub(this.startTime_X)
+	this.progress_X.InstantRate_F64 = byteRate(this.progress_X.NbByte_U64-this.reportByte_U64, _Now_X.Sub(this.reportTime_X))
+	this.progress_X.AverageRate_F64 = byteRate(this.progress_X.NbByte_U64-this.startByte_U64, this.progress_X.Elapsed_S64)
+	this.reportTime_X = _Now_X
+	this.reportByte_U64 = this.progress_X.NbByte_U64
+	this.ftpsClientPtr_X.FtpsParam_X.OnProgress(this.progress_X)
+}
+
+//Returns the rate in bytes per second of '_NbByte_U64' bytes transferred in '_Duration_S64'
+func byteRate(_NbByte_U64 uint64, _Duration_S64 time.Duration) (rRate_F64 float64) {
+	rRate_F64 = 0
+	if _Duration_S64 > 0 {
+		rRate_F64 = float64(_NbByte_U64) / _Duration_S64.Seconds()
+	}
+	return
+}
+
+//Extract the file size from a transfer reply such as '150 Opening BINARY mode data connection for f (1234 bytes)'
+//Returns the size, 0 if the reply does not give it
+func parseTransferSize(_ReplyMessage_S string) (rSize_U64 uint64) {
+	rSize_U64 = 0
+	if Pos_i := strings.LastIndex(_ReplyMessage_S, "("); Pos_i >= 0 {
+		if _, Sts := fmt.Sscanf(_ReplyMessage_S[Pos_i:], "(%d bytes)", &rSize_U64); Sts != nil {
+			rSize_U64 = 0
+		}
+	}
+	return
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' transfer progress unit test.
+*/
+package ftpsclient
+
+import (
+	"io"
+	"math/rand"
+	"path/filepath"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type ProgressTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	progressArray_X []TransferProgress
+	data_U8         []byte
+}
+
+var _ = Suite(&ProgressTestSuite{})
+
+func (s *ProgressTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.data_U8 = make([]byte, 256*1024+3)
+	rand.New(rand.NewSource(1)).Read(s.data_U8)
+	s.progressArray_X = nil
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *ProgressTestSuite) TearDownTest(c *C) {
+	if s.ftpsClientPtr_X != nil {
+		s.ftpsClientPtr_X.Disconnect()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client connected to the test server reporting the progress every '_ProgressInterval_S64' ms
+func (s *ProgressTestSuite) connect(c *C, _ProgressInterval_S64 time.Duration) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.Id_U32 = 38
+	FtpsClientParam_X.ProgressInterval_S64 = _ProgressInterval_S64
+	FtpsClientParam_X.OnProgress = func(_Progress_X TransferProgress) {
+		s.progressArray_X = append(s.progressArray_X, _Progress_X)
+	}
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+}
+
+//Check the reports of a single transfer started with '_Request_S' which has moved '_NbByte_U64' bytes
+//Returns the last report
+func (s *ProgressTestSuite) checkProgress(c *C, _Request_S string, _NbByte_U64 uint64) (rProgress_X TransferProgress) {
+	var NbByte_U64 uint64
+
+	c.Assert(len(s.progressArray_X) > 0, Equals, true)
+	NbByte_U64 = 0
+	for i, Progress_X := range s.progressArray_X {
+		c.Assert(Progress_X.Id_U32, Equals, uint32(38))
+		c.Assert(Progress_X.Request_S, Equals, _Request_S)
+		c.Assert(Progress_X.NbByte_U64 >= NbByte_U64, Equals, true)
+		c.Assert(Progress_X.Done_B, Equals, i == len(s.progressArray_X)-1)
+		c.Assert(Progress_X.InstantRate_F64 >= 0, Equals, true)
+		NbByte_U64 = Progress_X.NbByte_U64
+	}
+	rProgress_X = s.progressArray_X[len(s.progressArray_X)-1]
+	c.Assert(rProgress_X.NbByte_U64, Equals, _NbByte_U64)
+	c.Assert(rProgress_X.Elapsed_S64 > 0, Equals, true)
+	c.Assert(rProgress_X.AverageRate_F64 > 0, Equals, true)
+	return
+}
+
+func (s *ProgressTestSuite) TestStoreFile(c *C) {
+	s.connect(c, 0)
+	c.Assert(s.ftpsClientPtr_X.StoreFile("clip.mxf", s.data_U8), IsNil)
+	Progress_X := s.checkProgress(c, "STOR clip.mxf", uint64(len(s.data_U8)))
+	c.Assert(Progress_X.Total_U64, Equals, uint64(len(s.data_U8)))
+	//The data are written by blocks which are all reported
+	c.Assert(len(s.progressArray_X) > len(s.data_U8)/dataBlockSize_i, Equals, true)
+}
+
+func (s *ProgressTestSuite) TestRetrieveFile(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 0)
+	c.Assert(s.ftpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	Progress_X := s.checkProgress(c, "RETR clip.mxf", uint64(len(s.data_U8)))
+	//The size is given by the '150' reply
+	c.Assert(Progress_X.Total_U64, Equals, uint64(len(s.data_U8)))
+}
+
+func (s *ProgressTestSuite) TestInterval(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 3600*1000)
+	c.Assert(s.ftpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	//Only the final report is given
+	c.Assert(len(s.progressArray_X), Equals, 1)
+	s.checkProgress(c, "RETR clip.mxf", uint64(len(s.data_U8)))
+}
+
+func (s *ProgressTestSuite) TestList(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 0)
+	DirEntryArray_X, Err := s.ftpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(len(DirEntryArray_X), Equals, 1)
+	c.Assert(len(s.progressArray_X) > 0, Equals, true)
+	NbByte_U64 := s.progressArray_X[len(s.progressArray_X)-1].NbByte_U64
+	c.Assert(NbByte_U64 > 0, Equals, true)
+	Progress_X := s.checkProgress(c, "LIST -a", NbByte_U64)
+	c.Assert(Progress_X.Total_U64, Equals, uint64(0))
+}
+
+func (s *ProgressTestSuite) TestStream(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 0)
+	Reader_I, Err := s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+	Data_U8, Err := io.ReadAll(Reader_I)
+	c.Assert(Err, IsNil)
+	c.Assert(Reader_I.Close(), IsNil)
+	c.Assert(Data_U8, DeepEquals, s.data_U8)
+	s.checkProgress(c, "RETR clip.mxf", uint64(len(s.data_U8)))
+
+	s.progressArray_X = nil
+	_, _, Err = s.ftpsClientPtr_X.OpenFtpDataChannel("RETR clip.mxf", 150)
+	c.Assert(Err, IsNil)
+	_, _, NbRead_i, Err := s.ftpsClientPtr_X.ReadFtpDataChannel(false, make([]byte, 1000))
+	c.Assert(Err, IsNil)
+	c.Assert(NbRead_i, Equals, 1000)
+	c.Assert(s.progressArray_X[len(s.progressArray_X)-1].NbByte_U64, Equals, uint64(1000))
+	s.ftpsClientPtr_X.CloseFtpDataChannel()
+	c.Assert(s.progressArray_X[len(s.progressArray_X)-1].Done_B, Equals, true)
+}
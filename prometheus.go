@@ -0,0 +1,193 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Default upper bounds in seconds of the histogram buckets of the PrometheusMetrics
+var defaultBucketArray_F64 = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+//Cumulative histogram of durations
+type histogram struct {
+	countArray_U64 []uint64
+	sum_F64        float64
+	count_U64      uint64
+}
+
+//Metrics implementation keeping the measures in memory and exposing them in the Prometheus text format. It is an
+//http.Handler which can be registered on the '/metrics' path of an http server
+type PrometheusMetrics struct {
+	mutex_X              sync.Mutex
+	namespace_S          string
+	bucketArray_F64      []float64
+	commandMap_X         map[[2]string]uint64
+	nbConnect_U64        uint64
+	nbConnectFailure_U64 uint64
+	nbByteRead_U64       uint64
+	nbByteWrite_U64      uint64
+	commandLatencyMap_X  map[string]*histogram
+	dataWaitMap_X        map[string]*histogram
+	transferMap_X        map[string]*histogram
+}
+
+//Create a new PrometheusMetrics whose metric names start with '_Namespace_S' ('ftpsclient' if empty) and whose
+//histograms use the bucket upper bounds in seconds of '_BucketArray_F64' (default buckets from 5ms to 300s if empty).
+//The bounds are copied and sorted
+//Returns pointer to PrometheusMetrics
+func NewPrometheusMetrics(_Namespace_S string, _BucketArray_F64 []float64) *PrometheusMetrics {
+	p := new(PrometheusMetrics)
+	p.namespace_S = _Namespace_S
+	if p.namespace_S == "" {
+		p.namespace_S = "ftpsclient"
+	}
+	if len(_BucketArray_F64) == 0 {
+		_BucketArray_F64 = defaultBucketArray_F64
+	}
+	p.bucketArray_F64 = append([]float64(nil), _BucketArray_F64...)
+	sort.Float64s(p.bucketArray_F64)
+	p.commandMap_X = make(map[[2]string]uint64)
+	p.commandLatencyMap_X = make(map[string]*histogram)
+	p.dataWaitMap_X = make(map[string]*histogram)
+	p.transferMap_X = make(map[string]*histogram)
+	return p
+}
+
+//Count a connection attempt and its failure
+func (this *PrometheusMetrics) ObserveConnect(_Err error) {
+	this.mutex_X.Lock()
+	this.nbConnect_U64++
+	if _Err != nil {
+		this.nbConnectFailure_U64++
+	}
+	this.mutex_X.Unlock()
+}
+
+//Count the command by verb and reply code and add its latency to the histogram of the verb
+func (this *PrometheusMetrics) ObserveCommand(_Verb_S string, _ReplyCode_i int, _Latency_S64 time.Duration) {
+	this.mutex_X.Lock()
+	this.commandMap_X[[2]string{_Verb_S, strconv.Itoa(_ReplyCode_i)}]++
+	this.observe(this.commandLatencyMap_X, _Verb_S, _Latency_S64)
+	this.mutex_X.Unlock()
+}
+
+//Count the bytes received and sent on the data connections
+func (this *PrometheusMetrics) AddDataByte(_NbRead_U64 uint64, _NbWrite_U64 uint64) {
+	this.mutex_X.Lock()
+	this.nbByteRead_U64 += _NbRead_U64
+	this.nbByteWrite_U64 += _NbWrite_U64
+	this.mutex_X.Unlock()
+}
+
+//Add the data wait time to its histogram
+func (this *PrometheusMetrics) ObserveDataWait(_Wait_S64 time.Duration) {
+	this.mutex_X.Lock()
+	this.observe(this.dataWaitMap_X, "", _Wait_S64)
+	this.mutex_X.Unlock()
+}
+
+//Add the transfer duration to the histogram of the verb
+func (this *PrometheusMetrics) ObserveTransfer(_Verb_S string, _Duration_S64 time.Duration) {
+	this.mutex_X.Lock()
+	this.observe(this.transferMap_X, _Verb_S, _Duration_S64)
+	this.mutex_X.Unlock()
+}
+
+//Write the metrics in the Prometheus text exposition format
+func (this *PrometheusMetrics) ServeHTTP(_ResponseWriter_I http.ResponseWriter, _RequestPtr_X *http.Request) {
+	var Buffer_X bytes.Buffer
+
+	this.mutex_X.Lock()
+	Name_S := this.namespace_S + "_commands_total"
+	fmt.Fprintf(&Buffer_X, "# HELP %s Ftp commands sent by verb and reply code.\n# TYPE %s counter\n", Name_S, Name_S)
+	KeyArray_X := make([][2]string, 0, len(this.commandMap_X))
+	for Key_X := range this.commandMap_X {
+		KeyArray_X = append(KeyArray_X, Key_X)
+	}
+	sort.Slice(KeyArray_X, func(i, j int) bool {
+		return (KeyArray_X[i][0] < KeyArray_X[j][0]) || ((KeyArray_X[i][0] == KeyArray_X[j][0]) && (KeyArray_X[i][1] < KeyArray_X[j][1]))
+	})
+	for _, Key_X := range KeyArray_X {
+		fmt.Fprintf(&Buffer_X, "%s{verb=\"%s\",code=\"%s\"} %d\n", Name_S, escapeLabel(Key_X[0]), Key_X[1], this.commandMap_X[Key_X])
+	}
+	writeCounter(&Buffer_X, this.namespace_S+"_connect_attempts_total", "Connection attempts to the ftp server.", "", this.nbConnect_U64)
+	writeCounter(&Buffer_X, this.namespace_S+"_connect_failures_total", "Failed connection attempts to the ftp server.", "", this.nbConnectFailure_U64)
+	Name_S = this.namespace_S + "_data_bytes_total"
+	writeCounter(&Buffer_X, Name_S, "Bytes transferred on the data connections.", "direction=\"received\"", this.nbByteRead_U64)
+	fmt.Fprintf(&Buffer_X, "%s{direction=\"sent\"} %d\n", Name_S, this.nbByteWrite_U64)
+	this.writeHistogram(&Buffer_X, this.namespace_S+"_command_latency_seconds", "Delay between a ftp command and its reply.", "verb", this.commandLatencyMap_X)
+	this.writeHistogram(&Buffer_X, this.namespace_S+"_data_wait_seconds", "Delay between the start of a transfer and its first byte received.", "", this.dataWaitMap_X)
+	this.writeHistogram(&Buffer_X, this.namespace_S+"_transfer_duration_seconds", "Duration of the data channel transfers.", "verb", this.transferMap_X)
+	this.mutex_X.Unlock()
+
+	_ResponseWriter_I.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ResponseWriter_I.Write(Buffer_X.Bytes())
+}
+
+//Add '_Duration_S64' to the histogram of '_HistogramMap_X' with the label value '_Label_S'
+func (this *PrometheusMetrics) observe(_HistogramMap_X map[string]*histogram, _Label_S string, _Duration_S64 time.Duration) {
+	pHistogram_X, Ok_B := _HistogramMap_X[_Label_S]
+	if !Ok_B {
+		pHistogram_X = &histogram{countArray_U64: make([]uint64, len(this.bucketArray_F64))}
+		_HistogramMap_X[_Label_S] = pHistogram_X
+	}
+	Second_F64 := _Duration_S64.Seconds()
+	for i, Bound_F64 := range this.bucketArray_F64 {
+		if Second_F64 <= Bound_F64 {
+			pHistogram_X.countArray_U64[i]++
+		}
+	}
+	pHistogram_X.sum_F64 += Second_F64
+	pHistogram_X.count_U64++
+}
+
+//Write the counter '_Name_S' with its help text '_Help_S' and the value '_Value_U64' for the labels '_Label_S'
+func writeCounter(_Buffer_X *bytes.Buffer, _Name_S string, _Help_S string, _Label_S string, _Value_U64 uint64) {
+	fmt.Fprintf(_Buffer_X, "# HELP %s %s\n# TYPE %s counter\n", _Name_S, _Help_S, _Name_S)
+	if _Label_S != "" {
+		_Label_S = "{" + _Label_S + "}"
+	}
+	fmt.Fprintf(_Buffer_X, "%s%s %d\n", _Name_S, _Label_S, _Value_U64)
+}
+
+//Write the histograms '_HistogramMap_X' named '_Name_S' whose map key is the value of the label '_LabelName_S'
+func (this *PrometheusMetrics) writeHistogram(_Buffer_X *bytes.Buffer, _Name_S string, _Help_S string, _LabelName_S string, _HistogramMap_X map[string]*histogram) {
+	fmt.Fprintf(_Buffer_X, "# HELP %s %s\n# TYPE %s histogram\n", _Name_S, _Help_S, _Name_S)
+	LabelArray_S := make([]string, 0, len(_HistogramMap_X))
+	for Label_S := range _HistogramMap_X {
+		LabelArray_S = append(LabelArray_S, Label_S)
+	}
+	sort.Strings(LabelArray_S)
+	for _, Label_S := range LabelArray_S {
+		pHistogram_X := _HistogramMap_X[Label_S]
+		Prefix_S := ""
+		if _LabelName_S != "" {
+			Prefix_S = fmt.Sprintf("%s=\"%s\",", _LabelName_S, escapeLabel(Label_S))
+		}
+		for i, Bound_F64 := range this.bucketArray_F64 {
+			fmt.Fprintf(_Buffer_X, "%s_bucket{%sle=\"%s\"} %d\n", _Name_S, Prefix_S, strconv.FormatFloat(Bound_F64, 'g', -1, 64), pHistogram_X.countArray_U64[i])
+		}
+		fmt.Fprintf(_Buffer_X, "%s_bucket{%sle=\"+Inf\"} %d\n", _Name_S, Prefix_S, pHistogram_X.count_U64)
+		Suffix_S := ""
+		if Prefix_S != "" {
+			Suffix_S = "{" + strings.TrimSuffix(Prefix_S, ",") + "}"
+		}
+		fmt.Fprintf(_Buffer_X, "%s_sum%s %s\n", _Name_S, Suffix_S, strconv.FormatFloat(pHistogram_X.sum_F64, 'g', -1, 64))
+		fmt.Fprintf(_Buffer_X, "%s_count%s %d\n", _Name_S, Suffix_S, pHistogram_X.count_U64)
+	}
+}
+
+//Returns '_Value_S' escaped to be used as a label value
+func escapeLabel(_Value_S string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(_Value_S)
+}
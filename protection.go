@@ -0,0 +1,99 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"fmt"
+)
+
+//Protection level of the data connections in secure mode (PROT command)
+type PROTECTIONLEVEL int
+
+const (
+	//Data connections protected by TLS (PROT P)
+	PROTECTIONLEVEL_PRIVATE PROTECTIONLEVEL = iota
+	//Data connections in clear text (PROT C), the control connection stays protected
+	PROTECTIONLEVEL_CLEAR
+)
+
+//Returns the PROT command argument of the protection level
+func (this PROTECTIONLEVEL) String() string {
+	switch this {
+	case PROTECTIONLEVEL_PRIVATE:
+		return "P"
+	case PROTECTIONLEVEL_CLEAR:
+		return "C"
+	}
+	return "unknown"
+}
+
+//Change the protection level of the next data transfers of the session to '_Level_E'. The PROT command is sent before
+//the next transfer if the level of the server is different. It has no effect in non secure mode
+//Returns error object (ErrInvalidParameter for PROTECTIONLEVEL_CLEAR if ClearCommandChannel_B is set)
+func (this *FtpsClient) SetDataProtection(_Level_E PROTECTIONLEVEL) (rRts error) {
+	rRts = this.checkDataProtection(_Level_E)
+	if rRts == nil {
+		rRts = this.lock()
+		if rRts == nil {
+			this.dataProtection_E = _Level_E
+			this.unlock()
+		}
+	}
+	return
+}
+
+//Change the protection level to '_Level_E' for the next operation sending a data command only (its retries
+//included). The level of the session is restored by the following transfer. It has no effect in non secure mode
+//Returns error object (ErrInvalidParameter for PROTECTIONLEVEL_CLEAR if ClearCommandChannel_B is set)
+func (this *FtpsClient) SetNextDataProtection(_Level_E PROTECTIONLEVEL) (rRts error) {
+	rRts = this.checkDataProtection(_Level_E)
+	if rRts == nil {
+		rRts = this.lock()
+		if rRts == nil {
+			this.nextDataProtection_E = _Level_E
+			this.nextDataProtection_B = true
+			this.unlock()
+		}
+	}
+	return
+}
+
+//Check that '_Level_E' is a known level which can be used with the parameters of the session
+//Returns error object
+func (this *FtpsClient) checkDataProtection(_Level_E PROTECTIONLEVEL) (rRts error) {
+	rRts = nil
+	if ((_Level_E != PROTECTIONLEVEL_PRIVATE) && (_Level_E != PROTECTIONLEVEL_CLEAR)) || (this.FtpsParam_X.ClearCommandChannel_B && (_Level_E == PROTECTIONLEVEL_CLEAR)) {
+		rRts = ErrInvalidParameter
+	}
+	return
+}
+
+//Returns the protection level of the data command to send: the one given by SetNextDataProtection, which is released
+//at the end of the operation, or the one of the session
+func (this *FtpsClient) transferDataProtection() (rLevel_E PROTECTIONLEVEL) {
+	rLevel_E = this.dataProtection_E
+	if this.nextDataProtection_B {
+		rLevel_E = this.nextDataProtection_E
+		this.nextDataProtectionUsed_B = true
+	}
+	return
+}
+
+//Send the PROT command if the protection level of the server is not '_Level_E'
+//Returns error object
+func (this *FtpsClient) applyDataProtection(_Level_E PROTECTIONLEVEL) (rRts error) {
+	if this.FtpsParam_X.SecureFtp_B && (this.serverDataProtection_E != _Level_E) {
+		_, _, rRts = this.sendRequestToFtpServer(fmt.Sprintf("PROT %s", _Level_E), 200)
+		if rRts == nil {
+			this.serverDataProtection_E = _Level_E
+		}
+	}
+	return
+}
+
+//Returns true if the data connections must be upgraded to TLS
+func (this *FtpsClient) isDataProtected() bool {
+	return this.FtpsParam_X.SecureFtp_B && (this.serverDataProtection_E == PROTECTIONLEVEL_PRIVATE)
+}
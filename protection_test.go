@@ -0,0 +1,199 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' data protection level unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type ProtectionTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	mutex_X         sync.Mutex
+	commandArray_S  []string
+	nbDataTls_i     int
+}
+
+var _ = Suite(&ProtectionTestSuite{})
+
+func (s *ProtectionTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("media content"))
+	s.commandArray_S = nil
+	s.nbDataTls_i = 0
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		s.mutex_X.Lock()
+		if _Command_S == "PROT" {
+			_Command_S += " " + _Argument_S
+		}
+		s.commandArray_S = append(s.commandArray_S, _Command_S)
+		s.mutex_X.Unlock()
+		return false
+	})
+}
+
+func (s *ProtectionTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of the test server with the data protection level '_Level_E'
+func (s *ProtectionTestSuite) newClient(_SecureFtp_B bool, _Level_E PROTECTIONLEVEL) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.DataProtection_E = _Level_E
+	FtpsClientParam_X.OnEvent = func(_Event_X Event) {
+		if (_Event_X.Type_E == EVENTTYPE_TLS_UPGRADED) && _Event_X.Data_B {
+			s.mutex_X.Lock()
+			s.nbDataTls_i++
+			s.mutex_X.Unlock()
+		}
+	}
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Returns the commands received by the server since the last call and the number of data connections upgraded to TLS
+func (s *ProtectionTestSuite) commands() (rCommand_S string, rNbDataTls_i int) {
+	s.mutex_X.Lock()
+	rCommand_S = strings.Join(s.commandArray_S, " ")
+	rNbDataTls_i = s.nbDataTls_i
+	s.commandArray_S = nil
+	s.nbDataTls_i = 0
+	s.mutex_X.Unlock()
+	return
+}
+
+//Retrieve the test file with '_FtpsClientPtr_X'
+func (s *ProtectionTestSuite) retrieve(c *C, _FtpsClientPtr_X *FtpsClient) {
+	LocalFilepath_S := filepath.Join(c.MkDir(), "clip.mxf")
+	c.Assert(_FtpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S), IsNil)
+}
+
+func (s *ProtectionTestSuite) TestClearSession(c *C) {
+	FtpsClientPtr_X := s.newClient(true, PROTECTIONLEVEL_CLEAR)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.StoreFile("new.mxf", []byte("media content")), IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i := s.commands()
+	c.Assert(Command_S, Equals, "AUTH USER PASS TYPE CWD PBSZ PASV STOR PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 0)
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/new.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media content")
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *ProtectionTestSuite) TestPerTransfer(c *C) {
+	FtpsClientPtr_X := s.newClient(true, PROTECTIONLEVEL_PRIVATE)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i := s.commands()
+	c.Assert(Command_S, Equals, "AUTH USER PASS TYPE CWD PBSZ PROT P PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 1)
+
+	//PROT is only sent when the level changes
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_CLEAR), IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i = s.commands()
+	c.Assert(Command_S, Equals, "PROT C PASV RETR PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 0)
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_PRIVATE), IsNil)
+	_, Err := FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	Command_S, NbDataTls_i = s.commands()
+	c.Assert(Command_S, Equals, "PROT P PASV LIST")
+	c.Assert(NbDataTls_i, Equals, 1)
+
+	//The level is kept by a new connection
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_CLEAR), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i = s.commands()
+	c.Assert(Command_S, Equals, "QUIT AUTH USER PASS TYPE CWD PBSZ PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 0)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL(5)), Equals, ErrInvalidParameter)
+}
+
+func (s *ProtectionTestSuite) TestNextTransfer(c *C) {
+	FtpsClientPtr_X := s.newClient(true, PROTECTIONLEVEL_PRIVATE)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.commands()
+
+	//The level is only used by the next transfer, the commands without data channel keep it
+	c.Assert(FtpsClientPtr_X.SetNextDataProtection(PROTECTIONLEVEL_CLEAR), IsNil)
+	_, Err := FtpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i := s.commands()
+	c.Assert(Command_S, Equals, "PWD PROT C PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 0)
+
+	//The level of the session is restored
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i = s.commands()
+	c.Assert(Command_S, Equals, "PROT P PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 1)
+
+	//A stream keeps the level until it is closed
+	c.Assert(FtpsClientPtr_X.SetNextDataProtection(PROTECTIONLEVEL_CLEAR), IsNil)
+	Writer_I, Err := FtpsClientPtr_X.StoreFileStream("new.mxf")
+	c.Assert(Err, IsNil)
+	_, Err = Writer_I.Write([]byte("media content"))
+	c.Assert(Err, IsNil)
+	c.Assert(Writer_I.Close(), IsNil)
+	_, Err = FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	Command_S, NbDataTls_i = s.commands()
+	c.Assert(Command_S, Equals, "PROT C PASV STOR PROT P PASV LIST")
+	c.Assert(NbDataTls_i, Equals, 1)
+
+	c.Assert(FtpsClientPtr_X.SetNextDataProtection(PROTECTIONLEVEL(5)), Equals, ErrInvalidParameter)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *ProtectionTestSuite) TestNotSecure(c *C) {
+	FtpsClientPtr_X := s.newClient(false, PROTECTIONLEVEL_PRIVATE)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, _ := s.commands()
+	c.Assert(strings.Contains(Command_S, "PROT"), Equals, false)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+func (s *ProtectionTestSuite) TestRefused(c *C) {
+	FtpsClientPtr_X := s.newClient(true, PROTECTIONLEVEL_PRIVATE)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "PROT", ReplyCode_i: 534, ReplyMessage_S: "Request denied for policy reasons", Count_i: 1})
+	c.Assert(FtpsClientPtr_X.SetDataProtection(PROTECTIONLEVEL_CLEAR), IsNil)
+	Err := FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf"))
+	c.Assert(errors.Is(Err, ErrSecure), Equals, true, Commentf("%v", Err))
+	var FtpsErrorPtr_X *FtpsError
+	c.Assert(errors.As(Err, &FtpsErrorPtr_X), Equals, true)
+	c.Assert(FtpsErrorPtr_X.Phase_E, Equals, FTPPHASE_TLS)
+
+	//The level of the server is unchanged: the next transfer sends PROT again
+	s.commands()
+	s.retrieve(c, FtpsClientPtr_X)
+	Command_S, NbDataTls_i := s.commands()
+	c.Assert(Command_S, Equals, "PROT C PASV RETR")
+	c.Assert(NbDataTls_i, Equals, 0)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+}
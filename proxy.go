@@ -0,0 +1,237 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//Error messages generated by the proxy dialers
+var (
+	ErrProxy = errors.New("Ftps: Proxy connection failed")
+)
+
+//Function opening the control and data connections of the client, its signature is the one of
+//net.Dialer.DialContext. The context holds the ConnectTimeout_S64 deadline
+type DialContextFunc func(_Context_X context.Context, _Network_S string, _Address_S string) (net.Conn, error)
+
+//Dialer opening the connections through a SOCKS5 proxy (RFC 1928) with an optional user name/password
+//authentication (RFC 1929). The target host name is resolved by the proxy
+type Socks5Dialer struct {
+	proxyAddress_S string
+	userName_S     string
+	password_S     string
+}
+
+//Dialer opening the connections through an HTTP proxy with the CONNECT method and an optional basic authentication
+type HttpConnectDialer struct {
+	proxyAddress_S string
+	userName_S     string
+	password_S     string
+}
+
+//Connection whose first bytes have already been read in a buffer
+type bufferedConn struct {
+	net.Conn
+	readerPtr_X *bufio.Reader
+}
+
+//Create a new Socks5Dialer using the proxy '_ProxyAddress_S' (host:port). '_UserName_S' and '_Password_S' are empty
+//if the proxy does not need an authentication
+//Returns pointer to Socks5Dialer
+func NewSocks5Dialer(_ProxyAddress_S string, _UserName_S string, _Password_S string) *Socks5Dialer {
+	p := new(Socks5Dialer)
+	p.proxyAddress_S = _ProxyAddress_S
+	p.userName_S = _UserName_S
+	p.password_S = _Password_S
+	return p
+}
+
+//Create a new HttpConnectDialer using the proxy '_ProxyAddress_S' (host:port). '_UserName_S' and '_Password_S' are
+//empty if the proxy does not need an authentication
+//Returns pointer to HttpConnectDialer
+func NewHttpConnectDialer(_ProxyAddress_S string, _UserName_S string, _Password_S string) *HttpConnectDialer {
+	p := new(HttpConnectDialer)
+	p.proxyAddress_S = _ProxyAddress_S
+	p.userName_S = _UserName_S
+	p.password_S = _Password_S
+	return p
+}
+
+//Open a connection to the proxy '_ProxyAddress_S' which must be negotiated before the deadline of '_Context_X'
+//Returns the connection and error object
+func dialProxy(_Context_X context.Context, _ProxyAddress_S string) (rConnection_I net.Conn, rRts error) {
+	var Dialer_X net.Dialer
+
+	rConnection_I, rRts = Dialer_X.DialContext(_Context_X, "tcp", _ProxyAddress_S)
+	if rRts == nil {
+		if Deadline_X, Ok_B := _Context_X.Deadline(); Ok_B {
+			rRts = rConnection_I.SetDeadline(Deadline_X)
+		}
+		if rRts != nil {
+			rConnection_I.Close()
+			rConnection_I = nil
+		}
+	}
+	return
+}
+
+//Connect to '_Address_S' (host:port) through the SOCKS5 proxy. '_Network_S' must be a tcp network
+//Returns the connection and error object
+func (this *Socks5Dialer) DialContext(_Context_X context.Context, _Network_S string, _Address_S string) (rConnection_I net.Conn, rRts error) {
+	var Host_S, Port_S string
+	var Port_U64 uint64
+	var Reply_U8 []byte
+
+	Host_S, Port_S, rRts = net.SplitHostPort(_Address_S)
+	if rRts == nil {
+		Port_U64, rRts = strconv.ParseUint(Port_S, 10, 16)
+	}
+	if (rRts == nil) && (len(Host_S) > 255) {
+		rRts = fmt.Errorf("%w: host name too long", ErrProxy)
+	}
+	if rRts == nil {
+		rConnection_I, rRts = dialProxy(_Context_X, this.proxyAddress_S)
+	}
+	if rRts == nil {
+		//Method negotiation: no authentication or user name/password
+		Request_U8 := []byte{5, 1, 0}
+		if this.userName_S != "" {
+			Request_U8 = []byte{5, 2, 0, 2}
+		}
+		Reply_U8, rRts = exchange(rConnection_I, Request_U8, 2)
+		if (rRts == nil) && ((Reply_U8[0] != 5) || ((Reply_U8[1] != 0) && ((Reply_U8[1] != 2) || (this.userName_S == "")))) {
+			rRts = fmt.Errorf("%w: no acceptable SOCKS5 authentication method", ErrProxy)
+		}
+		if (rRts == nil) && (Reply_U8[1] == 2) {
+			Request_U8 = append([]byte{1, byte(len(this.userName_S))}, this.userName_S...)
+			Request_U8 = append(append(Request_U8, byte(len(this.password_S))), this.password_S...)
+			Reply_U8, rRts = exchange(rConnection_I, Request_U8, 2)
+			if (rRts == nil) && (Reply_U8[1] != 0) {
+				rRts = fmt.Errorf("%w: SOCKS5 authentication refused", ErrProxy)
+			}
+		}
+		if rRts == nil {
+			//CONNECT request with an ip address or a host name
+			if Ip_X := net.ParseIP(Host_S); (Ip_X != nil) && (Ip_X.To4() != nil) {
+				Request_U8 = append([]byte{5, 1, 0, 1}, Ip_X.To4()...)
+			} else if Ip_X != nil {
+				Request_U8 = append([]byte{5, 1, 0, 4}, Ip_X.To16()...)
+			} else {
+				Request_U8 = append([]byte{5, 1, 0, 3, byte(len(Host_S))}, Host_S...)
+			}
+			Request_U8 = binary.BigEndian.AppendUint16(Request_U8, uint16(Port_U64))
+			Reply_U8, rRts = exchange(rConnection_I, Request_U8, 5)
+			if (rRts == nil) && (Reply_U8[1] != 0) {
+				rRts = fmt.Errorf("%w: SOCKS5 CONNECT to %s failed with reply %d", ErrProxy, _Address_S, Reply_U8[1])
+			}
+			if rRts == nil {
+				//Skip the bound address: 4 or 16 bytes, or the length read in Reply_U8[4], and the port
+				Length_i := int(Reply_U8[4]) + 2
+				switch Reply_U8[3] {
+				case 1:
+					Length_i = 4 - 1 + 2
+				case 4:
+					Length_i = 16 - 1 + 2
+				}
+				_, rRts = io.ReadFull(rConnection_I, make([]byte, Length_i))
+			}
+		}
+		rRts = endProxyNegotiation(&rConnection_I, rRts)
+	}
+	return
+}
+
+//Connect to '_Address_S' (host:port) through the HTTP proxy
+//Returns the connection and error object
+func (this *HttpConnectDialer) DialContext(_Context_X context.Context, _Network_S string, _Address_S string) (rConnection_I net.Conn, rRts error) {
+	var ResponsePtr_X *http.Response
+
+	rConnection_I, rRts = dialProxy(_Context_X, this.proxyAddress_S)
+	if rRts == nil {
+		Request_S := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", _Address_S, _Address_S)
+		if this.userName_S != "" {
+			Request_S += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(this.userName_S+":"+this.password_S)) + "\r\n"
+		}
+		_, rRts = io.WriteString(rConnection_I, Request_S+"\r\n")
+		if rRts == nil {
+			pReader_X := bufio.NewReader(rConnection_I)
+			ResponsePtr_X, rRts = http.ReadResponse(pReader_X, &http.Request{Method: http.MethodConnect})
+			if rRts == nil {
+				ResponsePtr_X.Body.Close()
+				if ResponsePtr_X.StatusCode != http.StatusOK {
+					rRts = fmt.Errorf("%w: HTTP CONNECT to %s failed with status '%s'", ErrProxy, _Address_S, ResponsePtr_X.Status)
+				} else if pReader_X.Buffered() != 0 {
+					//The server may have sent its welcome message with the proxy response
+					rConnection_I = &bufferedConn{Conn: rConnection_I, readerPtr_X: pReader_X}
+				}
+			}
+		}
+		rRts = endProxyNegotiation(&rConnection_I, rRts)
+	}
+	return
+}
+
+//Write '_Request_U8' to '_Connection_I' and read a reply of '_ReplySize_i' bytes
+//Returns the reply and error object
+func exchange(_Connection_I net.Conn, _Request_U8 []byte, _ReplySize_i int) (rReply_U8 []byte, rRts error) {
+	_, rRts = _Connection_I.Write(_Request_U8)
+	if rRts == nil {
+		rReply_U8 = make([]byte, _ReplySize_i)
+		_, rRts = io.ReadFull(_Connection_I, rReply_U8)
+	}
+	return
+}
+
+//Clear the negotiation deadline of the proxy connection '_ConnectionPtr_I' or close it if the negotiation failed
+//with '_Err'
+//Returns error object
+func endProxyNegotiation(_ConnectionPtr_I *net.Conn, _Err error) (rRts error) {
+	rRts = _Err
+	if rRts == nil {
+		rRts = (*_ConnectionPtr_I).SetDeadline(time.Time{})
+	}
+	if rRts != nil {
+		(*_ConnectionPtr_I).Close()
+		*_ConnectionPtr_I = nil
+		if !errors.Is(rRts, ErrProxy) {
+			rRts = fmt.Errorf("%w: %w", ErrProxy, rRts)
+		}
+	}
+	return
+}
+
+//Read from the buffered bytes then from the connection
+//Returns number of byte read and error object
+func (this *bufferedConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.readerPtr_X.Read(_DataArray_U8)
+	return
+}
+
+//Open a connection to '_Host_S':'_Port_i' with the DialContext of the client or a net.Dialer
+//Returns the connection and error object
+func (this *FtpsClient) dial(_Host_S string, _Port_i int) (rConnection_I net.Conn, rRts error) {
+	var Dialer_X net.Dialer
+
+	Context_X, Cancel := context.WithTimeout(context.Background(), time.Duration(this.FtpsParam_X.ConnectTimeout_S64)*time.Millisecond)
+	Address_S := net.JoinHostPort(_Host_S, strconv.Itoa(_Port_i))
+	if this.FtpsParam_X.DialContext != nil {
+		rConnection_I, rRts = this.FtpsParam_X.DialContext(Context_X, "tcp4", Address_S)
+	} else {
+		rConnection_I, rRts = Dialer_X.DialContext(Context_X, "tcp4", Address_S)
+	}
+	Cancel()
+	return
+}
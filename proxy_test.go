@@ -0,0 +1,139 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' proxy dialer unit test.
+	The test server is reached through the SOCKS5 and HTTP CONNECT proxy stand-ins of 'ftpstest'.
+*/
+package ftpsclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type ProxyTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+}
+
+var _ = Suite(&ProxyTestSuite{})
+
+func (s *ProxyTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+}
+
+func (s *ProxyTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of the test server opening its connections with '_DialContext'
+func (s *ProxyTestSuite) newClient(_SecureFtp_B bool, _DialContext DialContextFunc) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.DialContext = _DialContext
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Store, list and retrieve a file with '_FtpsClientPtr_X'
+func (s *ProxyTestSuite) transfer(c *C, _FtpsClientPtr_X *FtpsClient) {
+	c.Assert(_FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(_FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content")), IsNil)
+	DirEntryArray_X, Err := _FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(DirEntryArray_X, HasLen, 1)
+	LocalFilepath_S := filepath.Join(c.MkDir(), "clip.mxf")
+	c.Assert(_FtpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S), IsNil)
+	Data_U8, Err := os.ReadFile(LocalFilepath_S)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media content")
+	c.Assert(_FtpsClientPtr_X.Disconnect(), IsNil)
+}
+
+//Run a session through a proxy of type '_Type_E' and check that the control and the 3 data connections used it
+func (s *ProxyTestSuite) checkProxy(c *C, _Type_E ftpstest.PROXYTYPE, _SecureFtp_B bool) {
+	var DialContext DialContextFunc
+
+	pProxyServer_X, Err := ftpstest.NewProxyServer(_Type_E, "proxy", "pwd")
+	c.Assert(Err, IsNil)
+	defer pProxyServer_X.Close()
+	if _Type_E == ftpstest.PROXYTYPE_SOCKS5 {
+		DialContext = NewSocks5Dialer(pProxyServer_X.Address(), "proxy", "pwd").DialContext
+	} else {
+		DialContext = NewHttpConnectDialer(pProxyServer_X.Address(), "proxy", "pwd").DialContext
+	}
+	s.transfer(c, s.newClient(_SecureFtp_B, DialContext))
+	TargetArray_S := pProxyServer_X.Target()
+	c.Assert(TargetArray_S, HasLen, 4)
+	c.Assert(TargetArray_S[0], Equals, net.JoinHostPort(s.ftpsServerPtr_X.Host(), strconv.Itoa(int(s.ftpsServerPtr_X.Port()))))
+	c.Assert(pProxyServer_X.Err(), IsNil)
+}
+
+func (s *ProxyTestSuite) TestSocks5(c *C) {
+	s.checkProxy(c, ftpstest.PROXYTYPE_SOCKS5, false)
+	s.checkProxy(c, ftpstest.PROXYTYPE_SOCKS5, true)
+}
+
+func (s *ProxyTestSuite) TestHttpConnect(c *C) {
+	s.checkProxy(c, ftpstest.PROXYTYPE_HTTP, false)
+	s.checkProxy(c, ftpstest.PROXYTYPE_HTTP, true)
+}
+
+func (s *ProxyTestSuite) TestNoAuthentication(c *C) {
+	pProxyServer_X, Err := ftpstest.NewProxyServer(ftpstest.PROXYTYPE_SOCKS5, "", "")
+	c.Assert(Err, IsNil)
+	defer pProxyServer_X.Close()
+	s.transfer(c, s.newClient(true, NewSocks5Dialer(pProxyServer_X.Address(), "", "").DialContext))
+
+	pHttpProxyServer_X, Err := ftpstest.NewProxyServer(ftpstest.PROXYTYPE_HTTP, "", "")
+	c.Assert(Err, IsNil)
+	defer pHttpProxyServer_X.Close()
+	s.transfer(c, s.newClient(true, NewHttpConnectDialer(pHttpProxyServer_X.Address(), "", "").DialContext))
+}
+
+func (s *ProxyTestSuite) TestAuthenticationRefused(c *C) {
+	for _, Type_E := range []ftpstest.PROXYTYPE{ftpstest.PROXYTYPE_SOCKS5, ftpstest.PROXYTYPE_HTTP} {
+		var DialContext DialContextFunc
+
+		pProxyServer_X, Err := ftpstest.NewProxyServer(Type_E, "proxy", "pwd")
+		c.Assert(Err, IsNil)
+		if Type_E == ftpstest.PROXYTYPE_SOCKS5 {
+			DialContext = NewSocks5Dialer(pProxyServer_X.Address(), "proxy", "wrong").DialContext
+		} else {
+			DialContext = NewHttpConnectDialer(pProxyServer_X.Address(), "proxy", "wrong").DialContext
+		}
+		Err = s.newClient(false, DialContext).Connect()
+		c.Assert(errors.Is(Err, ErrProxy), Equals, true, Commentf("%v", Err))
+		c.Assert(errors.Is(Err, ErrNotConnected), Equals, true)
+		c.Assert(pProxyServer_X.Target(), HasLen, 0)
+		c.Assert(pProxyServer_X.Close(), IsNil)
+		c.Assert(errors.Is(pProxyServer_X.Err(), ftpstest.ErrProxyAuth), Equals, true)
+	}
+}
+
+func (s *ProxyTestSuite) TestCustomDialer(c *C) {
+	var AddressArray_S []string
+
+	s.transfer(c, s.newClient(false, func(_Context_X context.Context, _Network_S string, _Address_S string) (net.Conn, error) {
+		var Dialer_X net.Dialer
+
+		_, Ok_B := _Context_X.Deadline()
+		c.Check(Ok_B, Equals, true)
+		AddressArray_S = append(AddressArray_S, _Address_S)
+		return Dialer_X.DialContext(_Context_X, _Network_S, _Address_S)
+	}))
+	c.Assert(AddressArray_S, HasLen, 4)
+}
@@ -0,0 +1,175 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+//Token bucket limiting the number of bytes per second transferred on the data connections which share it. The
+//bucket holds up to 'burst' bytes and is refilled at 'rate' bytes per second. It can be changed at runtime
+type RateLimiter struct {
+	mutex_X      sync.Mutex
+	rate_U64     uint64
+	burst_U64    uint64
+	token_F64    float64
+	refillTime_X time.Time
+}
+
+//Data connection whose transfers are limited by the session and pool rate limiters
+type limitedConn struct {
+	net.Conn
+	rateLimiterArray_X []*RateLimiter
+}
+
+//Create a new RateLimiter allowing '_Rate_U64' bytes per second with bursts of '_Burst_U64' bytes. A rate of 0 does
+//not limit the transfers and a burst of 0 is set to one second of transfer
+//Returns pointer to RateLimiter
+func NewRateLimiter(_Rate_U64 uint64, _Burst_U64 uint64) *RateLimiter {
+	p := new(RateLimiter)
+	p.SetRate(_Rate_U64, _Burst_U64)
+	return p
+}
+
+//Change the rate to '_Rate_U64' bytes per second with bursts of '_Burst_U64' bytes. The transfers in progress use it
+//for their next block. The bucket is refilled at the previous rate up to now and keeps its tokens up to the new burst
+//size: changing the rate does not give a new burst
+func (this *RateLimiter) SetRate(_Rate_U64 uint64, _Burst_U64 uint64) {
+	this.mutex_X.Lock()
+	if _Burst_U64 == 0 {
+		_Burst_U64 = _Rate_U64
+	}
+	Now_X := time.Now()
+	if this.refillTime_X.IsZero() || (this.rate_U64 == 0) {
+		//A new or unlimited bucket starts full
+		this.token_F64 = float64(_Burst_U64)
+	} else {
+		this.refill(Now_X)
+	}
+	this.rate_U64 = _Rate_U64
+	this.burst_U64 = _Burst_U64
+	if this.token_F64 > float64(_Burst_U64) {
+		this.token_F64 = float64(_Burst_U64)
+	}
+	this.refillTime_X = Now_X
+	this.mutex_X.Unlock()
+}
+
+//Returns the rate in bytes per second and the burst in bytes
+func (this *RateLimiter) Rate() (rRate_U64 uint64, rBurst_U64 uint64) {
+	this.mutex_X.Lock()
+	rRate_U64 = this.rate_U64
+	rBurst_U64 = this.burst_U64
+	this.mutex_X.Unlock()
+	return
+}
+
+//Returns the maximum number of bytes to transfer at once to follow the rate: the burst size up to '_BlockSize_i'
+func (this *RateLimiter) blockSize(_BlockSize_i int) (rBlockSize_i int) {
+	this.mutex_X.Lock()
+	rBlockSize_i = _BlockSize_i
+	if (this.rate_U64 != 0) && (this.burst_U64 < uint64(_BlockSize_i)) {
+		rBlockSize_i = int(this.burst_U64)
+	}
+	this.mutex_X.Unlock()
+	return
+}
+
+//Add the tokens earned at the current rate since the last refill up to '_Now_X', without exceeding the burst size.
+//The mutex must be locked
+func (this *RateLimiter) refill(_Now_X time.Time) {
+	this.token_F64 += _Now_X.Sub(this.refillTime_X).Seconds() * float64(this.rate_U64)
+	if this.token_F64 > float64(this.burst_U64) {
+		this.token_F64 = float64(this.burst_U64)
+	}
+	this.refillTime_X = _Now_X
+}
+
+//Take '_NbByte_i' bytes from the bucket and wait until the bucket is no more in debt
+func (this *RateLimiter) wait(_NbByte_i int) {
+	var Delay_S64 time.Duration
+
+	this.mutex_X.Lock()
+	if this.rate_U64 != 0 {
+		this.refill(time.Now())
+		this.token_F64 -= float64(_NbByte_i)
+		if this.token_F64 < 0 {
+			Delay_S64 = time.Duration(-this.token_F64 / float64(this.rate_U64) * float64(time.Second))
+		}
+	}
+	this.mutex_X.Unlock()
+	if Delay_S64 > 0 {
+		time.Sleep(Delay_S64)
+	}
+}
+
+//Change the bandwidth limit of the data transfers of the session to '_Rate_U64' bytes per second (0 for no limit)
+//with bursts of '_Burst_U64' bytes. It applies to the transfers in progress
+func (this *FtpsClient) SetRateLimit(_Rate_U64 uint64, _Burst_U64 uint64) {
+	this.rateLimiterPtr_X.SetRate(_Rate_U64, _Burst_U64)
+}
+
+//Wrap the data connection '_Connection_I' to limit its transfers with the session and pool rate limiters
+//Returns the wrapped connection
+func (this *FtpsClient) newLimitedConn(_Connection_I net.Conn) (rConnection_I net.Conn) {
+	p := &limitedConn{Conn: _Connection_I, rateLimiterArray_X: []*RateLimiter{this.rateLimiterPtr_X}}
+	if this.poolRateLimiterPtr_X != nil {
+		p.rateLimiterArray_X = append(p.rateLimiterArray_X, this.poolRateLimiterPtr_X)
+	}
+	rConnection_I = p
+	return
+}
+
+//Returns the maximum number of bytes to transfer at once to follow the rates of all the limiters
+func (this *limitedConn) blockSize() (rBlockSize_i int) {
+	rBlockSize_i = dataBlockSize_i
+	for _, pRateLimiter_X := range this.rateLimiterArray_X {
+		rBlockSize_i = pRateLimiter_X.blockSize(rBlockSize_i)
+	}
+	if rBlockSize_i < 1 {
+		rBlockSize_i = 1
+	}
+	return
+}
+
+//Wait for the limiters to allow the transfer of '_NbByte_i' bytes
+func (this *limitedConn) wait(_NbByte_i int) {
+	for _, pRateLimiter_X := range this.rateLimiterArray_X {
+		pRateLimiter_X.wait(_NbByte_i)
+	}
+}
+
+//Read at most one block from the data connection and wait for the limiters to pay for it
+//Returns number of byte read and error object
+func (this *limitedConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	if BlockSize_i := this.blockSize(); len(_DataArray_U8) > BlockSize_i {
+		_DataArray_U8 = _DataArray_U8[:BlockSize_i]
+	}
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	if rNbRead_i > 0 {
+		this.wait(rNbRead_i)
+	}
+	return
+}
+
+//Write to the data connection block by block, each one once allowed by the limiters
+//Returns number of byte written and error object
+func (this *limitedConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	var NbWrite_i int
+
+	rNbWrite_i = 0
+	for (rRts == nil) && (rNbWrite_i < len(_DataArray_U8)) {
+		End_i := rNbWrite_i + this.blockSize()
+		if End_i > len(_DataArray_U8) {
+			End_i = len(_DataArray_U8)
+		}
+		this.wait(End_i - rNbWrite_i)
+		NbWrite_i, rRts = this.Conn.Write(_DataArray_U8[rNbWrite_i:End_i])
+		rNbWrite_i += NbWrite_i
+	}
+	return
+}
@@ -0,0 +1,201 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' bandwidth limiting unit test.
+*/
+package ftpsclient
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type RateLimitTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	data_U8         []byte
+}
+
+var _ = Suite(&RateLimitTestSuite{})
+
+func (s *RateLimitTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.data_U8 = make([]byte, 100*1024)
+	rand.New(rand.NewSource(1)).Read(s.data_U8)
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *RateLimitTestSuite) TearDownTest(c *C) {
+	if s.ftpsClientPtr_X != nil {
+		s.ftpsClientPtr_X.Disconnect()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns the client parameters to connect to the test server
+func (s *RateLimitTestSuite) clientParam() (rFtpsClientParam_X FtpsClientParam) {
+	rFtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	rFtpsClientParam_X.DataTimeout_S64 = 5000
+	return
+}
+
+//Create a client connected to the test server limited to '_Rate_U64' bytes per second with bursts of '_Burst_U64'
+func (s *RateLimitTestSuite) connect(c *C, _Rate_U64 uint64, _Burst_U64 uint64) {
+	FtpsClientParam_X := s.clientParam()
+	FtpsClientParam_X.MaxRate_U64 = _Rate_U64
+	FtpsClientParam_X.MaxBurst_U64 = _Burst_U64
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+}
+
+func (s *RateLimitTestSuite) TestRateLimiter(c *C) {
+	pRateLimiter_X := NewRateLimiter(100*1024, 0)
+	Rate_U64, Burst_U64 := pRateLimiter_X.Rate()
+	c.Assert(Rate_U64, Equals, uint64(100*1024))
+	c.Assert(Burst_U64, Equals, uint64(100*1024))
+
+	//The burst is given at once, the rest at the rate
+	StartTime_X := time.Now()
+	pRateLimiter_X.wait(100 * 1024)
+	c.Assert(time.Since(StartTime_X) < 100*time.Millisecond, Equals, true)
+	pRateLimiter_X.wait(20 * 1024)
+	c.Assert(time.Since(StartTime_X) >= 150*time.Millisecond, Equals, true)
+
+	pRateLimiter_X.SetRate(0, 0)
+	StartTime_X = time.Now()
+	pRateLimiter_X.wait(100 * 1024 * 1024)
+	c.Assert(time.Since(StartTime_X) < 100*time.Millisecond, Equals, true)
+	c.Assert(pRateLimiter_X.blockSize(dataBlockSize_i), Equals, dataBlockSize_i)
+	pRateLimiter_X.SetRate(1000, 100)
+	c.Assert(pRateLimiter_X.blockSize(dataBlockSize_i), Equals, 100)
+}
+
+func (s *RateLimitTestSuite) TestSetRate(c *C) {
+	//An empty bucket is not refilled by a rate change
+	pRateLimiter_X := NewRateLimiter(10*1024, 10*1024)
+	pRateLimiter_X.wait(10 * 1024)
+	pRateLimiter_X.SetRate(20*1024, 20*1024)
+	StartTime_X := time.Now()
+	pRateLimiter_X.wait(4 * 1024)
+	c.Assert(time.Since(StartTime_X) >= 150*time.Millisecond, Equals, true)
+
+	//The tokens are clamped to the new burst size
+	pRateLimiter_X = NewRateLimiter(10*1024, 10*1024)
+	pRateLimiter_X.SetRate(20*1024, 2*1024)
+	pRateLimiter_X.mutex_X.Lock()
+	c.Assert(pRateLimiter_X.token_F64, Equals, float64(2*1024))
+	pRateLimiter_X.mutex_X.Unlock()
+
+	//The time elapsed before the change is refilled at the previous rate
+	pRateLimiter_X = NewRateLimiter(10*1024, 10*1024)
+	pRateLimiter_X.wait(10 * 1024)
+	time.Sleep(100 * time.Millisecond)
+	pRateLimiter_X.SetRate(100*1024, 100*1024)
+	pRateLimiter_X.mutex_X.Lock()
+	c.Assert(pRateLimiter_X.token_F64 >= 1000 && pRateLimiter_X.token_F64 < 4*1024, Equals, true, Commentf("%f", pRateLimiter_X.token_F64))
+	pRateLimiter_X.mutex_X.Unlock()
+}
+
+func (s *RateLimitTestSuite) TestStoreFile(c *C) {
+	//(100-10)KB at 200KB/s
+	s.connect(c, 200*1024, 10*1024)
+	StartTime_X := time.Now()
+	c.Assert(s.ftpsClientPtr_X.StoreFile("clip.mxf", s.data_U8), IsNil)
+	c.Assert(time.Since(StartTime_X) >= 350*time.Millisecond, Equals, true)
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/clip.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(Data_U8, DeepEquals, s.data_U8)
+}
+
+func (s *RateLimitTestSuite) TestRetrieveFile(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 200*1024, 10*1024)
+	StartTime_X := time.Now()
+	c.Assert(s.ftpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	c.Assert(time.Since(StartTime_X) >= 350*time.Millisecond, Equals, true)
+}
+
+func (s *RateLimitTestSuite) TestReadFtpDataChannel(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	s.connect(c, 200*1024, 10*1024)
+	StartTime_X := time.Now()
+	_, _, Err := s.ftpsClientPtr_X.OpenFtpDataChannel("RETR clip.mxf", 150)
+	c.Assert(Err, IsNil)
+	_, _, NbRead_i, Err := s.ftpsClientPtr_X.ReadFtpDataChannel(false, make([]byte, len(s.data_U8)))
+	c.Assert(Err, IsNil)
+	c.Assert(NbRead_i, Equals, len(s.data_U8))
+	_, _, Err = s.ftpsClientPtr_X.CloseFtpDataChannel()
+	c.Assert(Err, IsNil)
+	c.Assert(time.Since(StartTime_X) >= 350*time.Millisecond, Equals, true)
+}
+
+func (s *RateLimitTestSuite) TestRuntimeChange(c *C) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", s.data_U8), IsNil)
+	//At 10KB/s the transfer would take 10s
+	s.connect(c, 10*1024, 1024)
+	Reader_I, Err := s.ftpsClientPtr_X.RetrieveFileStream("clip.mxf")
+	c.Assert(Err, IsNil)
+	_, Err = io.ReadFull(Reader_I, make([]byte, 2048))
+	c.Assert(Err, IsNil)
+
+	s.ftpsClientPtr_X.SetRateLimit(0, 0)
+	StartTime_X := time.Now()
+	Data_U8, Err := io.ReadAll(Reader_I)
+	c.Assert(Err, IsNil)
+	c.Assert(len(Data_U8), Equals, len(s.data_U8)-2048)
+	c.Assert(Reader_I.Close(), IsNil)
+	c.Assert(time.Since(StartTime_X) < 2*time.Second, Equals, true)
+}
+
+func (s *RateLimitTestSuite) TestPool(c *C) {
+	var WaitGroup_X sync.WaitGroup
+
+	FtpsClientParam_X := s.clientParam()
+	pFtpsPool_X := NewFtpsClientPool(&FtpsClientParam_X, &FtpsClientPoolParam{MaxRate_U64: 200 * 1024, MaxBurst_U64: 10 * 1024})
+	defer pFtpsPool_X.Close()
+
+	//2 x 50KB share 200KB/s
+	StartTime_X := time.Now()
+	ErrArray_X := make([]error, 2)
+	for i := range ErrArray_X {
+		WaitGroup_X.Add(1)
+		go func(_Id_i int) {
+			defer WaitGroup_X.Done()
+			FtpsClientPtr_X, Err := pFtpsPool_X.Get()
+			if Err == nil {
+				Err = FtpsClientPtr_X.StoreFile(fmt.Sprintf("clip_%d.mxf", _Id_i), s.data_U8[:50*1024])
+				pFtpsPool_X.Put(FtpsClientPtr_X)
+			}
+			ErrArray_X[_Id_i] = Err
+		}(i)
+	}
+	WaitGroup_X.Wait()
+	for _, Err := range ErrArray_X {
+		c.Assert(Err, IsNil)
+	}
+	c.Assert(time.Since(StartTime_X) >= 350*time.Millisecond, Equals, true)
+
+	//Lifting the pool limit
+	pFtpsPool_X.SetRateLimit(0, 0)
+	FtpsClientPtr_X, Err := pFtpsPool_X.Get()
+	c.Assert(Err, IsNil)
+	StartTime_X = time.Now()
+	c.Assert(FtpsClientPtr_X.StoreFile("clip.mxf", s.data_U8), IsNil)
+	c.Assert(time.Since(StartTime_X) < 350*time.Millisecond, Equals, true)
+	pFtpsPool_X.Put(FtpsClientPtr_X)
+}
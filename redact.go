@@ -0,0 +1,38 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"regexp"
+	"strings"
+)
+
+//Text replacing the argument of a masked ftp command
+const redactedArgument_S = "****"
+
+//Returns the ftp command '_Request_S' as it can be logged or traced: the argument of the PASS and ACCT commands is
+//always masked, the one of the SITE commands matching one of the '_PatternArray_X' regular expressions too
+func redactCommand(_Request_S string, _PatternArray_X []*regexp.Regexp) string {
+	Verb_S, _, Argument_B := strings.Cut(_Request_S, " ")
+	Verb_S = strings.ToUpper(Verb_S)
+	if Argument_B {
+		switch Verb_S {
+		case "PASS", "ACCT":
+			return Verb_S + " " + redactedArgument_S
+		case "SITE":
+			for _, pPattern_X := range _PatternArray_X {
+				if pPattern_X.MatchString(_Request_S) {
+					return Verb_S + " " + redactedArgument_S
+				}
+			}
+		}
+	}
+	return _Request_S
+}
+
+//Returns the ftp command '_Request_S' masked according to the RedactPatternArray_X of the client
+func (this *FtpsClient) redact(_Request_S string) string {
+	return redactCommand(_Request_S, this.FtpsParam_X.RedactPatternArray_X)
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' credential redaction unit test.
+*/
+package ftpsclient
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+//Secrets which must never be logged
+const (
+	redactPassword_S = "Pa55-w0rd-secret"
+	redactAccount_S  = "acct-secret-42"
+	redactSite_S     = "site-secret-77"
+)
+
+type RedactTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	buffer_X        bytes.Buffer
+}
+
+var _ = Suite(&RedactTestSuite{})
+
+func (s *RedactTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: redactPassword_S})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.buffer_X.Reset()
+	s.ftpsClientPtr_X = nil
+}
+
+func (s *RedactTestSuite) TearDownTest(c *C) {
+	if s.ftpsClientPtr_X != nil {
+		s.ftpsClientPtr_X.Disconnect()
+	}
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create a client of the test server logging everything with the password '_LoginPassword_S'
+func (s *RedactTestSuite) newClient(_LoginPassword_S string) {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.LoginPassword_S = _LoginPassword_S
+	FtpsClientParam_X.Logger_X = slog.New(slog.NewTextHandler(&s.buffer_X, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	FtpsClientParam_X.RedactPatternArray_X = []*regexp.Regexp{regexp.MustCompile(`(?i)^SITE\s+(CHPASS|TOKEN)\b`)}
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Check that none of the secrets is in '_Text_S'
+func (s *RedactTestSuite) checkNoSecret(c *C, _Text_S string) {
+	for _, Secret_S := range []string{redactPassword_S, redactAccount_S, redactSite_S} {
+		c.Assert(strings.Contains(_Text_S, Secret_S), Equals, false, Commentf("'%s' found in %s", Secret_S, _Text_S))
+	}
+}
+
+func (s *RedactTestSuite) TestRedactCommand(c *C) {
+	PatternArray_X := []*regexp.Regexp{regexp.MustCompile(`(?i)^SITE\s+CHPASS\b`)}
+	c.Assert(redactCommand("PASS secret", PatternArray_X), Equals, "PASS ****")
+	c.Assert(redactCommand("pass secret", nil), Equals, "PASS ****")
+	c.Assert(redactCommand("ACCT billing", nil), Equals, "ACCT ****")
+	c.Assert(redactCommand("SITE CHPASS mc secret", PatternArray_X), Equals, "SITE ****")
+	c.Assert(redactCommand("site chpass mc secret", PatternArray_X), Equals, "SITE ****")
+	c.Assert(redactCommand("SITE CHMOD 644 clip.mxf", PatternArray_X), Equals, "SITE CHMOD 644 clip.mxf")
+	c.Assert(redactCommand("SITE CHPASS mc secret", nil), Equals, "SITE CHPASS mc secret")
+	c.Assert(redactCommand("USER mc", PatternArray_X), Equals, "USER mc")
+	c.Assert(redactCommand("PASS", nil), Equals, "PASS")
+}
+
+func (s *RedactTestSuite) TestLogger(c *C) {
+	s.newClient(redactPassword_S)
+	c.Assert(s.ftpsClientPtr_X.Connect(), IsNil)
+	_, _, Err := s.ftpsClientPtr_X.SendFtpCtrlCommand("ACCT "+redactAccount_S, 230)
+	c.Assert(Err, NotNil)
+	s.checkNoSecret(c, Err.Error())
+	_, _, Err = s.ftpsClientPtr_X.SendFtpCtrlCommand("SITE CHPASS mc "+redactSite_S, 200)
+	c.Assert(Err, NotNil)
+	s.checkNoSecret(c, Err.Error())
+	_, _, Err = s.ftpsClientPtr_X.SendFtpCtrlCommand("SITE CHMOD 644 /Seq", 200)
+	c.Assert(Err, IsNil)
+
+	Log_S := s.buffer_X.String()
+	s.checkNoSecret(c, Log_S)
+	c.Assert(strings.Contains(Log_S, "PASS ****"), Equals, true)
+	c.Assert(strings.Contains(Log_S, "ACCT ****"), Equals, true)
+	c.Assert(strings.Contains(Log_S, "SITE ****"), Equals, true)
+	c.Assert(strings.Contains(Log_S, "SITE CHMOD 644 /Seq"), Equals, true)
+}
+
+func (s *RedactTestSuite) TestInvalidLogin(c *C) {
+	s.newClient(redactAccount_S)
+	Err := s.ftpsClientPtr_X.Connect()
+	c.Assert(Err, NotNil)
+	s.checkNoSecret(c, Err.Error())
+	s.checkNoSecret(c, s.buffer_X.String())
+	s.ftpsClientPtr_X = nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"syscall"
+	"time"
+)
+
+//Retry policy applied to the idempotent operations (PWD, CWD, LIST, MLSD, MLST, SIZE, MDTM, SITE CHMOD, RETR and
+//STOR). The zero value disables the retries
+type RetryPolicy struct {
+	//Total number of attempts, 0 or 1 means no retry
+	MaxAttempt_i int
+	//Delay in ms before the first retry, it is doubled at each attempt up to MaxBackoff_S64 (in ms, 0 means no limit)
+	InitialBackoff_S64 time.Duration
+	MaxBackoff_S64     time.Duration
+	//Random variation of the delays in percent (0-100)
+	JitterPercent_i int
+	//Error classifier, IsRetryableError is used if nil
+	IsRetryable func(_Err error) bool
+}
+
+//Tell if '_Err' is worth a retry: transient negative replies (4xx such as 421 service not available or 426 transfer
+//aborted), lost or timed out connections
+//Returns true if the operation can be retried
+func IsRetryableError(_Err error) (rRetryable_B bool) {
+	var NetError_I net.Error
+
+	rRetryable_B = false
+	if _Err != nil {
+		if IsTransient(_Err) {
+			rRetryable_B = true
+		} else if IsPermanent(_Err) || errors.Is(_Err, ErrPasv) || errors.Is(_Err, ErrInvalidLogin) {
+			rRetryable_B = false
+		} else if errors.Is(_Err, ErrNotConnected) || errors.Is(_Err, io.EOF) || errors.Is(_Err, io.ErrUnexpectedEOF) ||
+			errors.Is(_Err, syscall.ECONNRESET) || errors.Is(_Err, syscall.EPIPE) || errors.Is(_Err, net.ErrClosed) || errors.As(_Err, &NetError_I) {
+			rRetryable_B = true
+		}
+	}
+	return
+}
+
+//Run '_Operation' according to the retry policy. When the control connection has been lost, the client is
+//connected again and its working directory restored before the attempt
+//Returns error object of the last attempt
+func (this *FtpsClient) retry(_Operation func() error) (rRts error) {
+	var Backoff_S64 time.Duration
+
+	IsRetryable := this.FtpsParam_X.RetryPolicy_X.IsRetryable
+	if IsRetryable == nil {
+		IsRetryable = IsRetryableError
+	}
+	Backoff_S64 = this.FtpsParam_X.RetryPolicy_X.InitialBackoff_S64 * time.Millisecond
+	for Attempt_i := 1; ; Attempt_i++ {
+		rRts = nil
+		if this.connectionLost_B && (this.FtpsParam_X.RetryPolicy_X.MaxAttempt_i > 1) {
+			rRts = this.reconnect()
+		}
+		if rRts == nil {
+			rRts = _Operation()
+		}
+		if (rRts == nil) || (Attempt_i >= this.FtpsParam_X.RetryPolicy_X.MaxAttempt_i) || !IsRetryable(rRts) {
+			break
+		}
+		this.debugInfo("retry", "attempt", Attempt_i, "err", rRts)
+		time.Sleep(this.jitter(Backoff_S64))
+		Backoff_S64 = Backoff_S64 * 2
+		if (this.FtpsParam_X.RetryPolicy_X.MaxBackoff_S64 != 0) && (Backoff_S64 > this.FtpsParam_X.RetryPolicy_X.MaxBackoff_S64*time.Millisecond) {
+			Backoff_S64 = this.FtpsParam_X.RetryPolicy_X.MaxBackoff_S64 * time.Millisecond
+		}
+	}
+	return
+}
+
+//Run '_Operation' with the exclusive use of the client according to the retry policy
+//Returns error object of the last attempt
+func (this *FtpsClient) run(_Operation func() error) (rRts error) {
+	rRts = this.lock()
+	if rRts == nil {
+		rRts = this.retry(_Operation)
+		this.unlock()
+	}
+	return
+}
+
+//Apply the random variation of the retry policy to the delay '_Backoff_S64'
+//Returns the delay to wait
+func (this *FtpsClient) jitter(_Backoff_S64 time.Duration) time.Duration {
+	Jitter_i := int64(_Backoff_S64) * int64(this.FtpsParam_X.RetryPolicy_X.JitterPercent_i) / 100
+	if Jitter_i > 0 {
+		_Backoff_S64 += time.Duration(rand.Int63n(2*Jitter_i+1) - Jitter_i)
+	}
+	return _Backoff_S64
+}
+
+//Connect again to the ftp server after the loss of the control connection and go back to the last working ftp
+//directory
+//Returns error object
+func (this *FtpsClient) reconnect() (rRts error) {
+	this.debugInfo("reconnect")
+	rRts = this.connect()
+	if (rRts == nil) && (this.workingDirectory_S != "") {
+		_, _, rRts = this.sendRequestToFtpServer("CWD "+this.workingDirectory_S, 250)
+	}
+	return
+}
+
+//Close the control connection once it can't be used anymore: network error, timeout or 421 reply (the server is
+//closing the session). '_Err' is the error of the last control exchange
+func (this *FtpsClient) checkConnectionLost(_Err error) {
+	var TextProtoErrPtr_X *textproto.Error
+
+	if (_Err != nil) && (this.ctrlConnection_I != nil) {
+		if !errors.As(_Err, &TextProtoErrPtr_X) || (TextProtoErrPtr_X.Code == 421) {
+			this.debugInfo("connection lost", "err", _Err)
+			this.dropConnection(_Err)
+		}
+	}
+}
+
+//Close the control and data connections without the QUIT exchange after the error '_Err'
+func (this *FtpsClient) dropConnection(_Err error) {
+	if this.dataConnection_I != nil {
+		this.dataConnection_I.Close()
+	}
+	if this.ctrlConnection_I != nil {
+		Address_S := this.ctrlConnection_I.RemoteAddr().String()
+		this.ctrlConnection_I.Close()
+		this.ctrlConnection_I = nil
+		this.emit(Event{Type_E: EVENTTYPE_DISCONNECTED, Address_S: Address_S, Err: _Err})
+	}
+	this.connectionLost_B = true
+}
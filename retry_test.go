@@ -0,0 +1,175 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' reconnect and retry policy unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type RetryTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsClientPtr_X *FtpsClient
+	mutex_X         sync.Mutex
+	commandArray_S  []string
+}
+
+var _ = Suite(&RetryTestSuite{})
+
+func (s *RetryTestSuite) SetUpTest(c *C) {
+	var FtpsClientParam_X FtpsClientParam
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789"))
+	s.ftpsServerPtr_X.WriteFile("/Seq/shot/shot_0001.dpx", []byte("frame 1"))
+	s.commandArray_S = nil
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		s.mutex_X.Lock()
+		s.commandArray_S = append(s.commandArray_S, _Command_S+" "+_Argument_S)
+		s.mutex_X.Unlock()
+		return false
+	})
+
+	FtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.RetryPolicy_X = RetryPolicy{MaxAttempt_i: 3, InitialBackoff_S64: 5, MaxBackoff_S64: 20, JitterPercent_i: 50}
+
+	s.ftpsClientPtr_X = NewFtpsClient(&FtpsClientParam_X)
+	Err = s.ftpsClientPtr_X.Connect()
+	if Err != nil {
+		c.Fatalf("Connect error: %v\n", Err)
+	}
+}
+
+func (s *RetryTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns the number of commands '_Command_S' received by the server
+func (s *RetryTestSuite) commandCount(_Command_S string) (rCount_i int) {
+	rCount_i = 0
+	s.mutex_X.Lock()
+	for _, Command_S := range s.commandArray_S {
+		if Command_S == _Command_S {
+			rCount_i++
+		}
+	}
+	s.mutex_X.Unlock()
+	return
+}
+
+func (s *RetryTestSuite) TestIsRetryableError(c *C) {
+	c.Assert(IsRetryableError(nil), Equals, false)
+	c.Assert(IsRetryableError(newFtpsError(FTPPHASE_COMMAND, "PWD", 257, 421, "Service not available", nil)), Equals, true)
+	c.Assert(IsRetryableError(newFtpsError(FTPPHASE_TRANSFER, "RETR a", 226, 426, "Transfer aborted", nil)), Equals, true)
+	c.Assert(IsRetryableError(newFtpsError(FTPPHASE_COMMAND, "RETR a", 150, 550, "Not found", nil)), Equals, false)
+	c.Assert(IsRetryableError(withPhase(ErrPasv, FTPPHASE_DATA, ErrPasv)), Equals, false)
+	c.Assert(IsRetryableError(newFtpsError(FTPPHASE_COMMAND, "PWD", 257, 0, "", io.EOF)), Equals, true)
+	c.Assert(IsRetryableError(syscall.ECONNRESET), Equals, true)
+	c.Assert(IsRetryableError(ErrNotConnected), Equals, true)
+	c.Assert(IsRetryableError(ErrLineFormat), Equals, false)
+}
+
+func (s *RetryTestSuite) TestReconnect(c *C) {
+	c.Assert(s.ftpsClientPtr_X.ChangeWorkingDirectory("shot"), IsNil)
+	//The server closes the session
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "LIST", ReplyCode_i: 421, ReplyMessage_S: "Service not available", Count_i: 1})
+
+	DirEntryArray_X, Err := s.ftpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(len(DirEntryArray_X), Equals, 1)
+	c.Assert(DirEntryArray_X[0].FullName(), Equals, "shot_0001.dpx")
+	c.Assert(s.commandCount("PASS a"), Equals, 2)
+	c.Assert(s.commandCount("CWD /Seq/shot"), Equals, 1)
+
+	Directory_S, Err := s.ftpsClientPtr_X.GetWorkingDirectory()
+	c.Assert(Err, IsNil)
+	c.Assert(Directory_S, Equals, "/Seq/shot")
+}
+
+func (s *RetryTestSuite) TestRetryExhausted(c *C) {
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "MDTM", ReplyCode_i: 450, ReplyMessage_S: "File busy"})
+
+	_, Err := s.ftpsClientPtr_X.GetModificationTime("clip.mxf")
+	c.Assert(IsTransient(Err), Equals, true)
+	c.Assert(s.commandCount("MDTM clip.mxf"), Equals, 3)
+}
+
+func (s *RetryTestSuite) TestNoRetry(c *C) {
+	_, Err := s.ftpsClientPtr_X.GetFileSize("missing.mxf")
+	c.Assert(IsPermanent(Err), Equals, true)
+	c.Assert(s.commandCount("SIZE missing.mxf"), Equals, 1)
+
+	//Not idempotent
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "MKD", ReplyCode_i: 450, ReplyMessage_S: "Busy", Count_i: 1})
+	c.Assert(IsTransient(s.ftpsClientPtr_X.MakeDirectory("new")), Equals, true)
+	c.Assert(s.commandCount("MKD new"), Equals, 1)
+
+	//No retry policy
+	s.ftpsClientPtr_X.FtpsParam_X.RetryPolicy_X = RetryPolicy{}
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "MDTM", ReplyCode_i: 450, ReplyMessage_S: "File busy", Count_i: 1})
+	_, Err = s.ftpsClientPtr_X.GetModificationTime("clip.mxf")
+	c.Assert(IsTransient(Err), Equals, true)
+	c.Assert(s.commandCount("MDTM clip.mxf"), Equals, 1)
+}
+
+func (s *RetryTestSuite) TestResumeRetrieve(c *C) {
+	LocalFilepath_S := filepath.Join(c.MkDir(), "clip.mxf")
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_DROP_DATA, Command_S: "RETR", ByteCount_i: 4, Count_i: 1})
+
+	c.Assert(s.ftpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S), IsNil)
+	Data_U8, Err := os.ReadFile(LocalFilepath_S)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+	c.Assert(s.commandCount("REST 4"), Equals, 1)
+	c.Assert(s.commandCount("RETR clip.mxf"), Equals, 2)
+}
+
+func (s *RetryTestSuite) TestResumeStore(c *C) {
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_DROP_DATA, Command_S: "STOR", ByteCount_i: 6, Count_i: 1})
+
+	c.Assert(s.ftpsClientPtr_X.StoreFile("upload.mxf", []byte("media content")), IsNil)
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/upload.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media content")
+	c.Assert(s.commandCount("REST 6"), Equals, 1)
+}
+
+func (s *RetryTestSuite) TestRestartNotSupported(c *C) {
+	LocalFilepath_S := filepath.Join(c.MkDir(), "clip.mxf")
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_DROP_DATA, Command_S: "RETR", ByteCount_i: 4, Count_i: 1})
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "REST", ReplyCode_i: 502, ReplyMessage_S: "Command not implemented"})
+
+	c.Assert(s.ftpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S), IsNil)
+	Data_U8, Err := os.ReadFile(LocalFilepath_S)
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "0123456789")
+}
+
+func (s *RetryTestSuite) TestCustomClassifier(c *C) {
+	var Count_i int
+
+	s.ftpsClientPtr_X.FtpsParam_X.RetryPolicy_X.IsRetryable = func(_Err error) bool {
+		Count_i++
+		return errors.Is(_Err, ErrLineFormat)
+	}
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "SIZE", ReplyCode_i: 450, ReplyMessage_S: "Busy", Count_i: 1})
+	_, Err := s.ftpsClientPtr_X.GetFileSize("clip.mxf")
+	c.Assert(IsTransient(Err), Equals, true)
+	c.Assert(Count_i, Equals, 1)
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+//Error messages generated by the segmented download
+var (
+	ErrRestart = errors.New("Ftps: Restart not supported by the server")
+	ErrSegment = errors.New("Ftps: Invalid segment")
+)
+
+//Byte range of a remote file fetched by one session
+type fileSegment struct {
+	Offset_U64 uint64
+	Size_U64   uint64
+}
+
+//Read the file called '_RemoteFilepath_S' on the ftp remote ftp server with up to '_NbSegment_i' sessions of the
+//pool in parallel and store its contents in local file '_LocalFilepath_S'. Each session fetches a byte range of the
+//file: the RETR command is preceded by a REST one and the data channel is closed at the end of the range. The ranges
+//are written at their offset in the local file which is removed if the download fails. The local file is created
+//with its final size, so an incomplete range is detected by the number of bytes written by its session
+//Returns error object (ErrRestart if the server does not support REST, ErrSegment if a range is not complete)
+func (this *FtpsClientPool) RetrieveFileSegmented(_RemoteFilepath_S string, _LocalFilepath_S string, _NbSegment_i int) (rRts error) {
+	var FtpsClientPtr_X *FtpsClient
+	var pFile_X *os.File
+	var Size_U64 uint64
+	var SegmentArray_X []fileSegment
+	var WaitGroup_X sync.WaitGroup
+
+	FtpsClientPtr_X, rRts = this.Get()
+	if rRts == nil {
+		Size_U64, rRts = FtpsClientPtr_X.GetFileSize(_RemoteFilepath_S)
+		this.Put(FtpsClientPtr_X)
+	}
+	if rRts == nil {
+		SegmentArray_X = splitSegment(Size_U64, _NbSegment_i)
+		rRts = checkSegment(SegmentArray_X, Size_U64)
+	}
+	if rRts == nil {
+		pFile_X, rRts = os.Create(_LocalFilepath_S)
+		if rRts == nil {
+			rRts = pFile_X.Truncate(int64(Size_U64))
+			if rRts == nil {
+				ErrArray_X := make([]error, len(SegmentArray_X))
+				for i := range SegmentArray_X {
+					WaitGroup_X.Add(1)
+					go func(_Index_i int) {
+						defer WaitGroup_X.Done()
+						ErrArray_X[_Index_i] = this.retrieveSegment(_RemoteFilepath_S, pFile_X, SegmentArray_X[_Index_i])
+					}(i)
+				}
+				WaitGroup_X.Wait()
+				for _, Sts := range ErrArray_X {
+					if Sts != nil {
+						rRts = Sts
+						break
+					}
+				}
+			}
+			if Sts := pFile_X.Close(); rRts == nil {
+				rRts = Sts
+			}
+			if rRts != nil {
+				os.Remove(_LocalFilepath_S)
+			}
+		}
+	}
+	return
+}
+
+//Fetch the byte range '_Segment_X' of the remote file '_RemoteFilepath_S' over a session of the pool and write it
+//at its offset in '_FilePtr_X'
+//Returns error object (ErrSegment if the file ends before the end of the range)
+func (this *FtpsClientPool) retrieveSegment(_RemoteFilepath_S string, _FilePtr_X *os.File, _Segment_X fileSegment) (rRts error) {
+	var FtpsClientPtr_X *FtpsClient
+	var Reader_I io.ReadCloser
+	var Offset_U64 uint64
+	var NbWrite_i64 int64
+
+	FtpsClientPtr_X, rRts = this.Get()
+	if rRts == nil {
+		Reader_I, Offset_U64, rRts = FtpsClientPtr_X.retrieveFileStreamAt(_RemoteFilepath_S, _Segment_X.Offset_U64)
+		if rRts == nil {
+			if Offset_U64 != _Segment_X.Offset_U64 {
+				rRts = ErrRestart
+			} else {
+				NbWrite_i64, rRts = io.CopyN(io.NewOffsetWriter(_FilePtr_X, int64(_Segment_X.Offset_U64)), Reader_I, int64(_Segment_X.Size_U64))
+				//CopyN returns io.EOF when the file ends before the end of the range
+				if (rRts == io.EOF) || ((rRts == nil) && (uint64(NbWrite_i64) != _Segment_X.Size_U64)) {
+					rRts = ErrSegment
+				}
+			}
+			//Abort the transfer if the end of the file has not been reached
+			if Sts := Reader_I.Close(); rRts == nil {
+				rRts = Sts
+			}
+		}
+		this.Put(FtpsClientPtr_X)
+	}
+	return
+}
+
+//Split a file of '_Size_U64' bytes into '_NbSegment_i' contiguous ranges of the same size, the last one getting
+//the remaining bytes. There are less ranges if the file is smaller than '_NbSegment_i' bytes
+//Returns the ranges
+func splitSegment(_Size_U64 uint64, _NbSegment_i int) (rSegmentArray_X []fileSegment) {
+	if _NbSegment_i < 1 {
+		_NbSegment_i = 1
+	}
+	if uint64(_NbSegment_i) > _Size_U64 {
+		_NbSegment_i = int(_Size_U64)
+	}
+	if _NbSegment_i != 0 {
+		SegmentSize_U64 := _Size_U64 / uint64(_NbSegment_i)
+		for i := 0; i < _NbSegment_i; i++ {
+			Segment_X := fileSegment{Offset_U64: uint64(i) * SegmentSize_U64, Size_U64: SegmentSize_U64}
+			if i == _NbSegment_i-1 {
+				Segment_X.Size_U64 = _Size_U64 - Segment_X.Offset_U64
+			}
+			rSegmentArray_X = append(rSegmentArray_X, Segment_X)
+		}
+	}
+	return
+}
+
+//Check that the ranges '_SegmentArray_X' cover a file of '_Size_U64' bytes without gap nor overlap
+//Returns error object
+func checkSegment(_SegmentArray_X []fileSegment, _Size_U64 uint64) (rRts error) {
+	var Offset_U64 uint64
+
+	rRts = nil
+	Offset_U64 = 0
+	for _, Segment_X := range _SegmentArray_X {
+		if (Segment_X.Offset_U64 != Offset_U64) || (Segment_X.Size_U64 == 0) {
+			rRts = ErrSegment
+			break
+		}
+		Offset_U64 += Segment_X.Size_U64
+	}
+	if (rRts == nil) && (Offset_U64 != _Size_U64) {
+		rRts = ErrSegment
+	}
+	return
+}
@@ -0,0 +1,133 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' segmented download unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type SegmentedTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsPoolPtr_X   *FtpsClientPool
+	directory_S     string
+	mutex_X         sync.Mutex
+	restArray_S     []string
+}
+
+var _ = Suite(&SegmentedTestSuite{})
+
+func (s *SegmentedTestSuite) SetUpTest(c *C) {
+	var FtpsClientParam_X FtpsClientParam
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.directory_S = c.MkDir()
+	s.restArray_S = nil
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "REST" {
+			s.mutex_X.Lock()
+			s.restArray_S = append(s.restArray_S, _Argument_S)
+			s.mutex_X.Unlock()
+		}
+		return false
+	})
+
+	FtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	s.ftpsPoolPtr_X = NewFtpsClientPool(&FtpsClientParam_X, &FtpsClientPoolParam{MaxOpen_i: 8})
+}
+
+func (s *SegmentedTestSuite) TearDownTest(c *C) {
+	s.ftpsPoolPtr_X.Close()
+	s.ftpsServerPtr_X.Close()
+}
+
+//Download the remote file '_Data_U8' with '_NbSegment_i' segments and check the local copy
+func (s *SegmentedTestSuite) checkDownload(c *C, _Data_U8 []byte, _NbSegment_i int) {
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", _Data_U8), IsNil)
+	LocalFilepath_S := filepath.Join(s.directory_S, "clip.mxf")
+	c.Assert(s.ftpsPoolPtr_X.RetrieveFileSegmented("clip.mxf", LocalFilepath_S, _NbSegment_i), IsNil)
+	Data_U8, Err := os.ReadFile(LocalFilepath_S)
+	c.Assert(Err, IsNil)
+	c.Assert(Data_U8, DeepEquals, _Data_U8)
+}
+
+func (s *SegmentedTestSuite) TestSplit(c *C) {
+	c.Assert(splitSegment(1003, 4), DeepEquals, []fileSegment{{0, 250}, {250, 250}, {500, 250}, {750, 253}})
+	c.Assert(splitSegment(3, 8), DeepEquals, []fileSegment{{0, 1}, {1, 1}, {2, 1}})
+	c.Assert(splitSegment(10, 0), DeepEquals, []fileSegment{{0, 10}})
+	c.Assert(len(splitSegment(0, 4)), Equals, 0)
+	c.Assert(checkSegment(splitSegment(1003, 4), 1003), IsNil)
+	c.Assert(checkSegment(splitSegment(0, 4), 0), IsNil)
+	c.Assert(checkSegment([]fileSegment{{0, 500}, {600, 403}}, 1003), Equals, ErrSegment)
+	c.Assert(checkSegment([]fileSegment{{0, 500}, {500, 400}}, 1003), Equals, ErrSegment)
+}
+
+func (s *SegmentedTestSuite) TestDownload(c *C) {
+	Data_U8 := make([]byte, 256*1024+3)
+	rand.New(rand.NewSource(1)).Read(Data_U8)
+	s.checkDownload(c, Data_U8, 4)
+	s.mutex_X.Lock()
+	c.Assert(len(s.restArray_S), Equals, 3)
+	s.mutex_X.Unlock()
+
+	//The sessions are still usable after the aborted transfers
+	FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+	c.Assert(Err, IsNil)
+	Size_U64, Err := FtpsClientPtr_X.GetFileSize("clip.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(Size_U64, Equals, uint64(len(Data_U8)))
+	s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+}
+
+func (s *SegmentedTestSuite) TestSmallFile(c *C) {
+	s.checkDownload(c, []byte("abc"), 8)
+	s.checkDownload(c, []byte(strings.Repeat("0123456789", 10)), 1)
+	s.checkDownload(c, []byte{}, 4)
+}
+
+func (s *SegmentedTestSuite) TestError(c *C) {
+	LocalFilepath_S := filepath.Join(s.directory_S, "clip.mxf")
+	Err := s.ftpsPoolPtr_X.RetrieveFileSegmented("missing.mxf", LocalFilepath_S, 4)
+	c.Assert(IsPermanent(Err), Equals, true)
+
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789")), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "REST", ReplyCode_i: 502, ReplyMessage_S: "Command not implemented"})
+	Err = s.ftpsPoolPtr_X.RetrieveFileSegmented("clip.mxf", LocalFilepath_S, 4)
+	c.Assert(errors.Is(Err, ErrRestart), Equals, true)
+	_, Err = os.Stat(LocalFilepath_S)
+	c.Assert(os.IsNotExist(Err), Equals, true)
+}
+
+func (s *SegmentedTestSuite) TestShortFile(c *C) {
+	LocalFilepath_S := filepath.Join(s.directory_S, "clip.mxf")
+	c.Assert(s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789")), IsNil)
+	//The file is shorter than announced: the last range ends early
+	s.ftpsServerPtr_X.SetCommandHook(func(_SessionPtr_X *ftpstest.Session, _Command_S string, _Argument_S string) bool {
+		if _Command_S == "SIZE" {
+			_SessionPtr_X.Reply(213, "16")
+			return true
+		}
+		return false
+	})
+	Err := s.ftpsPoolPtr_X.RetrieveFileSegmented("clip.mxf", LocalFilepath_S, 2)
+	c.Assert(errors.Is(Err, ErrSegment), Equals, true, Commentf("%v", Err))
+	_, Err = os.Stat(LocalFilepath_S)
+	c.Assert(os.IsNotExist(Err), Equals, true)
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+//Traced operation. It follows the OpenTelemetry span model: an OpenTelemetry adapter keeps the context of the span
+//to start the child ones and forwards the calls to trace.Span
+type Span interface {
+	//Set the attribute '_Key_S' of the span, the value is a string, an int, an uint64 or a bool
+	SetAttribute(_Key_S string, _Value_I any)
+	//Record the failure '_Err' of the operation and set the span status to error
+	RecordError(_Err error)
+	//End the span
+	End()
+}
+
+//Creator of the spans of the client operations
+type Tracer interface {
+	//Start the span '_Name_S' child of '_ParentSpan_I' (nil for a root span)
+	//Returns the span
+	Start(_Name_S string, _ParentSpan_I Span) Span
+}
+
+//Span used when no tracer is defined
+type noopSpan struct{}
+
+func (this noopSpan) SetAttribute(_Key_S string, _Value_I any) {}
+func (this noopSpan) RecordError(_Err error)                   {}
+func (this noopSpan) End()                                     {}
+
+//Data connection giving the bytes transferred to the transfer span
+type traceDataConn struct {
+	net.Conn
+	spanPtr_X   *Span
+	nbRead_U64  uint64
+	nbWrite_U64 uint64
+	closed_B    bool
+}
+
+//Start the span '_Name_S' child of '_ParentSpan_I' with the Tracer_I of the client
+//Returns the span, a span doing nothing if there is no tracer
+func (this *FtpsClient) startSpan(_Name_S string, _ParentSpan_I Span) (rSpan_I Span) {
+	rSpan_I = noopSpan{}
+	if this.FtpsParam_X.Tracer_I != nil {
+		rSpan_I = this.FtpsParam_X.Tracer_I.Start(_Name_S, _ParentSpan_I)
+	}
+	return
+}
+
+//Returns the span of the operation in progress (connection or transfer), nil if none
+func (this *FtpsClient) parentSpan() Span {
+	if this.transferSpan_I != nil {
+		return this.transferSpan_I
+	}
+	return this.connectSpan_I
+}
+
+//End the span of the transfer in progress, if any, with the error '_Err'
+func (this *FtpsClient) endTransferSpan(_Err error) {
+	if this.transferSpan_I != nil {
+		endSpan(this.transferSpan_I, _Err)
+		this.transferSpan_I = nil
+	}
+}
+
+//Wrap the data connection '_Connection_I' to give its bytes to the transfer span if a Tracer_I is defined
+//Returns the wrapped connection
+func (this *FtpsClient) newTraceDataConn(_Connection_I net.Conn) (rConnection_I net.Conn) {
+	rConnection_I = _Connection_I
+	if this.FtpsParam_X.Tracer_I != nil {
+		rConnection_I = &traceDataConn{Conn: _Connection_I, spanPtr_X: &this.transferSpan_I}
+	}
+	return
+}
+
+//Record the error '_Err', if any, and end '_Span_I'
+func endSpan(_Span_I Span, _Err error) {
+	if _Err != nil {
+		_Span_I.RecordError(_Err)
+	}
+	_Span_I.End()
+}
+
+//Set the TLS version attribute of '_Span_I' if '_Connection_I' is a TLS connection
+func setTlsVersion(_Span_I Span, _Connection_I net.Conn) {
+	if pTlsConnection_X, Ok_B := _Connection_I.(*tls.Conn); Ok_B {
+		_Span_I.SetAttribute("tls.version", tls.VersionName(pTlsConnection_X.ConnectionState().Version))
+	}
+}
+
+//Read from the data connection and count the bytes received
+//Returns number of byte read and error object
+func (this *traceDataConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	this.nbRead_U64 += uint64(rNbRead_i)
+	return
+}
+
+//Write to the data connection and count the bytes sent
+//Returns number of byte written and error object
+func (this *traceDataConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i, rRts = this.Conn.Write(_DataArray_U8)
+	this.nbWrite_U64 += uint64(rNbWrite_i)
+	return
+}
+
+//Close the data connection and set the byte attributes of the transfer span which is ended with the transfer reply
+//Returns error object
+func (this *traceDataConn) Close() (rRts error) {
+	rRts = this.Conn.Close()
+	if !this.closed_B {
+		this.closed_B = true
+		if *this.spanPtr_X != nil {
+			(*this.spanPtr_X).SetAttribute("ftp.bytes_read", this.nbRead_U64)
+			(*this.spanPtr_X).SetAttribute("ftp.bytes_written", this.nbWrite_U64)
+		}
+	}
+	return
+}
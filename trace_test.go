@@ -0,0 +1,198 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' tracing unit test.
+*/
+package ftpsclient
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+//Span kept in memory by the testTracer
+type testSpan struct {
+	name_S         string
+	parentPtr_X    *testSpan
+	attributeMap_X map[string]any
+	err            error
+	ended_B        bool
+}
+
+//Tracer keeping its spans in their start order
+type testTracer struct {
+	mutex_X     sync.Mutex
+	spanArray_X []*testSpan
+}
+
+func (this *testTracer) Start(_Name_S string, _ParentSpan_I Span) Span {
+	pSpan_X := &testSpan{name_S: _Name_S, attributeMap_X: map[string]any{}}
+	if _ParentSpan_I != nil {
+		pSpan_X.parentPtr_X = _ParentSpan_I.(*testSpan)
+	}
+	this.mutex_X.Lock()
+	this.spanArray_X = append(this.spanArray_X, pSpan_X)
+	this.mutex_X.Unlock()
+	return pSpan_X
+}
+
+func (this *testSpan) SetAttribute(_Key_S string, _Value_I any) {
+	this.attributeMap_X[_Key_S] = _Value_I
+}
+
+func (this *testSpan) RecordError(_Err error) {
+	this.err = _Err
+}
+
+func (this *testSpan) End() {
+	this.ended_B = true
+}
+
+//Returns the spans named '_Name_S'
+func (this *testTracer) find(_Name_S string) (rSpanArray_X []*testSpan) {
+	this.mutex_X.Lock()
+	for _, pSpan_X := range this.spanArray_X {
+		if pSpan_X.name_S == _Name_S {
+			rSpanArray_X = append(rSpanArray_X, pSpan_X)
+		}
+	}
+	this.mutex_X.Unlock()
+	return
+}
+
+//Returns the command span of '_Command_S'
+func (this *testTracer) command(_Command_S string) *testSpan {
+	for _, pSpan_X := range this.find("ftp.command") {
+		if pSpan_X.attributeMap_X["ftp.command"] == _Command_S {
+			return pSpan_X
+		}
+	}
+	return nil
+}
+
+type TraceTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	tracerPtr_X     *testTracer
+}
+
+var _ = Suite(&TraceTestSuite{})
+
+func (s *TraceTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.MakeDirectory("/Seq")
+	s.tracerPtr_X = &testTracer{}
+}
+
+func (s *TraceTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of the test server traced by the suite tracer
+func (s *TraceTestSuite) newClient(_SecureFtp_B bool) *FtpsClient {
+	FtpsClientParam_X := newTestParam(s.ftpsServerPtr_X)
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.Tracer_I = s.tracerPtr_X
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+func (s *TraceTestSuite) TestConnect(c *C) {
+	FtpsClientPtr_X := s.newClient(false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	ConnectSpanArray_X := s.tracerPtr_X.find("ftp.connect")
+	c.Assert(ConnectSpanArray_X, HasLen, 1)
+	pConnectSpan_X := ConnectSpanArray_X[0]
+	c.Assert(pConnectSpan_X.ended_B, Equals, true)
+	c.Assert(pConnectSpan_X.err, IsNil)
+	c.Assert(pConnectSpan_X.parentPtr_X, IsNil)
+	c.Assert(pConnectSpan_X.attributeMap_X["server.address"], Equals, s.ftpsServerPtr_X.Host())
+	c.Assert(pConnectSpan_X.attributeMap_X["server.port"], Equals, int(s.ftpsServerPtr_X.Port()))
+
+	pSpan_X := s.tracerPtr_X.command("PASS ****")
+	c.Assert(pSpan_X, NotNil)
+	c.Assert(pSpan_X.parentPtr_X, Equals, pConnectSpan_X)
+	c.Assert(pSpan_X.attributeMap_X["ftp.reply_code"], Equals, 230)
+	c.Assert(pSpan_X.ended_B, Equals, true)
+	pSpan_X = s.tracerPtr_X.command("QUIT")
+	c.Assert(pSpan_X, NotNil)
+	c.Assert(pSpan_X.parentPtr_X, IsNil)
+	c.Assert(pSpan_X.attributeMap_X["ftp.reply_code"], Equals, 221)
+}
+
+func (s *TraceTestSuite) TestTransfer(c *C) {
+	FtpsClientPtr_X := s.newClient(false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content")), IsNil)
+	c.Assert(FtpsClientPtr_X.RetrieveFile("clip.mxf", filepath.Join(c.MkDir(), "clip.mxf")), IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	TransferSpanArray_X := s.tracerPtr_X.find("ftp.transfer")
+	c.Assert(TransferSpanArray_X, HasLen, 2)
+	pStoreSpan_X, pRetrieveSpan_X := TransferSpanArray_X[0], TransferSpanArray_X[1]
+	c.Assert(pStoreSpan_X.attributeMap_X["ftp.command"], Equals, "STOR clip.mxf")
+	c.Assert(pStoreSpan_X.attributeMap_X["ftp.bytes_written"], Equals, uint64(len("media content")))
+	c.Assert(pStoreSpan_X.attributeMap_X["ftp.reply_code"], Equals, 226)
+	c.Assert(pStoreSpan_X.ended_B, Equals, true)
+	c.Assert(pStoreSpan_X.err, IsNil)
+	c.Assert(pRetrieveSpan_X.attributeMap_X["ftp.command"], Equals, "RETR clip.mxf")
+	c.Assert(pRetrieveSpan_X.attributeMap_X["ftp.bytes_read"], Equals, uint64(len("media content")))
+	c.Assert(pRetrieveSpan_X.ended_B, Equals, true)
+	_, Ok_B := pRetrieveSpan_X.attributeMap_X["tls.version"]
+	c.Assert(Ok_B, Equals, false)
+
+	OpenSpanArray_X := s.tracerPtr_X.find("ftp.data.open")
+	c.Assert(OpenSpanArray_X, HasLen, 2)
+	c.Assert(OpenSpanArray_X[0].parentPtr_X, Equals, pStoreSpan_X)
+	c.Assert(OpenSpanArray_X[0].ended_B, Equals, true)
+	c.Assert(OpenSpanArray_X[0].attributeMap_X["server.port"], NotNil)
+	pSpan_X := s.tracerPtr_X.command("RETR clip.mxf")
+	c.Assert(pSpan_X, NotNil)
+	c.Assert(pSpan_X.parentPtr_X, Equals, pRetrieveSpan_X)
+	c.Assert(pSpan_X.attributeMap_X["ftp.reply_code"], Equals, 150)
+}
+
+func (s *TraceTestSuite) TestSecure(c *C) {
+	FtpsClientPtr_X := s.newClient(true)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	_, Err := FtpsClientPtr_X.List()
+	c.Assert(Err, IsNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	c.Assert(s.tracerPtr_X.find("ftp.connect")[0].attributeMap_X["tls.version"], Matches, "TLS 1\\.[23]")
+	c.Assert(s.tracerPtr_X.find("ftp.transfer")[0].attributeMap_X["tls.version"], Matches, "TLS 1\\.[23]")
+}
+
+func (s *TraceTestSuite) TestError(c *C) {
+	FtpsClientPtr_X := s.newClient(false)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "RETR", ReplyCode_i: 550, ReplyMessage_S: "No such file", Count_i: 1})
+	c.Assert(FtpsClientPtr_X.RetrieveFile("missing.mxf", filepath.Join(c.MkDir(), "missing.mxf")), NotNil)
+	c.Assert(FtpsClientPtr_X.Disconnect(), IsNil)
+
+	pSpan_X := s.tracerPtr_X.command("RETR missing.mxf")
+	c.Assert(pSpan_X, NotNil)
+	c.Assert(pSpan_X.attributeMap_X["ftp.reply_code"], Equals, 550)
+	c.Assert(pSpan_X.err, NotNil)
+	TransferSpanArray_X := s.tracerPtr_X.find("ftp.transfer")
+	c.Assert(TransferSpanArray_X, HasLen, 1)
+	c.Assert(TransferSpanArray_X[0].ended_B, Equals, true)
+	c.Assert(IsPermanent(TransferSpanArray_X[0].err), Equals, true)
+
+	pFtpsClient_X := s.newClient(false)
+	pFtpsClient_X.FtpsParam_X.LoginPassword_S = "wrong"
+	c.Assert(pFtpsClient_X.Connect(), NotNil)
+	ConnectSpanArray_X := s.tracerPtr_X.find("ftp.connect")
+	c.Assert(ConnectSpanArray_X[len(ConnectSpanArray_X)-1].err, NotNil)
+	c.Assert(ConnectSpanArray_X[len(ConnectSpanArray_X)-1].ended_B, Equals, true)
+}
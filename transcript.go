@@ -0,0 +1,218 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+//Transcript entry direction container
+type TRANSCRIPTDIRECTION string
+
+//Transcript entry direction
+const (
+	//Control connection opened, the line is the server address
+	TRANSCRIPTDIRECTION_OPEN TRANSCRIPTDIRECTION = "open"
+	//Line sent by the client
+	TRANSCRIPTDIRECTION_SEND TRANSCRIPTDIRECTION = "send"
+	//Line received from the server
+	TRANSCRIPTDIRECTION_RECV TRANSCRIPTDIRECTION = "recv"
+	//Data channel transfer, written when the data connection is closed
+	TRANSCRIPTDIRECTION_DATA TRANSCRIPTDIRECTION = "data"
+)
+
+//Line of a transcript file. The data channel fields are only set for the TRANSCRIPTDIRECTION_DATA entries
+type TranscriptEntry struct {
+	Time_X      time.Time           `json:"time"`
+	Id_U32      uint32              `json:"id"`
+	Direction_E TRANSCRIPTDIRECTION `json:"direction"`
+	//Control connection line without its end of line, the commands are redacted
+	Line_S string `json:"line,omitempty"`
+	//Transfer command, bytes received and sent on the data connection and transfer duration
+	Request_S    string        `json:"request,omitempty"`
+	NbRead_U64   uint64        `json:"read,omitempty"`
+	NbWrite_U64  uint64        `json:"write,omitempty"`
+	Duration_S64 time.Duration `json:"duration,omitempty"`
+	//First bytes transferred on the data connection (up to MaxData_i)
+	Data_U8 []byte `json:"data,omitempty"`
+}
+
+//Transcript recorder writing the entries as JSON lines. It can be shared by several clients
+type TranscriptRecorder struct {
+	//Maximum number of data connection bytes kept in the transcript for each transfer, 0 keeps only the metadata
+	MaxData_i int
+
+	mutex_X      sync.Mutex
+	encoderPtr_X *json.Encoder
+}
+
+//Control connection recording the lines sent and received
+type transcriptConn struct {
+	net.Conn
+	ftpsClientPtr_X *FtpsClient
+	readBuffer_U8   []byte
+	writeBuffer_U8  []byte
+}
+
+//Data connection recording the metadata of the transfer when it is closed
+type transcriptDataConn struct {
+	net.Conn
+	ftpsClientPtr_X *FtpsClient
+	entry_X         TranscriptEntry
+	closed_B        bool
+}
+
+//Create a new TranscriptRecorder writing to '_Writer_I'
+//Returns pointer to TranscriptRecorder
+func NewTranscriptRecorder(_Writer_I io.Writer) *TranscriptRecorder {
+	p := new(TranscriptRecorder)
+	p.encoderPtr_X = json.NewEncoder(_Writer_I)
+	return p
+}
+
+//Write the entry '_Entry_X' as a JSON line
+//Returns error object
+func (this *TranscriptRecorder) Record(_Entry_X TranscriptEntry) (rRts error) {
+	this.mutex_X.Lock()
+	rRts = this.encoderPtr_X.Encode(_Entry_X)
+	this.mutex_X.Unlock()
+	return
+}
+
+//Read the transcript entries written by a TranscriptRecorder from '_Reader_I'
+//Returns the entries and error object
+func ReadTranscript(_Reader_I io.Reader) (rEntryArray_X []TranscriptEntry, rRts error) {
+	var Entry_X TranscriptEntry
+
+	DecoderPtr_X := json.NewDecoder(_Reader_I)
+	for {
+		Entry_X = TranscriptEntry{}
+		rRts = DecoderPtr_X.Decode(&Entry_X)
+		if rRts != nil {
+			if rRts == io.EOF {
+				rRts = nil
+			}
+			break
+		}
+		rEntryArray_X = append(rEntryArray_X, Entry_X)
+	}
+	return
+}
+
+//Record '_Entry_X' with the time and the session id if a TranscriptRecorderPtr_X is defined
+func (this *FtpsClient) record(_Entry_X TranscriptEntry) {
+	if this.FtpsParam_X.TranscriptRecorderPtr_X != nil {
+		_Entry_X.Time_X = time.Now()
+		_Entry_X.Id_U32 = this.FtpsParam_X.Id_U32
+		this.FtpsParam_X.TranscriptRecorderPtr_X.Record(_Entry_X)
+	}
+}
+
+//Create the text protocol handler of the control connection '_Connection_I', recorded if a
+//TranscriptRecorderPtr_X is defined
+//Returns pointer to the text protocol handler
+func (this *FtpsClient) newTextProtocol(_Connection_I net.Conn) (rTextProtocolPtr_X *textproto.Conn) {
+	if this.FtpsParam_X.TranscriptRecorderPtr_X != nil {
+		_Connection_I = &transcriptConn{Conn: _Connection_I, ftpsClientPtr_X: this}
+	}
+	rTextProtocolPtr_X = textproto.NewConn(_Connection_I)
+	return
+}
+
+//Wrap the data connection '_Connection_I' of the transfer started with '_Request_S' to record it if a
+//TranscriptRecorderPtr_X is defined
+//Returns the wrapped connection
+func (this *FtpsClient) newTranscriptDataConn(_Connection_I net.Conn, _Request_S string) (rConnection_I net.Conn) {
+	rConnection_I = _Connection_I
+	if this.FtpsParam_X.TranscriptRecorderPtr_X != nil {
+		p := &transcriptDataConn{Conn: _Connection_I, ftpsClientPtr_X: this}
+		p.entry_X.Direction_E = TRANSCRIPTDIRECTION_DATA
+		p.entry_X.Request_S = this.redact(_Request_S)
+		p.entry_X.Time_X = time.Now()
+		rConnection_I = p
+	}
+	return
+}
+
+//Read from the control connection and record the complete lines received
+//Returns number of byte read and error object
+func (this *transcriptConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	this.readBuffer_U8 = this.recordLine(TRANSCRIPTDIRECTION_RECV, append(this.readBuffer_U8, _DataArray_U8[:rNbRead_i]...))
+	return
+}
+
+//Write to the control connection and record the complete lines sent
+//Returns number of byte written and error object
+func (this *transcriptConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i, rRts = this.Conn.Write(_DataArray_U8)
+	this.writeBuffer_U8 = this.recordLine(TRANSCRIPTDIRECTION_SEND, append(this.writeBuffer_U8, _DataArray_U8[:rNbWrite_i]...))
+	return
+}
+
+//Record the complete lines of '_Buffer_U8' in direction '_Direction_E'
+//Returns the beginning of the next line
+func (this *transcriptConn) recordLine(_Direction_E TRANSCRIPTDIRECTION, _Buffer_U8 []byte) []byte {
+	for {
+		Pos_i := bytes.IndexByte(_Buffer_U8, '\n')
+		if Pos_i < 0 {
+			break
+		}
+		Line_S := string(bytes.TrimRight(_Buffer_U8[:Pos_i], "\r"))
+		if _Direction_E == TRANSCRIPTDIRECTION_SEND {
+			Line_S = this.ftpsClientPtr_X.redact(Line_S)
+		}
+		this.ftpsClientPtr_X.record(TranscriptEntry{Direction_E: _Direction_E, Line_S: Line_S})
+		_Buffer_U8 = _Buffer_U8[Pos_i+1:]
+	}
+	return _Buffer_U8
+}
+
+//Read from the data connection and count the bytes received
+//Returns number of byte read and error object
+func (this *transcriptDataConn) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i, rRts = this.Conn.Read(_DataArray_U8)
+	this.entry_X.NbRead_U64 += uint64(rNbRead_i)
+	this.keepData(_DataArray_U8[:rNbRead_i])
+	return
+}
+
+//Write to the data connection and count the bytes sent
+//Returns number of byte written and error object
+func (this *transcriptDataConn) Write(_DataArray_U8 []byte) (rNbWrite_i int, rRts error) {
+	rNbWrite_i, rRts = this.Conn.Write(_DataArray_U8)
+	this.entry_X.NbWrite_U64 += uint64(rNbWrite_i)
+	this.keepData(_DataArray_U8[:rNbWrite_i])
+	return
+}
+
+//Keep the beginning of '_DataArray_U8' in the entry up to the MaxData_i of the recorder
+func (this *transcriptDataConn) keepData(_DataArray_U8 []byte) {
+	NbFree_i := this.ftpsClientPtr_X.FtpsParam_X.TranscriptRecorderPtr_X.MaxData_i - len(this.entry_X.Data_U8)
+	if NbFree_i > 0 {
+		if len(_DataArray_U8) > NbFree_i {
+			_DataArray_U8 = _DataArray_U8[:NbFree_i]
+		}
+		this.entry_X.Data_U8 = append(this.entry_X.Data_U8, _DataArray_U8...)
+	}
+}
+
+//Close the data connection and record the transfer
+//Returns error object
+func (this *transcriptDataConn) Close() (rRts error) {
+	rRts = this.Conn.Close()
+	if !this.closed_B {
+		this.closed_B = true
+		this.entry_X.Duration_S64 = time.Since(this.entry_X.Time_X)
+		this.ftpsClientPtr_X.record(this.entry_X)
+	}
+	return
+}
@@ -0,0 +1,151 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' transcript recorder unit test.
+	The transcripts are recorded against the test server and played back with the ftpstest ReplayServer.
+*/
+package ftpsclient
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type TranscriptTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	buffer_X        bytes.Buffer
+	directory_S     string
+}
+
+var _ = Suite(&TranscriptTestSuite{})
+
+func (s *TranscriptTestSuite) SetUpTest(c *C) {
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "secret-password"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/shot_0001.dpx", []byte("frame 1"))
+	s.buffer_X.Reset()
+	s.directory_S = c.MkDir()
+}
+
+func (s *TranscriptTestSuite) TearDownTest(c *C) {
+	s.ftpsServerPtr_X.Close()
+}
+
+//Returns a client of '_Server_I' recording its transcript in '_TranscriptRecorderPtr_X'
+func (s *TranscriptTestSuite) newClient(_Server_I testServer, _SecureFtp_B bool, _TranscriptRecorderPtr_X *TranscriptRecorder) *FtpsClient {
+	FtpsClientParam_X := newTestParam(_Server_I)
+	FtpsClientParam_X.Id_U32 = 42
+	FtpsClientParam_X.LoginPassword_S = "secret-password"
+	FtpsClientParam_X.SecureFtp_B = _SecureFtp_B
+	FtpsClientParam_X.TranscriptRecorderPtr_X = _TranscriptRecorderPtr_X
+	return NewFtpsClient(&FtpsClientParam_X)
+}
+
+//Run the scenario recorded and replayed by the tests
+//Returns the names listed, the contents of the retrieved file and error object
+func (s *TranscriptTestSuite) scenario(_FtpsClientPtr_X *FtpsClient) (rNameArray_S []string, rData_U8 []byte, rRts error) {
+	var DirEntryArray_X []DirEntry
+
+	rRts = _FtpsClientPtr_X.Connect()
+	if rRts == nil {
+		rRts = _FtpsClientPtr_X.StoreFile("clip.mxf", []byte("media content"))
+		if rRts == nil {
+			DirEntryArray_X, rRts = _FtpsClientPtr_X.List()
+			for _, DirEntry_X := range DirEntryArray_X {
+				rNameArray_S = append(rNameArray_S, DirEntry_X.FullName())
+			}
+		}
+		if rRts == nil {
+			LocalFilepath_S := filepath.Join(s.directory_S, "clip.mxf")
+			rRts = _FtpsClientPtr_X.RetrieveFile("clip.mxf", LocalFilepath_S)
+			if rRts == nil {
+				rData_U8, rRts = os.ReadFile(LocalFilepath_S)
+			}
+		}
+		if Sts := _FtpsClientPtr_X.Disconnect(); rRts == nil {
+			rRts = Sts
+		}
+	}
+	return
+}
+
+//Record the scenario against the test server in the '_SecureFtp_B' mode and replay it
+func (s *TranscriptTestSuite) checkRecordReplay(c *C, _SecureFtp_B bool) {
+	pTranscriptRecorder_X := NewTranscriptRecorder(&s.buffer_X)
+	pTranscriptRecorder_X.MaxData_i = 4096
+	NameArray_S, Data_U8, Err := s.scenario(s.newClient(s.ftpsServerPtr_X, _SecureFtp_B, pTranscriptRecorder_X))
+	c.Assert(Err, IsNil)
+	c.Assert(strings.Contains(s.buffer_X.String(), "secret-password"), Equals, false)
+
+	pReplayServer_X, Err := ftpstest.NewReplayServer(bytes.NewReader(s.buffer_X.Bytes()))
+	c.Assert(Err, IsNil)
+	defer pReplayServer_X.Close()
+	ReplayNameArray_S, ReplayData_U8, Err := s.scenario(s.newClient(pReplayServer_X, _SecureFtp_B, nil))
+	c.Assert(Err, IsNil)
+	c.Assert(ReplayNameArray_S, DeepEquals, NameArray_S)
+	c.Assert(ReplayData_U8, DeepEquals, Data_U8)
+	c.Assert(pReplayServer_X.Close(), IsNil)
+	c.Assert(pReplayServer_X.Err(), IsNil)
+}
+
+func (s *TranscriptTestSuite) TestRecord(c *C) {
+	_, _, Err := s.scenario(s.newClient(s.ftpsServerPtr_X, false, NewTranscriptRecorder(&s.buffer_X)))
+	c.Assert(Err, IsNil)
+	EntryArray_X, Err := ReadTranscript(&s.buffer_X)
+	c.Assert(Err, IsNil)
+	c.Assert(len(EntryArray_X) > 0, Equals, true)
+	c.Assert(EntryArray_X[0].Direction_E, Equals, TRANSCRIPTDIRECTION_OPEN)
+	c.Assert(EntryArray_X[1].Line_S, Equals, "220 ftpstest ready")
+
+	DataArray_X := map[string]TranscriptEntry{}
+	LineArray_S := []string{}
+	for _, Entry_X := range EntryArray_X {
+		c.Assert(Entry_X.Id_U32, Equals, uint32(42))
+		c.Assert(Entry_X.Time_X.IsZero(), Equals, false)
+		if Entry_X.Direction_E == TRANSCRIPTDIRECTION_DATA {
+			DataArray_X[Entry_X.Request_S] = Entry_X
+			c.Assert(len(Entry_X.Data_U8), Equals, 0)
+		} else {
+			LineArray_S = append(LineArray_S, string(Entry_X.Direction_E)+" "+Entry_X.Line_S)
+		}
+	}
+	c.Assert(strings.Join(LineArray_S, "\n"), Matches, "(?s).*send USER mc\nrecv 331 .*\nsend PASS \\*\\*\\*\\*\nrecv 230 .*")
+	c.Assert(DataArray_X["STOR clip.mxf"].NbWrite_U64, Equals, uint64(len("media content")))
+	c.Assert(DataArray_X["RETR clip.mxf"].NbRead_U64, Equals, uint64(len("media content")))
+	c.Assert(DataArray_X["LIST -a"].NbRead_U64 > 0, Equals, true)
+}
+
+func (s *TranscriptTestSuite) TestReplay(c *C) {
+	s.checkRecordReplay(c, false)
+}
+
+func (s *TranscriptTestSuite) TestReplaySecure(c *C) {
+	s.checkRecordReplay(c, true)
+}
+
+func (s *TranscriptTestSuite) TestReplayMismatch(c *C) {
+	_, _, Err := s.scenario(s.newClient(s.ftpsServerPtr_X, false, NewTranscriptRecorder(&s.buffer_X)))
+	c.Assert(Err, IsNil)
+
+	pReplayServer_X, Err := ftpstest.NewReplayServer(bytes.NewReader(s.buffer_X.Bytes()))
+	c.Assert(Err, IsNil)
+	defer pReplayServer_X.Close()
+	FtpsClientPtr_X := s.newClient(pReplayServer_X, false, nil)
+	c.Assert(FtpsClientPtr_X.Connect(), IsNil)
+	c.Assert(FtpsClientPtr_X.MakeDirectory("Other"), NotNil)
+	FtpsClientPtr_X.Disconnect()
+	c.Assert(pReplayServer_X.Close(), IsNil)
+	c.Assert(errors.Is(pReplayServer_X.Err(), ftpstest.ErrTranscriptMismatch), Equals, true)
+}
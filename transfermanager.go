@@ -0,0 +1,406 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+package ftpsclient
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+//Error messages generated by the transfer manager
+var (
+	ErrManagerClosed = errors.New("Ftps: Transfer manager is closed")
+	ErrCanceled      = errors.New("Ftps: Transfer canceled")
+)
+
+//Transfer direction container
+type TRANSFERTYPE int
+
+//Transfer direction
+const (
+	TRANSFERTYPE_UPLOAD TRANSFERTYPE = iota
+	TRANSFERTYPE_DOWNLOAD
+)
+
+//Transfer state container
+type TRANSFERSTATE int
+
+//Transfer state, DONE, FAILED and CANCELED are final
+const (
+	TRANSFERSTATE_QUEUED TRANSFERSTATE = iota
+	TRANSFERSTATE_RUNNING
+	TRANSFERSTATE_DONE
+	TRANSFERSTATE_FAILED
+	TRANSFERSTATE_CANCELED
+)
+
+//Returns the name of the state
+func (this TRANSFERSTATE) String() string {
+	switch this {
+	case TRANSFERSTATE_QUEUED:
+		return "queued"
+	case TRANSFERSTATE_RUNNING:
+		return "running"
+	case TRANSFERSTATE_DONE:
+		return "done"
+	case TRANSFERSTATE_FAILED:
+		return "failed"
+	case TRANSFERSTATE_CANCELED:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+//Upload or download job submitted to the transfer manager
+type TransferJob struct {
+	Type_E           TRANSFERTYPE
+	LocalFilepath_S  string
+	RemoteFilepath_S string
+	//Jobs with the highest priority are run first, jobs with the same priority in their submission order
+	Priority_i int
+	//Total number of attempts, 0 uses the MaxAttempt_i of the manager
+	MaxAttempt_i int
+}
+
+//Progress of a job
+type TransferStatus struct {
+	Id_U64  uint64
+	Job_X   TransferJob
+	State_E TRANSFERSTATE
+	//Current attempt, starting at 1 when the job runs
+	Attempt_i int
+	//Number of bytes transferred by the current attempt
+	NbByte_U64 uint64
+	//Error of the last attempt
+	Err error
+}
+
+//Transfer manager working parameters
+type TransferManagerParam struct {
+	//Number of jobs run in parallel, each one uses a session of the pool
+	NbWorker_i int
+	//Default total number of attempts of a job, 0 or 1 means no retry
+	MaxAttempt_i int
+	//Delay in ms between two attempts of a job
+	RetryBackoff_S64 time.Duration
+	//Called at each state change of a job, from the goroutine which has changed it
+	OnStatus func(_Status_X TransferStatus)
+}
+
+//Job handle returned by TransferManager.Submit
+type Transfer struct {
+	managerPtr_X *TransferManager
+	status_X     TransferStatus
+	cancel_B     bool
+	index_i      int
+	doneChan_X   chan bool
+}
+
+//Queue of the pending jobs ordered by priority (container/heap interface)
+type transferQueue []*Transfer
+
+//Queue of upload and download jobs run by a set of workers over the sessions of a FtpsClientPool
+type TransferManager struct {
+	Param_X TransferManagerParam
+
+	poolPtr_X   *FtpsClientPool
+	mutex_X     sync.Mutex
+	cond_X      *sync.Cond
+	queue_X     transferQueue
+	nextId_U64  uint64
+	closed_B    bool
+	waitGroup_X sync.WaitGroup
+}
+
+//Create a new TransferManager running its jobs over the sessions of '_FtpsClientPoolPtr_X' with the parameters
+//stored in _TransferManagerParamPtr_X. The workers are started immediately
+//Returns pointer to TransferManager
+func NewTransferManager(_FtpsClientPoolPtr_X *FtpsClientPool, _TransferManagerParamPtr_X *TransferManagerParam) *TransferManager {
+	p := new(TransferManager)
+	p.Param_X = *_TransferManagerParamPtr_X
+	p.poolPtr_X = _FtpsClientPoolPtr_X
+	p.cond_X = sync.NewCond(&p.mutex_X)
+	if p.Param_X.NbWorker_i <= 0 {
+		p.Param_X.NbWorker_i = 1
+	}
+	for i := 0; i < p.Param_X.NbWorker_i; i++ {
+		p.waitGroup_X.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+//Add the job '_TransferJob_X' to the queue
+//Returns the job handle and error object
+func (this *TransferManager) Submit(_TransferJob_X TransferJob) (rTransferPtr_X *Transfer, rRts error) {
+	rTransferPtr_X = nil
+	rRts = nil
+	if _TransferJob_X.MaxAttempt_i <= 0 {
+		_TransferJob_X.MaxAttempt_i = this.Param_X.MaxAttempt_i
+	}
+	this.mutex_X.Lock()
+	if this.closed_B {
+		rRts = ErrManagerClosed
+	} else {
+		this.nextId_U64++
+		rTransferPtr_X = &Transfer{managerPtr_X: this, doneChan_X: make(chan bool)}
+		rTransferPtr_X.status_X = TransferStatus{Id_U64: this.nextId_U64, Job_X: _TransferJob_X, State_E: TRANSFERSTATE_QUEUED}
+		heap.Push(&this.queue_X, rTransferPtr_X)
+		this.cond_X.Signal()
+	}
+	this.mutex_X.Unlock()
+	if rRts == nil {
+		this.notify(rTransferPtr_X.Status())
+	}
+	return
+}
+
+//Stop accepting new jobs and wait for the end of the submitted ones
+//Returns error object
+func (this *TransferManager) Close() (rRts error) {
+	rRts = nil
+	this.mutex_X.Lock()
+	this.closed_B = true
+	this.cond_X.Broadcast()
+	this.mutex_X.Unlock()
+	this.waitGroup_X.Wait()
+	return
+}
+
+//Returns the current status of the job
+func (this *Transfer) Status() (rStatus_X TransferStatus) {
+	this.managerPtr_X.mutex_X.Lock()
+	rStatus_X = this.status_X
+	this.managerPtr_X.mutex_X.Unlock()
+	return
+}
+
+//Returns a channel closed when the job has reached a final state
+func (this *Transfer) Done() <-chan bool {
+	return this.doneChan_X
+}
+
+//Wait for the end of the job
+//Returns the final status of the job
+func (this *Transfer) Wait() TransferStatus {
+	<-this.doneChan_X
+	return this.Status()
+}
+
+//Cancel the job: a queued job is removed from the queue, a running one is aborted (the partial remote or local file
+//is deleted). Nothing is done if the job is already finished
+func (this *Transfer) Cancel() {
+	var Status_X TransferStatus
+
+	pTransferManager_X := this.managerPtr_X
+	pTransferManager_X.mutex_X.Lock()
+	this.cancel_B = true
+	Removed_B := (this.status_X.State_E == TRANSFERSTATE_QUEUED) && (this.index_i >= 0)
+	if Removed_B {
+		heap.Remove(&pTransferManager_X.queue_X, this.index_i)
+		this.status_X.State_E = TRANSFERSTATE_CANCELED
+		this.status_X.Err = ErrCanceled
+		Status_X = this.status_X
+		close(this.doneChan_X)
+	}
+	pTransferManager_X.mutex_X.Unlock()
+	if Removed_B {
+		pTransferManager_X.notify(Status_X)
+	}
+}
+
+//Worker goroutine: run the queued jobs until the manager is closed and the queue is empty
+func (this *TransferManager) worker() {
+	var TransferPtr_X *Transfer
+
+	defer this.waitGroup_X.Done()
+	for {
+		this.mutex_X.Lock()
+		for (len(this.queue_X) == 0) && !this.closed_B {
+			this.cond_X.Wait()
+		}
+		if len(this.queue_X) == 0 {
+			this.mutex_X.Unlock()
+			return
+		}
+		TransferPtr_X = heap.Pop(&this.queue_X).(*Transfer)
+		this.mutex_X.Unlock()
+		this.run(TransferPtr_X)
+	}
+}
+
+//Run the job '_TransferPtr_X' with its retries until it reaches a final state
+func (this *TransferManager) run(_TransferPtr_X *Transfer) {
+	var Sts error
+
+	for Attempt_i := 1; ; Attempt_i++ {
+		Canceled_B := this.setStatus(_TransferPtr_X, TRANSFERSTATE_RUNNING, Attempt_i, nil)
+		if Canceled_B {
+			Sts = ErrCanceled
+		} else {
+			Sts = this.transfer(_TransferPtr_X)
+		}
+		if (Sts == nil) || errors.Is(Sts, ErrCanceled) || (Attempt_i >= _TransferPtr_X.status_X.Job_X.MaxAttempt_i) || !IsRetryableError(Sts) {
+			break
+		}
+		this.setStatus(_TransferPtr_X, TRANSFERSTATE_RUNNING, Attempt_i, Sts)
+		time.Sleep(this.Param_X.RetryBackoff_S64 * time.Millisecond)
+	}
+	if Sts == nil {
+		this.setStatus(_TransferPtr_X, TRANSFERSTATE_DONE, 0, nil)
+	} else if errors.Is(Sts, ErrCanceled) {
+		this.setStatus(_TransferPtr_X, TRANSFERSTATE_CANCELED, 0, Sts)
+	} else {
+		this.setStatus(_TransferPtr_X, TRANSFERSTATE_FAILED, 0, Sts)
+	}
+}
+
+//Change the state of the job '_TransferPtr_X'. '_Attempt_i' is the new attempt number (0 keeps the current one)
+//and '_Err' the error of the last attempt
+//Returns true if the job has been canceled
+func (this *TransferManager) setStatus(_TransferPtr_X *Transfer, _State_E TRANSFERSTATE, _Attempt_i int, _Err error) (rCanceled_B bool) {
+	var Status_X TransferStatus
+
+	this.mutex_X.Lock()
+	if _Attempt_i != 0 {
+		if _Attempt_i != _TransferPtr_X.status_X.Attempt_i {
+			_TransferPtr_X.status_X.NbByte_U64 = 0
+		}
+		_TransferPtr_X.status_X.Attempt_i = _Attempt_i
+	}
+	_TransferPtr_X.status_X.State_E = _State_E
+	_TransferPtr_X.status_X.Err = _Err
+	Status_X = _TransferPtr_X.status_X
+	rCanceled_B = _TransferPtr_X.cancel_B
+	if _State_E >= TRANSFERSTATE_DONE {
+		close(_TransferPtr_X.doneChan_X)
+	}
+	this.mutex_X.Unlock()
+	this.notify(Status_X)
+	return
+}
+
+//Report the status '_Status_X' to the OnStatus callback
+func (this *TransferManager) notify(_Status_X TransferStatus) {
+	if this.Param_X.OnStatus != nil {
+		this.Param_X.OnStatus(_Status_X)
+	}
+}
+
+//Run one attempt of the job '_TransferPtr_X' over a session of the pool
+//Returns error object (ErrCanceled if the job has been canceled during the transfer)
+func (this *TransferManager) transfer(_TransferPtr_X *Transfer) (rRts error) {
+	var FtpsClientPtr_X *FtpsClient
+	var pFile_X *os.File
+	var Reader_I io.ReadCloser
+	var Writer_I io.WriteCloser
+
+	Job_X := _TransferPtr_X.status_X.Job_X
+	FtpsClientPtr_X, rRts = this.poolPtr_X.Get()
+	if rRts == nil {
+		if Job_X.Type_E == TRANSFERTYPE_UPLOAD {
+			pFile_X, rRts = os.Open(Job_X.LocalFilepath_S)
+			if rRts == nil {
+				Writer_I, rRts = FtpsClientPtr_X.StoreFileStream(Job_X.RemoteFilepath_S)
+				if rRts == nil {
+					_, rRts = io.Copy(Writer_I, &transferReader{reader_I: pFile_X, transferPtr_X: _TransferPtr_X})
+					if Sts := Writer_I.Close(); rRts == nil {
+						rRts = Sts
+					}
+					if errors.Is(rRts, ErrCanceled) {
+						FtpsClientPtr_X.DeleteFile(Job_X.RemoteFilepath_S)
+					}
+				}
+				pFile_X.Close()
+			}
+		} else {
+			Reader_I, rRts = FtpsClientPtr_X.RetrieveFileStream(Job_X.RemoteFilepath_S)
+			if rRts == nil {
+				pFile_X, rRts = os.Create(Job_X.LocalFilepath_S)
+				if rRts == nil {
+					_, rRts = io.Copy(pFile_X, &transferReader{reader_I: Reader_I, transferPtr_X: _TransferPtr_X})
+					if Sts := pFile_X.Close(); rRts == nil {
+						rRts = Sts
+					}
+					if errors.Is(rRts, ErrCanceled) {
+						os.Remove(Job_X.LocalFilepath_S)
+					}
+				}
+				if Sts := Reader_I.Close(); rRts == nil {
+					rRts = Sts
+				}
+			}
+		}
+		this.poolPtr_X.Put(FtpsClientPtr_X)
+	}
+	return
+}
+
+//Reader counting the bytes transferred by a job and stopping it when it is canceled
+type transferReader struct {
+	reader_I      io.Reader
+	transferPtr_X *Transfer
+}
+
+//Read the next part of the file
+//Returns number of byte read and error object (ErrCanceled if the job has been canceled)
+func (this *transferReader) Read(_DataArray_U8 []byte) (rNbRead_i int, rRts error) {
+	rNbRead_i = 0
+	pTransferManager_X := this.transferPtr_X.managerPtr_X
+	pTransferManager_X.mutex_X.Lock()
+	Canceled_B := this.transferPtr_X.cancel_B
+	pTransferManager_X.mutex_X.Unlock()
+	if Canceled_B {
+		rRts = ErrCanceled
+	} else {
+		rNbRead_i, rRts = this.reader_I.Read(_DataArray_U8)
+		pTransferManager_X.mutex_X.Lock()
+		this.transferPtr_X.status_X.NbByte_U64 += uint64(rNbRead_i)
+		pTransferManager_X.mutex_X.Unlock()
+	}
+	return
+}
+
+//Returns the number of pending jobs
+func (this transferQueue) Len() int {
+	return len(this)
+}
+
+//Returns true if job 'i' must be run before job 'j'
+func (this transferQueue) Less(i, j int) bool {
+	if this[i].status_X.Job_X.Priority_i != this[j].status_X.Job_X.Priority_i {
+		return this[i].status_X.Job_X.Priority_i > this[j].status_X.Job_X.Priority_i
+	}
+	return this[i].status_X.Id_U64 < this[j].status_X.Id_U64
+}
+
+//Exchange jobs 'i' and 'j'
+func (this transferQueue) Swap(i, j int) {
+	this[i], this[j] = this[j], this[i]
+	this[i].index_i = i
+	this[j].index_i = j
+}
+
+//Add the job '_Item_I' at the end of the queue
+func (this *transferQueue) Push(_Item_I interface{}) {
+	TransferPtr_X := _Item_I.(*Transfer)
+	TransferPtr_X.index_i = len(*this)
+	*this = append(*this, TransferPtr_X)
+}
+
+//Remove the last job of the queue
+//Returns the job removed
+func (this *transferQueue) Pop() interface{} {
+	Queue_X := *this
+	TransferPtr_X := Queue_X[len(Queue_X)-1]
+	Queue_X[len(Queue_X)-1] = nil
+	TransferPtr_X.index_i = -1
+	*this = Queue_X[:len(Queue_X)-1]
+	return TransferPtr_X
+}
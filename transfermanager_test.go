@@ -0,0 +1,256 @@
+// Copyright 2014 OnBings. All rights reserved.
+// Use of this source code is governed by a APACHE-style
+// license that can be found in the LICENSE file.
+
+/*
+	This module implements the 'ftpsclient' transfer manager unit test.
+*/
+package ftpsclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/onbings/ftpsclient/ftpstest"
+	. "gopkg.in/check.v1"
+)
+
+type TransferManagerTestSuite struct {
+	ftpsServerPtr_X *ftpstest.Server
+	ftpsPoolPtr_X   *FtpsClientPool
+	managerPtr_X    *TransferManager
+	directory_S     string
+	mutex_X         sync.Mutex
+	runArray_S      []string
+	transferMap_X   map[uint64]*Transfer
+	cancelId_U64    uint64
+}
+
+var _ = Suite(&TransferManagerTestSuite{})
+
+func (s *TransferManagerTestSuite) SetUpTest(c *C) {
+	var FtpsClientParam_X FtpsClientParam
+	var Err error
+
+	s.ftpsServerPtr_X, Err = ftpstest.NewServer(&ftpstest.ServerParam{LoginName_S: "mc", LoginPassword_S: "a"})
+	if Err != nil {
+		c.Fatalf("NewServer error: %v\n", Err)
+	}
+	s.ftpsServerPtr_X.WriteFile("/Seq/clip.mxf", []byte("0123456789"))
+	s.directory_S = c.MkDir()
+	s.runArray_S = nil
+	s.transferMap_X = make(map[uint64]*Transfer)
+	s.cancelId_U64 = 0
+
+	FtpsClientParam_X = newTestParam(s.ftpsServerPtr_X)
+	s.ftpsPoolPtr_X = NewFtpsClientPool(&FtpsClientParam_X, &FtpsClientPoolParam{MaxOpen_i: 3})
+	s.managerPtr_X = nil
+}
+
+func (s *TransferManagerTestSuite) TearDownTest(c *C) {
+	if s.managerPtr_X != nil {
+		s.managerPtr_X.Close()
+	}
+	s.ftpsPoolPtr_X.Close()
+	s.ftpsServerPtr_X.Close()
+}
+
+//Create the manager under test with '_NbWorker_i' workers and '_MaxAttempt_i' attempts per job
+func (s *TransferManagerTestSuite) newManager(_NbWorker_i int, _MaxAttempt_i int) {
+	s.managerPtr_X = NewTransferManager(s.ftpsPoolPtr_X, &TransferManagerParam{NbWorker_i: _NbWorker_i, MaxAttempt_i: _MaxAttempt_i, RetryBackoff_S64: 5, OnStatus: s.onStatus})
+}
+
+//Record the local file name of the jobs started and cancel the job 'cancelId_U64' when it starts
+func (s *TransferManagerTestSuite) onStatus(_Status_X TransferStatus) {
+	var TransferPtr_X *Transfer
+
+	s.mutex_X.Lock()
+	if (_Status_X.State_E == TRANSFERSTATE_RUNNING) && (_Status_X.Err == nil) {
+		s.runArray_S = append(s.runArray_S, filepath.Base(_Status_X.Job_X.LocalFilepath_S))
+		if _Status_X.Id_U64 == s.cancelId_U64 {
+			TransferPtr_X = s.transferMap_X[_Status_X.Id_U64]
+		}
+	}
+	s.mutex_X.Unlock()
+	if TransferPtr_X != nil {
+		TransferPtr_X.Cancel()
+	}
+}
+
+//Submit the job '_TransferJob_X' to the manager
+//Returns the job handle
+func (s *TransferManagerTestSuite) submit(c *C, _TransferJob_X TransferJob) (rTransferPtr_X *Transfer) {
+	var Err error
+
+	rTransferPtr_X, Err = s.managerPtr_X.Submit(_TransferJob_X)
+	c.Assert(Err, IsNil)
+	s.mutex_X.Lock()
+	s.transferMap_X[rTransferPtr_X.Status().Id_U64] = rTransferPtr_X
+	s.mutex_X.Unlock()
+	return
+}
+
+//Take all the sessions of the pool to keep the workers waiting
+//Returns the sessions to put back
+func (s *TransferManagerTestSuite) holdPool(c *C) (rFtpsClientArray_X []*FtpsClient) {
+	for i := 0; i < s.ftpsPoolPtr_X.PoolParam_X.MaxOpen_i; i++ {
+		FtpsClientPtr_X, Err := s.ftpsPoolPtr_X.Get()
+		c.Assert(Err, IsNil)
+		rFtpsClientArray_X = append(rFtpsClientArray_X, FtpsClientPtr_X)
+	}
+	return
+}
+
+//Give back the sessions taken by holdPool
+func (s *TransferManagerTestSuite) releasePool(_FtpsClientArray_X []*FtpsClient) {
+	for _, FtpsClientPtr_X := range _FtpsClientArray_X {
+		s.ftpsPoolPtr_X.Put(FtpsClientPtr_X)
+	}
+}
+
+func (s *TransferManagerTestSuite) TestUploadDownload(c *C) {
+	var TransferArray_X []*Transfer
+
+	s.newManager(3, 1)
+	for i := 0; i < 10; i++ {
+		LocalFilepath_S := filepath.Join(s.directory_S, fmt.Sprintf("up_%d.mxf", i))
+		c.Assert(os.WriteFile(LocalFilepath_S, []byte(fmt.Sprintf("media %d", i)), 0644), IsNil)
+		TransferArray_X = append(TransferArray_X, s.submit(c, TransferJob{Type_E: TRANSFERTYPE_UPLOAD, LocalFilepath_S: LocalFilepath_S, RemoteFilepath_S: fmt.Sprintf("clip_%d.mxf", i)}))
+	}
+	for _, TransferPtr_X := range TransferArray_X {
+		Status_X := TransferPtr_X.Wait()
+		c.Assert(Status_X.Err, IsNil)
+		c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_DONE)
+	}
+
+	TransferArray_X = nil
+	for i := 0; i < 10; i++ {
+		TransferArray_X = append(TransferArray_X, s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, fmt.Sprintf("down_%d.mxf", i)), RemoteFilepath_S: fmt.Sprintf("clip_%d.mxf", i)}))
+	}
+	for i, TransferPtr_X := range TransferArray_X {
+		Status_X := TransferPtr_X.Wait()
+		c.Assert(Status_X.Err, IsNil)
+		c.Assert(Status_X.NbByte_U64, Equals, uint64(len(fmt.Sprintf("media %d", i))))
+		Data_U8, Err := os.ReadFile(filepath.Join(s.directory_S, fmt.Sprintf("down_%d.mxf", i)))
+		c.Assert(Err, IsNil)
+		c.Assert(string(Data_U8), Equals, fmt.Sprintf("media %d", i))
+	}
+}
+
+//Wait for '_Count_i' jobs to be started
+func (s *TransferManagerTestSuite) waitRunning(_Count_i int) {
+	for {
+		s.mutex_X.Lock()
+		Count_i := len(s.runArray_S)
+		s.mutex_X.Unlock()
+		if Count_i >= _Count_i {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (s *TransferManagerTestSuite) TestPriority(c *C) {
+	var TransferArray_X []*Transfer
+
+	s.newManager(1, 1)
+	FtpsClientArray_X := s.holdPool(c)
+	TransferArray_X = append(TransferArray_X, s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "a"), RemoteFilepath_S: "clip.mxf"}))
+	//The worker is waiting for a session with the first job
+	s.waitRunning(1)
+	for i, Priority_i := range []int{0, 5, 1, 5} {
+		TransferArray_X = append(TransferArray_X, s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, fmt.Sprintf("%d", i)), RemoteFilepath_S: "clip.mxf", Priority_i: Priority_i}))
+	}
+	c.Assert(TransferArray_X[1].Status().State_E, Equals, TRANSFERSTATE_QUEUED)
+	s.releasePool(FtpsClientArray_X)
+
+	for _, TransferPtr_X := range TransferArray_X {
+		c.Assert(TransferPtr_X.Wait().State_E, Equals, TRANSFERSTATE_DONE)
+	}
+	s.mutex_X.Lock()
+	c.Assert(s.runArray_S, DeepEquals, []string{"a", "1", "3", "2", "0"})
+	s.mutex_X.Unlock()
+}
+
+func (s *TransferManagerTestSuite) TestRetry(c *C) {
+	s.newManager(2, 2)
+	LocalFilepath_S := filepath.Join(s.directory_S, "up.mxf")
+	c.Assert(os.WriteFile(LocalFilepath_S, []byte("media"), 0644), IsNil)
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "STOR", ReplyCode_i: 450, ReplyMessage_S: "Busy", Count_i: 1})
+
+	Status_X := s.submit(c, TransferJob{Type_E: TRANSFERTYPE_UPLOAD, LocalFilepath_S: LocalFilepath_S, RemoteFilepath_S: "up.mxf"}).Wait()
+	c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_DONE)
+	c.Assert(Status_X.Attempt_i, Equals, 2)
+	Data_U8, Err := s.ftpsServerPtr_X.ReadFile("/Seq/up.mxf")
+	c.Assert(Err, IsNil)
+	c.Assert(string(Data_U8), Equals, "media")
+
+	//Permanent error
+	Status_X = s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "missing.mxf"), RemoteFilepath_S: "missing.mxf", MaxAttempt_i: 3}).Wait()
+	c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_FAILED)
+	c.Assert(Status_X.Attempt_i, Equals, 1)
+	c.Assert(IsPermanent(Status_X.Err), Equals, true)
+
+	//Retries exhausted
+	s.ftpsServerPtr_X.InjectFault(ftpstest.Fault{Type_E: ftpstest.FAULTTYPE_REPLY, Command_S: "RETR", ReplyCode_i: 450, ReplyMessage_S: "Busy"})
+	Status_X = s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "clip.mxf"), RemoteFilepath_S: "clip.mxf", MaxAttempt_i: 3}).Wait()
+	c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_FAILED)
+	c.Assert(Status_X.Attempt_i, Equals, 3)
+	c.Assert(IsTransient(Status_X.Err), Equals, true)
+}
+
+func (s *TransferManagerTestSuite) TestCancel(c *C) {
+	s.newManager(1, 1)
+	LocalFilepath_S := filepath.Join(s.directory_S, "up.mxf")
+	c.Assert(os.WriteFile(LocalFilepath_S, []byte("media"), 0644), IsNil)
+	FtpsClientArray_X := s.holdPool(c)
+
+	UploadPtr_X := s.submit(c, TransferJob{Type_E: TRANSFERTYPE_UPLOAD, LocalFilepath_S: LocalFilepath_S, RemoteFilepath_S: "up.mxf"})
+	s.waitRunning(1)
+	QueuedPtr_X := s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "queued.mxf"), RemoteFilepath_S: "clip.mxf"})
+	DownloadPtr_X := s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "down.mxf"), RemoteFilepath_S: "clip.mxf"})
+	s.mutex_X.Lock()
+	s.cancelId_U64 = DownloadPtr_X.Status().Id_U64
+	s.mutex_X.Unlock()
+
+	//Cancel a queued job
+	QueuedPtr_X.Cancel()
+	Status_X := QueuedPtr_X.Wait()
+	c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_CANCELED)
+	c.Assert(errors.Is(Status_X.Err, ErrCanceled), Equals, true)
+
+	//Cancel the upload waiting for a session: it is aborted when the transfer starts
+	UploadPtr_X.Cancel()
+	c.Assert(UploadPtr_X.Status().State_E, Equals, TRANSFERSTATE_RUNNING)
+	s.releasePool(FtpsClientArray_X)
+	c.Assert(UploadPtr_X.Wait().State_E, Equals, TRANSFERSTATE_CANCELED)
+	c.Assert(s.ftpsServerPtr_X.Exists("/Seq/up.mxf"), Equals, false)
+
+	//The download is canceled by the status callback when it starts
+	c.Assert(DownloadPtr_X.Wait().State_E, Equals, TRANSFERSTATE_CANCELED)
+	_, Err := os.Stat(filepath.Join(s.directory_S, "down.mxf"))
+	c.Assert(os.IsNotExist(Err), Equals, true)
+	_, Err = os.Stat(filepath.Join(s.directory_S, "queued.mxf"))
+	c.Assert(os.IsNotExist(Err), Equals, true)
+
+	//Finished jobs are not affected
+	s.ftpsServerPtr_X.WriteFile("/Seq/up.mxf", []byte("media"))
+	Status_X = s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "clip.mxf"), RemoteFilepath_S: "up.mxf"}).Wait()
+	c.Assert(Status_X.State_E, Equals, TRANSFERSTATE_DONE)
+	UploadPtr_X.Cancel()
+	c.Assert(UploadPtr_X.Status().State_E, Equals, TRANSFERSTATE_CANCELED)
+}
+
+func (s *TransferManagerTestSuite) TestClose(c *C) {
+	s.newManager(2, 1)
+	TransferPtr_X := s.submit(c, TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "clip.mxf"), RemoteFilepath_S: "clip.mxf"})
+	c.Assert(s.managerPtr_X.Close(), IsNil)
+	c.Assert(TransferPtr_X.Status().State_E, Equals, TRANSFERSTATE_DONE)
+
+	_, Err := s.managerPtr_X.Submit(TransferJob{Type_E: TRANSFERTYPE_DOWNLOAD, LocalFilepath_S: filepath.Join(s.directory_S, "clip.mxf"), RemoteFilepath_S: "clip.mxf"})
+	c.Assert(errors.Is(Err, ErrManagerClosed), Equals, true)
+}